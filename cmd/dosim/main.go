@@ -0,0 +1,229 @@
+package main
+
+/**
+ * dosim plays DigitalOcean's role against a locally running add-on. It can
+ * send every request DigitalOcean makes to an add-on, and serve the parts of
+ * the DigitalOcean API an add-on calls back into. Start the add-on with
+ * DIGITALOCEAN_API_URL=http://localhost:8083 and the same CLIENT_SECRET to
+ * point it at the simulator.
+ */
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sample_app/internal/dosim"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const usage = `usage: dosim <command> [flags]
+
+commands:
+  serve        run the fake DigitalOcean API
+  provision    send a provisioning request
+  plan-change  send a plan change request
+  deprovision  send a deprovisioning request
+  notify       send a notification
+  sso          send a signed single sign-on request
+  lifecycle    run the fake API and walk a resource through its whole lifecycle
+
+Run "dosim <command> -h" for the flags of each command. Credentials default to
+the same environment variables the add-on reads: APP_SLUG, APP_PASSWORD,
+APP_SALT and CLIENT_SECRET.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	ctx := context.Background()
+	args := os.Args[2:]
+	switch os.Args[1] {
+	case "serve":
+		err = serve(args)
+	case "provision":
+		err = provision(ctx, args)
+	case "plan-change":
+		err = planChange(ctx, args)
+	case "deprovision":
+		err = deprovision(ctx, args)
+	case "notify":
+		err = notify(ctx, args)
+	case "sso":
+		err = sso(ctx, args)
+	case "lifecycle":
+		err = lifecycle(ctx, args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":8083", "address to serve the fake API on")
+	clientSecret := flags.String("client-secret", os.Getenv("CLIENT_SECRET"), "client secret the add-on must send")
+	tokenTTL := flags.Duration("token-ttl", 8*time.Hour, "lifetime of issued access tokens")
+	failConfigUpdates := flags.Int("fail-config-updates", 0, "answer this many config pushes with a 503")
+	flags.Parse(args)
+
+	api := dosim.NewAPI(*clientSecret, *tokenTTL)
+	api.FailConfigUpdates(*failConfigUpdates)
+	return api.Start(*addr)
+}
+
+func provision(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("provision", flag.ExitOnError)
+	sim := simulatorFlags(flags)
+	r := resourceFlags(flags)
+	flags.Parse(args)
+
+	fmt.Println("Provisioning " + r.UUID)
+	return report(sim.Provision(ctx, *r))
+}
+
+func planChange(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("plan-change", flag.ExitOnError)
+	sim := simulatorFlags(flags)
+	resourceUUID := flags.String("uuid", "", "resource UUID (required)")
+	plan := flags.String("plan", "", "new plan slug (required)")
+	flags.Parse(args)
+	if *resourceUUID == "" || *plan == "" {
+		return fmt.Errorf("-uuid and -plan are required")
+	}
+
+	return report(sim.ChangePlan(ctx, *resourceUUID, *plan))
+}
+
+func deprovision(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("deprovision", flag.ExitOnError)
+	sim := simulatorFlags(flags)
+	resourceUUID := flags.String("uuid", "", "resource UUID (required)")
+	flags.Parse(args)
+	if *resourceUUID == "" {
+		return fmt.Errorf("-uuid is required")
+	}
+
+	return report(sim.Deprovision(ctx, *resourceUUID))
+}
+
+func notify(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("notify", flag.ExitOnError)
+	sim := simulatorFlags(flags)
+	r := resourceFlags(flags)
+	notificationType := flags.String("type", "", "one of suspended, reactivated, deprovisioning.failed, updated (required)")
+	uuids := flags.String("uuids", "", "comma separated resource UUIDs, for every type but updated (default: -uuid)")
+	state := flags.String("state", "active", "resource state, for updated")
+	planName := flags.String("plan-name", "", "plan display name, for updated (default: -plan)")
+	flags.Parse(args)
+
+	fullType := "resources." + strings.TrimPrefix(*notificationType, "resources.")
+	if fullType == dosim.Updated {
+		if *planName == "" {
+			*planName = r.PlanSlug
+		}
+		return report(sim.NotifyUpdated(ctx, *r, *state, *planName))
+	}
+
+	resourceUUIDs := []string{r.UUID}
+	if *uuids != "" {
+		resourceUUIDs = strings.Split(*uuids, ",")
+	}
+	return report(sim.NotifyResources(ctx, fullType, resourceUUIDs))
+}
+
+func sso(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("sso", flag.ExitOnError)
+	sim := simulatorFlags(flags)
+	resourceUUID := flags.String("uuid", "", "resource UUID (required)")
+	email := flags.String("email", "sim@example.com", "email of the signing in user")
+	userID := flags.String("user-id", "sim-user", "id of the signing in user")
+	flags.Parse(args)
+	if *resourceUUID == "" {
+		return fmt.Errorf("-uuid is required")
+	}
+
+	return report(sim.SSO(ctx, *resourceUUID, *email, *userID))
+}
+
+func lifecycle(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("lifecycle", flag.ExitOnError)
+	sim := simulatorFlags(flags)
+	r := resourceFlags(flags)
+	newPlan := flags.String("new-plan", "pro", "plan slug to change to")
+	apiAddr := flags.String("api-addr", ":8083", "address to serve the fake API on, or empty to not serve it")
+	clientSecret := flags.String("client-secret", os.Getenv("CLIENT_SECRET"), "client secret the add-on must send")
+	flags.Parse(args)
+
+	var api *dosim.API
+	if *apiAddr != "" {
+		api = dosim.NewAPI(*clientSecret, 8*time.Hour)
+		go func() {
+			err := api.Start(*apiAddr)
+			fmt.Fprintln(os.Stderr, "fake API stopped: "+err.Error())
+			os.Exit(1)
+		}()
+	}
+
+	fmt.Println("Running lifecycle for " + r.UUID)
+	err := dosim.RunLifecycle(ctx, sim, api, *r, *newPlan, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Lifecycle completed")
+	return nil
+}
+
+func simulatorFlags(flags *flag.FlagSet) *dosim.Simulator {
+	sim := &dosim.Simulator{}
+	flags.StringVar(&sim.AddonURL, "addon", envOrDefault("ADDON_URL", "http://localhost:8082"), "base URL of the add-on")
+	flags.StringVar(&sim.AppSlug, "slug", envOrDefault("APP_SLUG", "sample_app"), "app slug, used for basic auth")
+	flags.StringVar(&sim.AppPassword, "password", envOrDefault("APP_PASSWORD", "password"), "app password, used for basic auth")
+	flags.StringVar(&sim.AppSalt, "salt", envOrDefault("APP_SALT", "salt"), "app salt, used to sign SSO requests")
+	return sim
+}
+
+func resourceFlags(flags *flag.FlagSet) *dosim.Resource {
+	r := &dosim.Resource{}
+	flags.StringVar(&r.UUID, "uuid", uuid.New().String(), "resource UUID")
+	flags.StringVar(&r.Name, "name", "sim-resource", "resource name")
+	flags.StringVar(&r.AppSlug, "app", envOrDefault("APP_SLUG", "sample_app"), "app slug")
+	flags.StringVar(&r.PlanSlug, "plan", "basic", "plan slug")
+	flags.StringVar(&r.Email, "email", "sim@example.com", "obfuscated user email")
+	flags.StringVar(&r.TeamID, "team", "sim-team", "team id (creator_id)")
+	flags.StringVar(&r.Language, "language", "en", "metadata language")
+	return r
+}
+
+func report(res *dosim.Response, err error) error {
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(res)
+	if !res.OK() {
+		return fmt.Errorf("add-on responded %d", res.StatusCode)
+	}
+	return nil
+}
+
+func envOrDefault(key string, defaultVal string) string {
+	envVar, isSet := os.LookupEnv(key)
+	if !isSet {
+		return defaultVal
+	}
+	return envVar
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sample_app/internal/license"
+	"strings"
+	"time"
+)
+
+// Print a new license signing key. To rotate keys, put it at the front of
+// LICENSE_SIGNING_KEYS and keep the old ones after it until every license
+// they signed has been replaced.
+func runGenerateLicenseKey(args []string) error {
+	flags := flag.NewFlagSet("generate-license-key", flag.ExitOnError)
+	id := flags.String("id", time.Now().UTC().Format("2006-01-02"), "key identifier, embedded in every license the key signs")
+	flags.Parse(args)
+
+	if *id == "" || strings.ContainsAny(*id, ":,") {
+		return fmt.Errorf("key identifier %q may not be empty or contain ':' or ','", *id)
+	}
+
+	key, err := license.GenerateKey(*id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "Add this to the front of LICENSE_SIGNING_KEYS:")
+	fmt.Println(key)
+	return nil
+}
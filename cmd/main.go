@@ -6,11 +6,54 @@ import (
 	"os"
 	"sample_app/internal/database"
 	"sample_app/internal/server"
+	"sample_app/internal/store"
 )
 
 func main() {
-	// Connect to database
 	ctx := context.Background()
+
+	// Subcommands for maintenance tasks
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "migrate":
+			err = runMigrate(os.Args[2:])
+		case "reencrypt-tokens":
+			err = runReencryptTokens(os.Args[2:])
+		case "generate-license-key":
+			err = runGenerateLicenseKey(os.Args[2:])
+		default:
+			err = fmt.Errorf("unknown command %q", os.Args[1])
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Encrypt OAuth tokens at rest when keys are configured
+	keyring, err := tokenKeyring()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid TOKEN_ENCRYPTION_KEYS: %v\n", err)
+		os.Exit(1)
+	}
+	withEncryption := func(s store.Store) store.Store {
+		if keyring == nil {
+			fmt.Println("TOKEN_ENCRYPTION_KEYS is not set, tokens will be stored in plaintext")
+			return s
+		}
+		return store.NewEncryptedStore(s, keyring)
+	}
+
+	// Run without a database when asked to, e.g. for local development
+	if os.Getenv("STORE_BACKEND") == "memory" {
+		fmt.Println("Using in-memory store")
+		server.StartServer(ctx, withEncryption(store.NewMemoryStore()))
+		return
+	}
+
+	// Connect to database
 	db, err := database.OpenDB()
 	if err != nil {
 		fmt.Printf("Unable to connect to database. Exiting.")
@@ -29,5 +72,5 @@ func main() {
 	fmt.Println(greeting)
 
 	// Start up server and start handling requests
-	server.StartServer(ctx, db)
+	server.StartServer(ctx, withEncryption(store.NewPostgresStore(db)))
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sample_app/internal/database"
+)
+
+const migrateUsage = `usage: main migrate <up|down|status> [flags]
+
+  up      apply pending migrations
+  down    roll back applied migrations
+  status  list migrations and whether they have been applied
+`
+
+// Manage the database schema. Runs under the same advisory lock the server
+// uses on startup, so it is safe to run while other instances are live.
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	action := args[0]
+
+	flags := flag.NewFlagSet("migrate "+action, flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "show what would change without changing anything")
+	target := flags.Int("to", -1, "up: highest version to apply (default: all)")
+	steps := flags.Int("steps", 1, "down: number of migrations to roll back")
+	flags.Parse(args[1:])
+
+	ctx := context.Background()
+	db, err := database.Connect()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	verb := "Applied"
+	if *dryRun {
+		verb = "Would apply"
+	}
+
+	switch action {
+	case "up":
+		applied, err := database.MigrateUp(ctx, db, *target, *dryRun)
+		for _, m := range applied {
+			fmt.Printf("%s %d_%s\n", verb, m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+		return err
+	case "down":
+		verb = "Rolled back"
+		if *dryRun {
+			verb = "Would roll back"
+		}
+		rolledBack, err := database.MigrateDown(ctx, db, *steps, *dryRun)
+		for _, m := range rolledBack {
+			fmt.Printf("%s %d_%s\n", verb, m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := database.MigrationStatuses(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", status.Version, status.Name, state)
+		}
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
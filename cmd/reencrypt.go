@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sample_app/internal/database"
+	"sample_app/internal/secrets"
+	"sample_app/internal/store"
+)
+
+// Read the keys used to encrypt OAuth tokens at rest. Returns nil if none are configured.
+func tokenKeyring() (*secrets.Keyring, error) {
+	spec := os.Getenv("TOKEN_ENCRYPTION_KEYS")
+	if spec == "" {
+		return nil, nil
+	}
+	return secrets.ParseKeyring(spec)
+}
+
+// Encrypt every stored token and pending authorization code with the newest
+// key in TOKEN_ENCRYPTION_KEYS. Run after adding a new key to the front of the
+// list; once it finishes the old keys can be removed.
+func runReencryptTokens(args []string) error {
+	keyring, err := tokenKeyring()
+	if err != nil {
+		return err
+	}
+	if keyring == nil {
+		return errors.New("TOKEN_ENCRYPTION_KEYS must be set")
+	}
+
+	db, err := database.OpenDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rewritten, err := store.ReencryptTokens(context.Background(), store.NewPostgresStore(db), keyring)
+	fmt.Printf("Re-encrypted %d tokens and authorization codes with key %q\n", rewritten, keyring.PrimaryID())
+	return err
+}
@@ -0,0 +1,185 @@
+package catalog
+
+/**
+ * The catalog describes the apps and plans this add-on offers. It is read
+ * from a JSON file so plans can be changed without a new build, and the file
+ * can be reloaded while the server is running. Each revision of the file
+ * carries a version number, which is reported alongside the plans so clients
+ * can tell which revision they were given.
+ */
+
+import (
+	"fmt"
+	"sample_app/internal/jsonfile"
+	"sort"
+	"strings"
+)
+
+type Catalog struct {
+	// Revision of the catalog. Bump it whenever the file changes.
+	Version int   `json:"version"`
+	Apps    []App `json:"apps"`
+}
+
+type App struct {
+	// Matches the app_slug DigitalOcean sends
+	Slug  string `json:"slug"`
+	Name  string `json:"name"`
+	Plans []Plan `json:"plans"`
+}
+
+type Plan struct {
+	// Matches the plan_slug DigitalOcean sends
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+
+	// Monthly price in US cents
+	PriceCents int64 `json:"price_cents"`
+
+	// Named quotas, e.g. "seats": 5
+	Limits map[string]int64 `json:"limits"`
+
+	// Names of the features the plan includes
+	Features []string `json:"features"`
+
+	// Templates for the config vars each resource on the plan is given, by
+	// name. See RenderConfigVar for what they may contain. Plans without any
+	// get DefaultConfigVars.
+	ConfigVars map[string]string `json:"config_vars"`
+}
+
+// The config vars of plans that do not list their own
+var DefaultConfigVars = map[string]string{
+	"LICENSE_KEY": "{{license_key}}",
+}
+
+// The config var templates of the plan
+func (p *Plan) ConfigTemplates() map[string]string {
+	if len(p.ConfigVars) == 0 {
+		return DefaultConfigVars
+	}
+	return p.ConfigVars
+}
+
+// Returned when a slug does not match any app in the catalog
+type UnknownAppError struct {
+	Slug  string
+	Known []string
+}
+
+func (e *UnknownAppError) Error() string {
+	return fmt.Sprintf("Unknown app %q, expected one of: %s", e.Slug, strings.Join(e.Known, ", "))
+}
+
+// Returned when a slug does not match any of an app's plans
+type UnknownPlanError struct {
+	App   string
+	Slug  string
+	Known []string
+}
+
+func (e *UnknownPlanError) Error() string {
+	return fmt.Sprintf("Unknown plan %q for app %q, expected one of: %s", e.Slug, e.App, strings.Join(e.Known, ", "))
+}
+
+// Parse and validate a catalog
+func Parse(data []byte) (*Catalog, error) {
+	return jsonfile.Parse("catalog", data, (*Catalog).validate)
+}
+
+// Read and parse the catalog at path
+func Load(path string) (*Catalog, error) {
+	return jsonfile.Load("catalog", path, (*Catalog).validate)
+}
+
+func (c *Catalog) validate() error {
+	if c.Version < 1 {
+		return fmt.Errorf("catalog: version must be at least 1")
+	}
+	if len(c.Apps) == 0 {
+		return fmt.Errorf("catalog: no apps")
+	}
+
+	apps := map[string]bool{}
+	for _, app := range c.Apps {
+		if app.Slug == "" {
+			return fmt.Errorf("catalog: app with no slug")
+		}
+		if apps[app.Slug] {
+			return fmt.Errorf("catalog: app %q is listed twice", app.Slug)
+		}
+		apps[app.Slug] = true
+		if len(app.Plans) == 0 {
+			return fmt.Errorf("catalog: app %q has no plans", app.Slug)
+		}
+
+		plans := map[string]bool{}
+		for _, plan := range app.Plans {
+			if plan.Slug == "" {
+				return fmt.Errorf("catalog: app %q has a plan with no slug", app.Slug)
+			}
+			if plans[plan.Slug] {
+				return fmt.Errorf("catalog: app %q lists plan %q twice", app.Slug, plan.Slug)
+			}
+			plans[plan.Slug] = true
+			if plan.Name == "" {
+				return fmt.Errorf("catalog: plan %q of app %q has no name", plan.Slug, app.Slug)
+			}
+			if plan.PriceCents < 0 {
+				return fmt.Errorf("catalog: plan %q of app %q has a negative price", plan.Slug, app.Slug)
+			}
+			for name, limit := range plan.Limits {
+				if limit < 0 {
+					return fmt.Errorf("catalog: plan %q of app %q has a negative %s limit", plan.Slug, app.Slug, name)
+				}
+			}
+			for name, template := range plan.ConfigVars {
+				err := checkConfigVar(name, template)
+				if err != nil {
+					return fmt.Errorf("catalog: plan %q of app %q: %w", plan.Slug, app.Slug, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Look up an app by slug
+func (c *Catalog) App(slug string) (*App, error) {
+	known := []string{}
+	for i := range c.Apps {
+		if c.Apps[i].Slug == slug {
+			return &c.Apps[i], nil
+		}
+		known = append(known, c.Apps[i].Slug)
+	}
+	sort.Strings(known)
+	return nil, &UnknownAppError{Slug: slug, Known: known}
+}
+
+// Look up one of an app's plans by slug
+func (c *Catalog) Plan(appSlug string, planSlug string) (*Plan, error) {
+	app, err := c.App(appSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	known := []string{}
+	for i := range app.Plans {
+		if app.Plans[i].Slug == planSlug {
+			return &app.Plans[i], nil
+		}
+		known = append(known, app.Plans[i].Slug)
+	}
+	sort.Strings(known)
+	return nil, &UnknownPlanError{App: appSlug, Slug: planSlug, Known: known}
+}
+
+// A catalog file that can be reloaded while it is in use
+type File = jsonfile.File[Catalog]
+
+// Load the catalog at path
+func Open(path string) (*File, error) {
+	return jsonfile.Open(path, Load)
+}
@@ -0,0 +1,79 @@
+package catalog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"valid", `{"version": 1, "apps": [{"slug": "app", "plans": [{"slug": "basic", "name": "Basic", "limits": {"seats": 1}}]}]}`, ""},
+		{"missing version", `{"apps": [{"slug": "app", "plans": [{"slug": "basic", "name": "Basic"}]}]}`, "version must be at least 1"},
+		{"no apps", `{"version": 1, "apps": []}`, "no apps"},
+		{"app without slug", `{"version": 1, "apps": [{"plans": [{"slug": "basic", "name": "Basic"}]}]}`, "app with no slug"},
+		{"app listed twice", `{"version": 1, "apps": [
+			{"slug": "app", "plans": [{"slug": "basic", "name": "Basic"}]},
+			{"slug": "app", "plans": [{"slug": "basic", "name": "Basic"}]}
+		]}`, `app "app" is listed twice`},
+		{"app without plans", `{"version": 1, "apps": [{"slug": "app", "plans": []}]}`, `app "app" has no plans`},
+		{"plan without slug", `{"version": 1, "apps": [{"slug": "app", "plans": [{"name": "Basic"}]}]}`, "has a plan with no slug"},
+		{"plan listed twice", `{"version": 1, "apps": [{"slug": "app", "plans": [
+			{"slug": "basic", "name": "Basic"},
+			{"slug": "basic", "name": "Basic"}
+		]}]}`, `lists plan "basic" twice`},
+		{"plan without name", `{"version": 1, "apps": [{"slug": "app", "plans": [{"slug": "basic"}]}]}`, "has no name"},
+		{"negative price", `{"version": 1, "apps": [{"slug": "app", "plans": [{"slug": "basic", "name": "Basic", "price_cents": -1}]}]}`, "negative price"},
+		{"negative limit", `{"version": 1, "apps": [{"slug": "app", "plans": [{"slug": "basic", "name": "Basic", "limits": {"seats": -1}}]}]}`, "negative seats limit"},
+		{"unknown field", `{"version": 1, "aps": []}`, "unknown field"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Parse([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(): %v", err)
+			}
+			if c.Version != 1 {
+				t.Errorf("Version = %d, want 1", c.Version)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	c, err := Load("../../catalog.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := c.Plan("sample_app", "pro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Name != "Pro" {
+		t.Errorf("Name = %q, want Pro", plan.Name)
+	}
+
+	_, err = c.Plan("sample_app", "gold")
+	var unknownPlan *UnknownPlanError
+	if !errors.As(err, &unknownPlan) || strings.Join(unknownPlan.Known, ",") != "basic,pro" {
+		t.Errorf("Plan() of an unknown plan error = %v, want one listing basic and pro", err)
+	}
+
+	_, err = c.Plan("other_app", "basic")
+	var unknownApp *UnknownAppError
+	if !errors.As(err, &unknownApp) || unknownApp.Slug != "other_app" {
+		t.Errorf("Plan() of an unknown app error = %v, want an UnknownAppError", err)
+	}
+}
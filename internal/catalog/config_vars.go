@@ -0,0 +1,109 @@
+package catalog
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// How many random bytes each generated secret holds
+const secretBytes = 24
+
+var (
+	configVarName = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+	placeholder   = regexp.MustCompile(`\{\{\s*([a-z_]+)\s*\}\}`)
+)
+
+// Placeholders config var templates may use, and what they are replaced with
+var placeholders = map[string]bool{
+	// The resource's UUID
+	"resource_uuid": true,
+
+	// The slugs of the resource's app and plan
+	"app":  true,
+	"plan": true,
+
+	// The resource's current license key
+	"license_key": true,
+
+	// A new random secret, different for every use
+	"secret": true,
+}
+
+// What config var templates are filled in with
+type ConfigValues struct {
+	ResourceUUID string
+	AppSlug      string
+	PlanSlug     string
+	LicenseKey   string
+}
+
+// Fill in a config var template, e.g. "https://{{plan}}.example.com/{{resource_uuid}}".
+// Each {{secret}} is replaced with a new random, URL-safe secret.
+func RenderConfigVar(template string, values ConfigValues) (string, error) {
+	var err error
+	rendered := placeholder.ReplaceAllStringFunc(template, func(match string) string {
+		switch strings.TrimSpace(match[2 : len(match)-2]) {
+		case "resource_uuid":
+			return values.ResourceUUID
+		case "app":
+			return values.AppSlug
+		case "plan":
+			return values.PlanSlug
+		case "license_key":
+			return values.LicenseKey
+		case "secret":
+			secret := make([]byte, secretBytes)
+			_, readErr := rand.Read(secret)
+			if readErr != nil {
+				err = readErr
+			}
+			return base64.RawURLEncoding.EncodeToString(secret)
+		}
+		return match
+	})
+	if err != nil {
+		return "", err
+	}
+	return rendered, nil
+}
+
+// Whether rendering a template generates a secret. Such config vars keep
+// their value when the others are rendered again.
+func GeneratesSecret(template string) bool {
+	return usesPlaceholder(template, "secret")
+}
+
+// Whether a template includes the resource's license key
+func UsesLicenseKey(template string) bool {
+	return usesPlaceholder(template, "license_key")
+}
+
+func usesPlaceholder(template string, name string) bool {
+	for _, match := range placeholder.FindAllStringSubmatch(template, -1) {
+		if match[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether name is a valid config var name. DigitalOcean shows config vars as
+// environment variables, so names are upper case.
+func ValidConfigVarName(name string) bool {
+	return configVarName.MatchString(name)
+}
+
+func checkConfigVar(name string, template string) error {
+	if !ValidConfigVarName(name) {
+		return fmt.Errorf("config var %q must be upper case letters, digits and '_'", name)
+	}
+	for _, match := range placeholder.FindAllStringSubmatch(template, -1) {
+		if !placeholders[match[1]] {
+			return fmt.Errorf("config var %s uses unknown placeholder %q", name, match[0])
+		}
+	}
+	return nil
+}
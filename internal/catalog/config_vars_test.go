@@ -0,0 +1,111 @@
+package catalog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderConfigVar(t *testing.T) {
+	values := ConfigValues{
+		ResourceUUID: "uuid",
+		AppSlug:      "sample_app",
+		PlanSlug:     "pro",
+		LicenseKey:   "key",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"plain", "https://api.example.com", "https://api.example.com"},
+		{"every placeholder", "{{app}}/{{plan}}/{{resource_uuid}}/{{license_key}}", "sample_app/pro/uuid/key"},
+		{"spaces inside braces", "do-{{ resource_uuid }}", "do-uuid"},
+		{"unknown placeholder left alone", "{{colour}}", "{{colour}}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderConfigVar(tt.template, values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("RenderConfigVar(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderConfigVarSecrets(t *testing.T) {
+	rendered, err := RenderConfigVar("{{secret}}.{{secret}}", ConfigValues{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each use is a different secret
+	secrets := strings.Split(rendered, ".")
+	if len(secrets) != 2 || secrets[0] == secrets[1] {
+		t.Fatalf("rendered %q, want two different secrets", rendered)
+	}
+	if len(secrets[0]) != 32 || strings.ContainsAny(secrets[0], "+/=") {
+		t.Errorf("secret %q is not %d URL-safe bytes", secrets[0], secretBytes)
+	}
+}
+
+func TestUsesPlaceholder(t *testing.T) {
+	if !GeneratesSecret("prefix-{{ secret }}") || GeneratesSecret("{{license_key}}") {
+		t.Error("GeneratesSecret() does not match only {{secret}}")
+	}
+	if !UsesLicenseKey("{{license_key}}") || UsesLicenseKey("license_key") {
+		t.Error("UsesLicenseKey() does not match only {{license_key}}")
+	}
+}
+
+func TestCheckConfigVar(t *testing.T) {
+	tests := []struct {
+		name     string
+		varName  string
+		template string
+		wantErr  string
+	}{
+		{"valid", "API_URL_2", "https://{{plan}}.example.com", ""},
+		{"lower case name", "api_url", "x", "must be upper case"},
+		{"name starting with a digit", "2FA_SECRET", "{{secret}}", "must be upper case"},
+		{"unknown placeholder", "API_URL", "https://{{region}}.example.com", `unknown placeholder "{{region}}"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkConfigVar(tt.varName, tt.template)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkConfigVar(): %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkConfigVar() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseChecksConfigVars(t *testing.T) {
+	_, err := Parse([]byte(`{"version": 1, "apps": [{"slug": "app", "plans": [{"slug": "basic", "name": "Basic", "config_vars": {"key": "x"}}]}]}`))
+	if err == nil || !strings.Contains(err.Error(), `plan "basic" of app "app": config var "key"`) {
+		t.Errorf("Parse() error = %v, want one naming the plan and config var", err)
+	}
+}
+
+func TestConfigTemplates(t *testing.T) {
+	plan := &Plan{Slug: "basic"}
+	if templates := plan.ConfigTemplates(); templates["LICENSE_KEY"] != "{{license_key}}" || len(templates) != 1 {
+		t.Errorf("ConfigTemplates() of a plan without config vars = %v, want the defaults", templates)
+	}
+
+	plan.ConfigVars = map[string]string{"API_URL": "https://example.com"}
+	if templates := plan.ConfigTemplates(); len(templates) != 1 || templates["API_URL"] == "" {
+		t.Errorf("ConfigTemplates() = %v, want the plan's own", templates)
+	}
+}
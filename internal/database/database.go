@@ -14,9 +14,36 @@ type dbConfig struct {
 	dbHost     string
 	dbPort     string
 	dbName     string
+
+	// Apply pending migrations when opening the database
+	autoMigrate bool
 }
 
+// Connect to the database and bring its schema up to date
 func OpenDB() (*pgxpool.Pool, error) {
+	config := setupDB()
+	conn, err := Connect()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.autoMigrate {
+		applied, err := MigrateUp(context.Background(), conn, -1, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to migrate database: %v\n", err)
+			conn.Close()
+			return nil, err
+		}
+		for _, m := range applied {
+			fmt.Printf("Applied migration %d_%s\n", m.Version, m.Name)
+		}
+	}
+
+	return conn, nil
+}
+
+// Connect to the database without touching its schema
+func Connect() (*pgxpool.Pool, error) {
 	config := setupDB()
 	dataSourceName := "postgresql://" + config.dbUsername + ":" + config.dbPassword + "@" + config.dbHost + ":" + config.dbPort + "/" + config.dbName
 	conn, err := pgxpool.Connect(context.Background(), dataSourceName)
@@ -35,6 +62,8 @@ func setupDB() *dbConfig {
 		dbHost:     valueOrDefault("DB_HOST", "localhost"),
 		dbPort:     valueOrDefault("DB_PORT", "5431"),
 		dbName:     valueOrDefault("DB_NAME", "postgres"),
+
+		autoMigrate: valueOrDefault("DB_AUTO_MIGRATE", "true") == "true",
 	}
 	return config
 }
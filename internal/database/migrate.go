@@ -0,0 +1,268 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Every schema change lives in migrations/ as a numbered pair of files:
+// NNNN_description.up.sql and NNNN_description.down.sql. They are applied in
+// order and recorded in the schema_migrations table.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Arbitrary, but must stay the same so every instance contends on the same lock
+const migrationLockID = 8082_0001
+
+const (
+	CreateMigrationsTableSQL = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint NOT NULL,
+		name character varying NOT NULL,
+		applied_at timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL,
+		CONSTRAINT schema_migrations_pkey PRIMARY KEY (version)
+	);
+	`
+
+	GetAppliedMigrationsSQL = `
+	SELECT version, applied_at FROM schema_migrations ORDER BY version;
+	`
+
+	InsertMigrationSQL = `
+	INSERT INTO schema_migrations (version, name) VALUES ($1, $2);
+	`
+
+	DeleteMigrationSQL = `
+	DELETE FROM schema_migrations WHERE version=$1;
+	`
+)
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Read all embedded migrations, ordered by version
+func LoadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file name %q", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+
+		body, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d is missing its up or down file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Apply all pending migrations up to and including target. A negative target
+// applies everything. With dryRun set, nothing is changed and the migrations
+// that would have been applied are returned.
+func MigrateUp(ctx context.Context, pool *pgxpool.Pool, target int, dryRun bool) ([]Migration, error) {
+	var applied []Migration
+	err := withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		statuses, err := migrationStatus(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			if status.Applied || (target >= 0 && status.Version > target) {
+				continue
+			}
+			if !dryRun {
+				err = runMigration(ctx, conn, status.Migration, true)
+				if err != nil {
+					return err
+				}
+			}
+			applied = append(applied, status.Migration)
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Roll back the given number of most recently applied migrations. With dryRun
+// set, nothing is changed and the migrations that would have been rolled back
+// are returned.
+func MigrateDown(ctx context.Context, pool *pgxpool.Pool, steps int, dryRun bool) ([]Migration, error) {
+	var rolledBack []Migration
+	err := withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		statuses, err := migrationStatus(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(statuses) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			if !statuses[i].Applied {
+				continue
+			}
+			if !dryRun {
+				err = runMigration(ctx, conn, statuses[i].Migration, false)
+				if err != nil {
+					return err
+				}
+			}
+			rolledBack = append(rolledBack, statuses[i].Migration)
+		}
+		return nil
+	})
+
+	return rolledBack, err
+}
+
+// Report every known migration and whether it has been applied
+func MigrationStatuses(ctx context.Context, pool *pgxpool.Pool) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		var err error
+		statuses, err = migrationStatus(ctx, conn)
+		return err
+	})
+
+	return statuses, err
+}
+
+// Hold a session-level advisory lock while fn runs, so only one instance
+// migrates at a time. The lock lives on a single connection, which fn must use.
+func withMigrationLock(ctx context.Context, pool *pgxpool.Pool, fn func(*pgxpool.Conn) error) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID)
+	if err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	_, err = conn.Exec(ctx, CreateMigrationsTableSQL)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func migrationStatus(ctx context.Context, conn *pgxpool.Conn) ([]MigrationStatus, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, GetAppliedMigrationsSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appliedAt := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		err = rows.Scan(&version, &at)
+		if err != nil {
+			return nil, err
+		}
+		appliedAt[version] = at
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	statuses := []MigrationStatus{}
+	for _, m := range migrations {
+		at, applied := appliedAt[m.Version]
+		statuses = append(statuses, MigrationStatus{
+			Migration: m,
+			Applied:   applied,
+			AppliedAt: at,
+		})
+	}
+
+	return statuses, nil
+}
+
+// Run a single migration and record it, all in one transaction
+func runMigration(ctx context.Context, conn *pgxpool.Conn, m Migration, up bool) error {
+	return conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var err error
+		if up {
+			_, err = tx.Exec(ctx, m.Up)
+			if err == nil {
+				_, err = tx.Exec(ctx, InsertMigrationSQL, m.Version, m.Name)
+			}
+		} else {
+			_, err = tx.Exec(ctx, m.Down)
+			if err == nil {
+				_, err = tx.Exec(ctx, DeleteMigrationSQL, m.Version)
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		return nil
+	})
+}
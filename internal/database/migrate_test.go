@@ -0,0 +1,49 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	// Versions run 1, 2, 3, ... so a gap or a clash between branches shows up here
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d_%s is number %d, want version %d", m.Version, m.Name, i+1, i+1)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %d_%s has an empty up or down file", m.Version, m.Name)
+		}
+	}
+
+	if migrations[0].Name != "initial_schema" {
+		t.Errorf("first migration is %q, want initial_schema", migrations[0].Name)
+	}
+}
+
+func TestMigrationFileName(t *testing.T) {
+	tests := []struct {
+		name  string
+		match bool
+	}{
+		{"0001_initial_schema.up.sql", true},
+		{"0012_license_keys.down.sql", true},
+		{"0001_initial_schema.sql", false},
+		{"initial_schema.up.sql", false},
+		{"0001_initial-schema.up.sql", false},
+	}
+
+	for _, tt := range tests {
+		if got := migrationFileName.MatchString(tt.name); got != tt.match {
+			t.Errorf("%s matches = %v, want %v", tt.name, got, tt.match)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS tokens;
+DROP SEQUENCE IF EXISTS tokens_id_seq;
+
+DROP TABLE IF EXISTS activities;
+DROP SEQUENCE IF EXISTS activities_id_seq;
+
+DROP TABLE IF EXISTS accounts;
+DROP SEQUENCE IF EXISTS accounts_id_seq;
+
+DROP FUNCTION IF EXISTS update_modified_column();
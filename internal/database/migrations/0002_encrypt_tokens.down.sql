@@ -0,0 +1,7 @@
+-- Any encrypted tokens become unreadable once their key_id is gone, so
+-- delete them rather than leave garbage behind.
+DELETE FROM tokens WHERE key_id IS NOT NULL;
+
+ALTER TABLE tokens
+    DROP COLUMN key_id,
+    DROP COLUMN data_key;
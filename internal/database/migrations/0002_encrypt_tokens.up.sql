@@ -0,0 +1,5 @@
+-- Tokens may now be stored encrypted. Rows without a key_id are plaintext
+-- and are encrypted by running `main reencrypt-tokens`.
+ALTER TABLE tokens
+    ADD COLUMN key_id character varying,
+    ADD COLUMN data_key bytea;
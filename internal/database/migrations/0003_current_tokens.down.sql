@@ -0,0 +1,11 @@
+-- Token history is discarded; only current tokens survive the rollback.
+ALTER TABLE tokens DROP CONSTRAINT tokens_pkey;
+
+CREATE SEQUENCE tokens_id_seq INCREMENT 1 MINVALUE 1 MAXVALUE 32767 CACHE 1;
+ALTER TABLE tokens ADD COLUMN id smallint DEFAULT nextval('tokens_id_seq') NOT NULL;
+ALTER TABLE tokens ADD CONSTRAINT tokens_pkey PRIMARY KEY (id);
+CREATE INDEX tokens_resource_uuid ON tokens USING btree (resource_uuid);
+
+ALTER TABLE tokens DROP COLUMN issued_at;
+
+DROP TABLE token_history;
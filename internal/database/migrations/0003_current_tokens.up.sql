@@ -0,0 +1,43 @@
+-- Each resource now has exactly one current token, keyed by resource_uuid.
+-- Tokens it replaces are kept in token_history.
+CREATE TABLE token_history (
+    id bigserial NOT NULL,
+    resource_uuid character varying NOT NULL,
+    access_token character varying NOT NULL,
+    refresh_token character varying NOT NULL,
+    expires_at timestamptz NOT NULL,
+    issued_at timestamptz NOT NULL,
+    key_id character varying,
+    data_key bytea,
+    replaced_at timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT token_history_pkey PRIMARY KEY (id)
+);
+
+CREATE INDEX token_history_resource_uuid ON token_history USING btree (resource_uuid, issued_at DESC);
+
+-- We never recorded when old tokens were issued, so approximate it by
+-- assuming they lived DigitalOcean's usual 8 hours.
+ALTER TABLE tokens ADD COLUMN issued_at timestamptz;
+UPDATE tokens SET issued_at = expires_at - interval '8 hours';
+
+-- Every row but the newest for each resource becomes history
+CREATE TEMPORARY TABLE current_token_ids ON COMMIT DROP AS
+    SELECT DISTINCT ON (resource_uuid) id FROM tokens ORDER BY resource_uuid, id DESC;
+
+INSERT INTO token_history (resource_uuid, access_token, refresh_token, expires_at, issued_at, key_id, data_key)
+    SELECT resource_uuid, access_token, refresh_token, expires_at, issued_at, key_id, data_key
+    FROM tokens WHERE id NOT IN (SELECT id FROM current_token_ids)
+    ORDER BY id;
+
+DELETE FROM tokens WHERE id NOT IN (SELECT id FROM current_token_ids);
+
+-- The smallint id would eventually overflow, and resource_uuid is now unique anyway
+ALTER TABLE tokens DROP CONSTRAINT tokens_pkey;
+ALTER TABLE tokens DROP COLUMN id;
+DROP SEQUENCE IF EXISTS tokens_id_seq;
+DROP INDEX IF EXISTS tokens_resource_uuid;
+ALTER TABLE tokens ADD CONSTRAINT tokens_pkey PRIMARY KEY (resource_uuid);
+
+ALTER TABLE tokens
+    ALTER COLUMN issued_at SET DEFAULT CURRENT_TIMESTAMP,
+    ALTER COLUMN issued_at SET NOT NULL;
@@ -0,0 +1,5 @@
+-- When DigitalOcean last changed each resource, as of the last
+-- resources.updated notification applied to it. Older notifications that
+-- arrive late are ignored.
+ALTER TABLE accounts
+    ADD COLUMN remote_updated_at timestamptz;
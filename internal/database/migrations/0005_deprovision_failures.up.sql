@@ -0,0 +1,15 @@
+-- Resources DigitalOcean reported a failed deprovisioning for, along with the
+-- retries of our own deprovisioning and how each failure was resolved.
+CREATE TABLE IF NOT EXISTS deprovision_failures (
+    resource_uuid character varying PRIMARY KEY,
+    status character varying NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error character varying NOT NULL DEFAULT '',
+    next_attempt_at timestamptz NOT NULL,
+    reported_at timestamptz NOT NULL DEFAULT now(),
+    resolved_at timestamptz,
+    resolution character varying NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS deprovision_failures_due_idx
+    ON deprovision_failures (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,19 @@
+-- Outbox of config vars to send to DigitalOcean. Rows are written in the same
+-- transaction as the change they carry and delivered in the background.
+CREATE TABLE IF NOT EXISTS config_pushes (
+    id bigserial PRIMARY KEY,
+    resource_uuid character varying NOT NULL,
+    config jsonb NOT NULL,
+    status character varying NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error character varying NOT NULL DEFAULT '',
+    next_attempt_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    delivered_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS config_pushes_resource_uuid_idx
+    ON config_pushes (resource_uuid, id);
+
+CREATE INDEX IF NOT EXISTS config_pushes_due_idx
+    ON config_pushes (next_attempt_at) WHERE status = 'pending';
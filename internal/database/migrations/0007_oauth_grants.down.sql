@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS oauth_grants;
+
+ALTER TABLE accounts
+    DROP COLUMN IF EXISTS oauth_state;
@@ -0,0 +1,22 @@
+-- Authorization codes are now exchanged for tokens in the background, and
+-- each account records how that went.
+ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS oauth_state character varying NOT NULL DEFAULT 'pending';
+
+-- Accounts from before this migration either got their tokens or never will
+UPDATE accounts SET oauth_state = CASE
+    WHEN EXISTS (SELECT 1 FROM tokens WHERE tokens.resource_uuid = accounts.resource_uuid) THEN 'active'
+    ELSE 'failed'
+END;
+
+CREATE TABLE IF NOT EXISTS oauth_grants (
+    resource_uuid character varying PRIMARY KEY,
+    code character varying NOT NULL,
+    expires_at timestamptz NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error character varying NOT NULL DEFAULT '',
+    next_attempt_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    key_id character varying,
+    data_key bytea
+);
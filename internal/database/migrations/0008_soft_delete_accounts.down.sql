@@ -0,0 +1,7 @@
+-- Accounts that were only marked deprovisioned would otherwise come back to life
+DELETE FROM accounts WHERE deprovisioned_at IS NOT NULL;
+
+DROP INDEX IF EXISTS accounts_deprovisioned_at;
+
+ALTER TABLE accounts
+    DROP COLUMN deprovisioned_at;
@@ -0,0 +1,7 @@
+-- Deprovisioned accounts are kept until the retention period runs out, then
+-- purged along with everything else recorded for the resource.
+ALTER TABLE accounts
+    ADD COLUMN deprovisioned_at timestamptz;
+
+CREATE INDEX IF NOT EXISTS accounts_deprovisioned_at ON accounts (deprovisioned_at)
+    WHERE deprovisioned_at IS NOT NULL;
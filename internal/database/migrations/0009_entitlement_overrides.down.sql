@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS accounts_license_key;
+
+DROP TABLE IF EXISTS entitlement_overrides;
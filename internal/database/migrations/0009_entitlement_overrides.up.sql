@@ -0,0 +1,14 @@
+-- Per-account changes to the features and limits an account's plan gives it
+CREATE TABLE IF NOT EXISTS entitlement_overrides (
+    resource_uuid character varying NOT NULL,
+    kind character varying NOT NULL,
+    name character varying NOT NULL,
+    enabled boolean NOT NULL DEFAULT false,
+    "limit" bigint NOT NULL DEFAULT 0,
+    reason character varying NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT entitlement_overrides_pkey PRIMARY KEY (resource_uuid, kind, name)
+);
+
+-- Entitlements can be looked up by license key
+CREATE INDEX IF NOT EXISTS accounts_license_key ON accounts (license_key);
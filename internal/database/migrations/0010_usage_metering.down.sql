@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS usage_rollups;
+
+DROP TABLE IF EXISTS usage_event_keys;
+
+-- Drops every monthly partition along with it
+DROP TABLE IF EXISTS usage_events;
@@ -0,0 +1,32 @@
+-- Usage reported by our product services. Events are partitioned by month;
+-- the partition for a month is created when its first event arrives.
+CREATE TABLE IF NOT EXISTS usage_events (
+    resource_uuid character varying NOT NULL,
+    meter character varying NOT NULL,
+    quantity double precision NOT NULL,
+    occurred_at timestamptz NOT NULL,
+    idempotency_key character varying NOT NULL,
+    received_at timestamptz NOT NULL DEFAULT now()
+) PARTITION BY RANGE (occurred_at);
+
+CREATE INDEX IF NOT EXISTS usage_events_resource_idx ON usage_events (resource_uuid, occurred_at);
+
+-- Unique indexes on usage_events would have to include occurred_at, so
+-- idempotency keys are tracked on their own
+CREATE TABLE IF NOT EXISTS usage_event_keys (
+    resource_uuid character varying NOT NULL,
+    idempotency_key character varying NOT NULL,
+    received_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT usage_event_keys_pkey PRIMARY KEY (resource_uuid, idempotency_key)
+);
+
+-- Hourly and daily totals, kept up to date as events are recorded
+CREATE TABLE IF NOT EXISTS usage_rollups (
+    resource_uuid character varying NOT NULL,
+    meter character varying NOT NULL,
+    granularity character varying NOT NULL,
+    period_start timestamptz NOT NULL,
+    quantity double precision NOT NULL,
+    event_count bigint NOT NULL,
+    CONSTRAINT usage_rollups_pkey PRIMARY KEY (resource_uuid, granularity, period_start, meter)
+);
@@ -0,0 +1,15 @@
+-- Audit log of lookups made through the public license verification endpoint
+CREATE TABLE IF NOT EXISTS license_verifications (
+    id bigserial PRIMARY KEY,
+    key_hash character varying NOT NULL,
+    resource_uuid character varying NOT NULL DEFAULT '',
+    result character varying NOT NULL,
+    remote_ip character varying NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS license_verifications_resource_uuid_idx
+    ON license_verifications (resource_uuid, id);
+
+CREATE INDEX IF NOT EXISTS license_verifications_created_at_idx
+    ON license_verifications (created_at);
@@ -0,0 +1,24 @@
+-- Every license key issued to each resource, so replaced keys can keep
+-- working for a grace period. Keys are stored by hash.
+CREATE TABLE IF NOT EXISTS license_keys (
+    id bigserial PRIMARY KEY,
+    resource_uuid character varying NOT NULL,
+    key_hash character varying NOT NULL,
+    key_hint character varying NOT NULL,
+    issued_at timestamptz NOT NULL DEFAULT now(),
+    replaced_at timestamptz,
+    expires_at timestamptz,
+    revoked_at timestamptz,
+    last_used_at timestamptz,
+    CONSTRAINT license_keys_key_hash_key UNIQUE (key_hash)
+);
+
+CREATE INDEX IF NOT EXISTS license_keys_resource_uuid_idx
+    ON license_keys (resource_uuid, id);
+
+-- Start each live account's history with the key it holds now
+INSERT INTO license_keys (resource_uuid, key_hash, key_hint, issued_at)
+SELECT resource_uuid, encode(sha256(convert_to(license_key, 'UTF8')), 'hex'), right(license_key, 6), modified_at
+FROM accounts
+WHERE license_key <> '' AND deprovisioned_at IS NULL
+ON CONFLICT (key_hash) DO NOTHING;
@@ -0,0 +1,15 @@
+-- The config vars each resource was given, rendered from its plan's templates
+CREATE TABLE IF NOT EXISTS config_vars (
+    resource_uuid character varying NOT NULL,
+    name character varying NOT NULL,
+    value character varying NOT NULL,
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT config_vars_pkey PRIMARY KEY (resource_uuid, name)
+);
+
+-- Until now every resource was given just its license key
+INSERT INTO config_vars (resource_uuid, name, value)
+SELECT resource_uuid, 'LICENSE_KEY', license_key
+FROM accounts
+WHERE license_key <> '' AND deprovisioned_at IS NULL
+ON CONFLICT (resource_uuid, name) DO NOTHING;
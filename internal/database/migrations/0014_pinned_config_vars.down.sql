@@ -0,0 +1 @@
+ALTER TABLE config_vars DROP COLUMN IF EXISTS pinned;
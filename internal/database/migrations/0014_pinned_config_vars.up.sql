@@ -0,0 +1,2 @@
+-- Config vars set by hand, which keep their value when the rest are rendered again
+ALTER TABLE config_vars ADD COLUMN IF NOT EXISTS pinned boolean NOT NULL DEFAULT false;
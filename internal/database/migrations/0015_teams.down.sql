@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS accounts_team_id;
+
+ALTER TABLE accounts
+    DROP COLUMN team_id;
+
+DROP TABLE IF EXISTS teams;
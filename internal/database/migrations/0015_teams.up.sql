@@ -0,0 +1,15 @@
+-- The DigitalOcean teams that provisioned our resources, keyed by the
+-- creator_id sent with each provisioning request
+CREATE TABLE IF NOT EXISTS teams (
+    id character varying NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT teams_pkey PRIMARY KEY (id)
+);
+
+-- Left empty for existing accounts, since their creator_id was never kept.
+-- They are linked to their team the next time they are provisioned.
+ALTER TABLE accounts
+    ADD COLUMN team_id character varying REFERENCES teams (id);
+
+CREATE INDEX IF NOT EXISTS accounts_team_id ON accounts (team_id)
+    WHERE team_id IS NOT NULL;
@@ -0,0 +1,25 @@
+-- Codes the SSO redirect carries, each exchanged once for a session
+CREATE TABLE IF NOT EXISTS sso_codes (
+    code_hash character varying NOT NULL,
+    resource_uuid character varying NOT NULL,
+    team_id character varying,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    CONSTRAINT sso_codes_pkey PRIMARY KEY (code_hash)
+);
+
+CREATE INDEX IF NOT EXISTS sso_codes_expires_at ON sso_codes (expires_at);
+
+-- Front-end sessions, identified by the hash of their cookie
+CREATE TABLE IF NOT EXISTS sessions (
+    token_hash character varying NOT NULL,
+    resource_uuid character varying NOT NULL,
+    team_id character varying,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    last_seen_at timestamptz NOT NULL DEFAULT now(),
+    expires_at timestamptz NOT NULL,
+    revoked_at timestamptz,
+    CONSTRAINT sessions_pkey PRIMARY KEY (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS sessions_resource_uuid ON sessions (resource_uuid);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS license_keys_expiring_idx;
@@ -0,0 +1,3 @@
+-- Current keys that expire, looked up to renew them before they do
+CREATE INDEX IF NOT EXISTS license_keys_expiring_idx
+    ON license_keys (expires_at) WHERE replaced_at IS NULL AND revoked_at IS NULL;
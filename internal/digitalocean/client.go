@@ -0,0 +1,207 @@
+package digitalocean
+
+/**
+ * A small client for the parts of the DigitalOcean API that an Add-on calls.
+ * Point it at a different base URL to talk to a local stand-in instead.
+ */
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const DefaultBaseURL = "https://api.digitalocean.com"
+
+type Client struct {
+	baseURL      string
+	clientSecret string
+	httpClient   *http.Client
+}
+
+type Token struct {
+	// Used to access the DigitalOcean API scoped to a single resource. Normally expires
+	// every 8 hours, but may expire early in certain circumstances.
+	AccessToken string `json:"access_token"`
+
+	// Valid for the lifetime of the resource and can be exchanged for a new access_token
+	// as many times as needed using a valid OAuth client_secret.
+	RefreshToken string `json:"refresh_token"`
+
+	// The number of seconds the access_token is valid for. The refresh_token is used to
+	// acquire a new access_token.
+	ExpiresIn int64 `json:"expires_in"`
+
+	// Time this token will expire, worked out from ExpiresIn when the token is received
+	ExpiresAt time.Time `json:"-"`
+
+	// The token type is used in the Authorization header of requests to the DigitalOcean API
+	TokenType string `json:"token_type"`
+}
+
+type AuthCodeRequest struct {
+	// The authorization code provided during the provisioning request
+	Code string `json:"code"`
+
+	// Type of code
+	GrantType string `json:"grant_type"`
+
+	// The preshared secret that is associated with your Add-On
+	Secret string `json:"client_secret"`
+}
+
+type RefreshRequest struct {
+	// Type of code
+	GrantType string `json:"grant_type"`
+
+	// The authorization code provided during the provisioning request
+	RefreshToken string `json:"refresh_token"`
+
+	// The preshared secret that is associated with your Add-On
+	ClientSecret string `json:"client_secret"`
+}
+
+type ConfigUpdateRequest struct {
+	// The full set of config vars for the resource. They replace whatever
+	// DigitalOcean had before.
+	Config map[string]string `json:"config"`
+}
+
+// Returned whenever DigitalOcean responds with an error status
+type Error struct {
+	// HTTP status code of the response
+	StatusCode int `json:"-"`
+
+	// Short machine-readable error name, e.g. "unauthorized"
+	ID string `json:"id"`
+
+	// Human-readable description of the error
+	Message string `json:"message"`
+
+	// Quote this when contacting DigitalOcean support
+	RequestID string `json:"request_id"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("digitalocean: %d", e.StatusCode)
+	if e.ID != "" {
+		msg += " " + e.ID
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// Create a client for the API at baseURL, authenticating token requests with
+// clientSecret. If httpClient is nil, http.DefaultClient is used.
+func NewClient(baseURL string, clientSecret string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		clientSecret: clientSecret,
+		httpClient:   httpClient,
+	}
+}
+
+// Exchange the authorization code sent with a provisioning request for an
+// access token and refresh token
+func (c *Client) ExchangeAuthCode(ctx context.Context, code string) (*Token, error) {
+	req := AuthCodeRequest{
+		Code:      code,
+		GrantType: "authorization_code",
+		Secret:    c.clientSecret,
+	}
+
+	return c.tokenRequest(ctx, req)
+}
+
+// Trade a refresh token for a new access token and refresh token
+func (c *Client) RefreshToken(ctx context.Context, refreshToken string) (*Token, error) {
+	req := RefreshRequest{
+		GrantType:    "refresh_token",
+		RefreshToken: refreshToken,
+		ClientSecret: c.clientSecret,
+	}
+
+	return c.tokenRequest(ctx, req)
+}
+
+// Replace the config vars DigitalOcean shows the user for a resource
+func (c *Client) UpdateConfig(ctx context.Context, accessToken string, resourceUUID string, config map[string]string) error {
+	path := "/v2/add-ons/resources/" + url.PathEscape(resourceUUID) + "/config"
+	req := ConfigUpdateRequest{
+		Config: config,
+	}
+
+	return c.do(ctx, http.MethodPatch, path, accessToken, req, nil)
+}
+
+// Used for both initial auth code trade-in and for token refreshes
+func (c *Client) tokenRequest(ctx context.Context, body interface{}) (*Token, error) {
+	token := &Token{}
+	err := c.do(ctx, http.MethodPost, "/v2/add-ons/oauth/token", "", body, token)
+	if err != nil {
+		return nil, err
+	}
+
+	token.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return token, nil
+}
+
+// Send body as JSON to path, and decode a successful response into out if it is
+// not nil. accessToken is sent as a bearer token when set.
+func (c *Client) do(ctx context.Context, method string, path string, accessToken string, body interface{}, out interface{}) error {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(jsonBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode >= 400 {
+		apiErr := &Error{}
+		// The body is not always JSON, so fall back to using it as the message
+		if json.Unmarshal(resBody, apiErr) != nil {
+			apiErr.Message = strings.TrimSpace(string(resBody))
+		}
+		apiErr.StatusCode = res.StatusCode
+		return apiErr
+	}
+
+	if out == nil || len(resBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resBody, out)
+}
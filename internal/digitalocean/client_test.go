@@ -0,0 +1,118 @@
+package digitalocean
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A request as the test server received it
+type received struct {
+	method        string
+	path          string
+	authorization string
+	body          map[string]interface{}
+}
+
+// Serve every request with the given status and body, recording what was sent
+func testClient(t *testing.T, status int, body string) (*Client, *received) {
+	t.Helper()
+	got := &received{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.method = r.Method
+		got.path = r.URL.EscapedPath()
+		got.authorization = r.Header.Get("Authorization")
+		reqBody, _ := io.ReadAll(r.Body)
+		json.Unmarshal(reqBody, &got.body)
+
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewClient(server.URL+"/", "secret", nil), got
+}
+
+func TestExchangeAuthCode(t *testing.T) {
+	client, got := testClient(t, http.StatusOK, `{"access_token": "access", "refresh_token": "refresh", "expires_in": 3600, "token_type": "bearer"}`)
+
+	token, err := client.ExchangeAuthCode(context.Background(), "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.method != http.MethodPost || got.path != "/v2/add-ons/oauth/token" || got.authorization != "" {
+		t.Errorf("sent %s %s with Authorization %q", got.method, got.path, got.authorization)
+	}
+	want := map[string]interface{}{"code": "code", "grant_type": "authorization_code", "client_secret": "secret"}
+	if !reflect.DeepEqual(got.body, want) {
+		t.Errorf("sent %v, want %v", got.body, want)
+	}
+	if token.AccessToken != "access" || token.RefreshToken != "refresh" {
+		t.Errorf("token %+v, want the one returned", token)
+	}
+	if expiresIn := time.Until(token.ExpiresAt); expiresIn < 59*time.Minute || expiresIn > time.Hour {
+		t.Errorf("token expires in %v, want an hour", expiresIn)
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	client, got := testClient(t, http.StatusOK, `{"access_token": "access", "refresh_token": "refresh", "expires_in": 60}`)
+
+	_, err := client.RefreshToken(context.Background(), "old-refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"grant_type": "refresh_token", "refresh_token": "old-refresh", "client_secret": "secret"}
+	if !reflect.DeepEqual(got.body, want) {
+		t.Errorf("sent %v, want %v", got.body, want)
+	}
+}
+
+func TestUpdateConfig(t *testing.T) {
+	client, got := testClient(t, http.StatusOK, "")
+
+	err := client.UpdateConfig(context.Background(), "access", "a/b", map[string]string{"API_URL": "https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.method != http.MethodPatch || got.path != "/v2/add-ons/resources/a%2Fb/config" || got.authorization != "Bearer access" {
+		t.Errorf("sent %s %s with Authorization %q", got.method, got.path, got.authorization)
+	}
+	want := map[string]interface{}{"config": map[string]interface{}{"API_URL": "https://example.com"}}
+	if !reflect.DeepEqual(got.body, want) {
+		t.Errorf("sent %v, want %v", got.body, want)
+	}
+}
+
+func TestError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"JSON", http.StatusUnauthorized, `{"id": "unauthorized", "message": "bad token", "request_id": "req-1"}`, "digitalocean: 401 unauthorized: bad token (request req-1)"},
+		{"plain text", http.StatusBadGateway, "upstream down\n", "digitalocean: 502: upstream down"},
+		{"empty", http.StatusServiceUnavailable, "", "digitalocean: 503"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := testClient(t, tt.status, tt.body)
+
+			_, err := client.ExchangeAuthCode(context.Background(), "code")
+			apiErr, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("ExchangeAuthCode() error = %v, want an *Error", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Error() != tt.want {
+				t.Errorf("error %q with status %d, want %q", apiErr.Error(), apiErr.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package dosim
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// A stand-in for the parts of the DigitalOcean API an Add-on calls. Run the
+// add-on with DIGITALOCEAN_API_URL pointing here.
+type API struct {
+	e *echo.Echo
+
+	clientSecret string
+	tokenTTL     time.Duration
+
+	mu sync.Mutex
+	// Authorization codes that have already been exchanged
+	usedCodes map[string]bool
+	// Keyed by access token
+	accessTokens map[string]issuedToken
+	// Keyed by refresh token, valued by resource UUID. Refresh tokens are
+	// rotated on every use, like DigitalOcean does.
+	refreshTokens map[string]string
+	// Last config pushed for each resource UUID
+	configs map[string]map[string]string
+	// How many more config pushes to fail, to simulate an outage
+	failConfigUpdates int
+}
+
+type issuedToken struct {
+	resourceUUID string
+	expiresAt    time.Time
+}
+
+type apiError struct {
+	ID        string `json:"id"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+}
+
+type tokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	Code         string `json:"code"`
+	RefreshToken string `json:"refresh_token"`
+	ClientSecret string `json:"client_secret"`
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+}
+
+type configRequest struct {
+	Config map[string]string `json:"config"`
+}
+
+// Create a fake API that expects clientSecret on token requests and issues
+// access tokens valid for tokenTTL
+func NewAPI(clientSecret string, tokenTTL time.Duration) *API {
+	a := &API{
+		e:             echo.New(),
+		clientSecret:  clientSecret,
+		tokenTTL:      tokenTTL,
+		usedCodes:     map[string]bool{},
+		accessTokens:  map[string]issuedToken{},
+		refreshTokens: map[string]string{},
+		configs:       map[string]map[string]string{},
+	}
+	a.e.HideBanner = true
+
+	a.e.POST("/v2/add-ons/oauth/token", a.tokenHandler)
+	a.e.PATCH("/v2/add-ons/resources/:uuid/config", a.updateConfigHandler)
+	a.e.GET("/v2/add-ons/resources/:uuid/config", a.getConfigHandler)
+
+	return a
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.e.ServeHTTP(w, r)
+}
+
+// Listen on addr until the process exits
+func (a *API) Start(addr string) error {
+	return a.e.Start(addr)
+}
+
+// The config most recently pushed for a resource, or nil if none has been
+func (a *API) Config(resourceUUID string) map[string]string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.configs[resourceUUID]
+}
+
+// Token exchange and refresh. Any well-formed authorization code is accepted
+// once, since the simulator that handed it out may be a different process.
+func (a *API) tokenHandler(c echo.Context) error {
+	req := &tokenRequest{}
+	err := c.Bind(req)
+	if err != nil {
+		return fail(c, http.StatusBadRequest, "bad_request", err.Error())
+	}
+	if req.ClientSecret != a.clientSecret {
+		return fail(c, http.StatusUnauthorized, "unauthorized", "invalid client_secret")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	resourceUUID := ""
+	switch req.GrantType {
+	case "authorization_code":
+		resourceUUID = codeResource(req.Code)
+		if resourceUUID == "" || a.usedCodes[req.Code] {
+			return fail(c, http.StatusBadRequest, "invalid_grant", "authorization code is invalid or already used")
+		}
+		a.usedCodes[req.Code] = true
+	case "refresh_token":
+		var ok bool
+		resourceUUID, ok = a.refreshTokens[req.RefreshToken]
+		if !ok {
+			return fail(c, http.StatusBadRequest, "invalid_grant", "refresh token is invalid or already used")
+		}
+		delete(a.refreshTokens, req.RefreshToken)
+	default:
+		return fail(c, http.StatusBadRequest, "unsupported_grant_type", "unsupported grant_type "+req.GrantType)
+	}
+
+	resp := &tokenResponse{
+		AccessToken:  "sim-access-" + uuid.New().String(),
+		RefreshToken: "sim-refresh-" + uuid.New().String(),
+		ExpiresIn:    int64(a.tokenTTL.Seconds()),
+		TokenType:    "bearer",
+	}
+	a.accessTokens[resp.AccessToken] = issuedToken{
+		resourceUUID: resourceUUID,
+		expiresAt:    time.Now().Add(a.tokenTTL),
+	}
+	a.refreshTokens[resp.RefreshToken] = resourceUUID
+
+	c.Logger().Infof("issued %s token for %q", req.GrantType, resourceUUID)
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (a *API) updateConfigHandler(c echo.Context) error {
+	resourceUUID := c.Param("uuid")
+	if !a.authorized(c, resourceUUID) {
+		return fail(c, http.StatusUnauthorized, "unauthorized", "invalid or expired access token")
+	}
+
+	req := &configRequest{}
+	err := c.Bind(req)
+	if err != nil {
+		return fail(c, http.StatusBadRequest, "bad_request", err.Error())
+	}
+
+	a.mu.Lock()
+	if a.failConfigUpdates > 0 {
+		a.failConfigUpdates--
+		a.mu.Unlock()
+		return fail(c, http.StatusServiceUnavailable, "service_unavailable", "simulated outage")
+	}
+	a.configs[resourceUUID] = req.Config
+	a.mu.Unlock()
+
+	c.Logger().Infof("config for %s is now %v", resourceUUID, req.Config)
+	return c.NoContent(http.StatusOK)
+}
+
+// Answer the next n config pushes with a 503, as if DigitalOcean were down
+func (a *API) FailConfigUpdates(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failConfigUpdates = n
+}
+
+func (a *API) getConfigHandler(c echo.Context) error {
+	resourceUUID := c.Param("uuid")
+	config := a.Config(resourceUUID)
+	if config == nil {
+		return fail(c, http.StatusNotFound, "not_found", "no config has been pushed for "+resourceUUID)
+	}
+
+	return c.JSON(http.StatusOK, &configRequest{Config: config})
+}
+
+// Check the request carries a live access token for the resource
+func (a *API) authorized(c echo.Context, resourceUUID string) bool {
+	accessToken := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	issued, ok := a.accessTokens[accessToken]
+	return ok && issued.resourceUUID == resourceUUID && issued.expiresAt.After(time.Now())
+}
+
+// Authorization codes handed out by the simulator carry the resource they were
+// issued for, so the API can scope tokens without sharing state with it
+func newCode(resourceUUID string) string {
+	return resourceUUID + "." + uuid.New().String()
+}
+
+func codeResource(code string) string {
+	i := strings.LastIndex(code, ".")
+	if i <= 0 {
+		return ""
+	}
+	return code[:i]
+}
+
+func fail(c echo.Context, status int, id string, message string) error {
+	return c.JSON(status, &apiError{
+		ID:        id,
+		Message:   message,
+		RequestID: uuid.New().String(),
+	})
+}
@@ -0,0 +1,101 @@
+package dosim
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sample_app/internal/digitalocean"
+	"testing"
+	"time"
+)
+
+// Serve a fake API and return it with its URL
+func testAPI(t *testing.T, tokenTTL time.Duration) (*API, string) {
+	t.Helper()
+	api := NewAPI("sim", tokenTTL)
+	api.e.Logger.SetOutput(io.Discard)
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	return api, server.URL
+}
+
+func expectAPIError(t *testing.T, step string, err error, status int) {
+	t.Helper()
+	apiErr, ok := err.(*digitalocean.Error)
+	if !ok || apiErr.StatusCode != status {
+		t.Errorf("%s: error %v, want status %d", step, err, status)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	_, url := testAPI(t, time.Hour)
+	client := digitalocean.NewClient(url, "sim", nil)
+	ctx := context.Background()
+	code := newCode("resource-uuid")
+
+	token, err := client.ExchangeAuthCode(ctx, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken == "" || token.RefreshToken == "" || token.ExpiresIn != 3600 {
+		t.Errorf("token %+v, want both tokens valid for an hour", token)
+	}
+
+	_, err = client.ExchangeAuthCode(ctx, code)
+	expectAPIError(t, "reused code", err, http.StatusBadRequest)
+	_, err = client.ExchangeAuthCode(ctx, "no-resource")
+	expectAPIError(t, "malformed code", err, http.StatusBadRequest)
+	_, err = digitalocean.NewClient(url, "wrong", nil).ExchangeAuthCode(ctx, newCode("resource-uuid"))
+	expectAPIError(t, "wrong client secret", err, http.StatusUnauthorized)
+
+	// Refresh tokens are single use too
+	refreshed, err := client.RefreshToken(ctx, token.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.RefreshToken == token.RefreshToken {
+		t.Error("refresh returned the same refresh token")
+	}
+	_, err = client.RefreshToken(ctx, token.RefreshToken)
+	expectAPIError(t, "reused refresh token", err, http.StatusBadRequest)
+}
+
+func TestAPIConfig(t *testing.T) {
+	api, url := testAPI(t, time.Hour)
+	client := digitalocean.NewClient(url, "sim", nil)
+	ctx := context.Background()
+	config := map[string]string{"API_URL": "https://example.com"}
+
+	token, err := client.ExchangeAuthCode(ctx, newCode("resource-uuid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.UpdateConfig(ctx, token.AccessToken, "other-uuid", config)
+	expectAPIError(t, "token for another resource", err, http.StatusUnauthorized)
+
+	api.FailConfigUpdates(1)
+	err = client.UpdateConfig(ctx, token.AccessToken, "resource-uuid", config)
+	expectAPIError(t, "simulated outage", err, http.StatusServiceUnavailable)
+	if api.Config("resource-uuid") != nil {
+		t.Error("config stored during an outage")
+	}
+
+	err = client.UpdateConfig(ctx, token.AccessToken, "resource-uuid", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := api.Config("resource-uuid")["API_URL"]; got != "https://example.com" {
+		t.Errorf("stored API_URL %q, want the one pushed", got)
+	}
+
+	// Expired access tokens are refused
+	_, url = testAPI(t, -time.Second)
+	client = digitalocean.NewClient(url, "sim", nil)
+	token, err = client.ExchangeAuthCode(ctx, newCode("resource-uuid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.UpdateConfig(ctx, token.AccessToken, "resource-uuid", config)
+	expectAPIError(t, "expired token", err, http.StatusUnauthorized)
+}
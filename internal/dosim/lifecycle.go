@@ -0,0 +1,103 @@
+package dosim
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Ask the add-on to push fresh config to DigitalOcean, by rotating the
+// resource's license key. This is one of the add-on's own front-end endpoints
+// rather than something DigitalOcean calls, but it is the only way to
+// exercise the config PATCH end to end.
+func (s *Simulator) TriggerConfigUpdate(ctx context.Context, resourceUUID string) (*Response, error) {
+	body := map[string]interface{}{"rotate": []string{"LICENSE_KEY"}}
+	return s.sendJSON(ctx, http.MethodPost, "/config/"+url.PathEscape(resourceUUID), body)
+}
+
+type step struct {
+	name string
+	run  func() (*Response, error)
+
+	// Status the add-on must respond with. Any success is fine when zero.
+	want int
+}
+
+// Walk a resource through everything DigitalOcean does over its lifetime:
+// provisioning, a plan change, every notification type, SSO and finally
+// deprovisioning. If api is not nil, it is checked to have received a config
+// push. Progress is written to out, and the first failed step is returned as
+// an error.
+func RunLifecycle(ctx context.Context, s *Simulator, api *API, r Resource, newPlanSlug string, out io.Writer) error {
+	changed := r
+	changed.PlanSlug = newPlanSlug
+
+	steps := []step{
+		{"provision", func() (*Response, error) {
+			return s.Provision(ctx, r)
+		}, 0},
+		{"plan change", func() (*Response, error) {
+			return s.ChangePlan(ctx, r.UUID, newPlanSlug)
+		}, 0},
+		{"resources.updated", func() (*Response, error) {
+			return s.NotifyUpdated(ctx, changed, "active", newPlanSlug)
+		}, 0},
+		{"sso", func() (*Response, error) {
+			return s.SSO(ctx, r.UUID, r.Email, "sim-user")
+		}, 0},
+		{"config update", func() (*Response, error) {
+			res, err := s.TriggerConfigUpdate(ctx, r.UUID)
+			if err != nil || !res.OK() || api == nil {
+				return res, err
+			}
+			if api.Config(r.UUID) == nil {
+				return res, fmt.Errorf("add-on accepted the config update but never pushed it to the API")
+			}
+			return res, nil
+		}, 0},
+		{"resources.suspended", func() (*Response, error) {
+			return s.NotifyResources(ctx, Suspended, []string{r.UUID})
+		}, 0},
+		{"sso while suspended", func() (*Response, error) {
+			return s.SSO(ctx, r.UUID, r.Email, "sim-user")
+		}, http.StatusForbidden},
+		{"resources.reactivated", func() (*Response, error) {
+			return s.NotifyResources(ctx, Reactivated, []string{r.UUID})
+		}, 0},
+		{"sso after reactivation", func() (*Response, error) {
+			return s.SSO(ctx, r.UUID, r.Email, "sim-user")
+		}, 0},
+		{"resources.deprovisioning.failed", func() (*Response, error) {
+			return s.NotifyResources(ctx, DeprovisioningFailed, []string{r.UUID})
+		}, 0},
+		{"deprovision", func() (*Response, error) {
+			return s.Deprovision(ctx, r.UUID)
+		}, 0},
+		{"deprovision again", func() (*Response, error) {
+			return s.Deprovision(ctx, r.UUID)
+		}, 0},
+		{"sso after deprovisioning", func() (*Response, error) {
+			return s.SSO(ctx, r.UUID, r.Email, "sim-user")
+		}, http.StatusNotFound},
+	}
+
+	for _, st := range steps {
+		fmt.Fprintf(out, "==> %s\n", st.name)
+		res, err := st.run()
+		if res != nil {
+			fmt.Fprintf(out, "    %s\n", res)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", st.name, err)
+		}
+		if st.want != 0 && res.StatusCode != st.want {
+			return fmt.Errorf("%s: add-on responded %d, expected %d", st.name, res.StatusCode, st.want)
+		} else if st.want == 0 && !res.OK() {
+			return fmt.Errorf("%s: add-on responded %d", st.name, res.StatusCode)
+		}
+	}
+
+	return nil
+}
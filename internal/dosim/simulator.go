@@ -0,0 +1,300 @@
+package dosim
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// These are the notification types DigitalOcean sends to an Add-on
+const (
+	Suspended            = "resources.suspended"
+	Reactivated          = "resources.reactivated"
+	DeprovisioningFailed = "resources.deprovisioning.failed"
+	Updated              = "resources.updated"
+)
+
+// Plays DigitalOcean's role against an Add-on, sending the same requests
+// DigitalOcean would over the lifetime of a resource
+type Simulator struct {
+	// Base URL of the add-on, e.g. http://localhost:8082
+	AddonURL string
+
+	// Credentials DigitalOcean uses for basic auth against the add-on
+	AppSlug     string
+	AppPassword string
+
+	// Shared secret used to sign SSO requests
+	AppSalt string
+
+	HTTPClient *http.Client
+}
+
+// What the add-on sent back
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+func (r *Response) String() string {
+	s := strconv.Itoa(r.StatusCode) + " " + http.StatusText(r.StatusCode)
+	if location := r.Header.Get("Location"); location != "" {
+		s += " -> " + location
+	}
+	if r.Body != "" {
+		s += " " + strings.TrimSpace(r.Body)
+	}
+	return s
+}
+
+// Whether the add-on accepted the request
+func (r *Response) OK() bool {
+	return r.StatusCode < 400
+}
+
+// Everything needed to provision a resource
+type Resource struct {
+	UUID     string
+	Name     string
+	AppSlug  string
+	PlanSlug string
+	Email    string
+	TeamID   string
+	Language string
+}
+
+type provisioningRequest struct {
+	Name       string               `json:"resource_name"`
+	AppSlug    string               `json:"app_slug"`
+	PlanSlug   string               `json:"plan_slug"`
+	UUID       string               `json:"uuid"`
+	Metadata   provisioningMetadata `json:"metadata"`
+	Email      string               `json:"email"`
+	TeamID     string               `json:"creator_id"`
+	OauthGrant oauthGrant           `json:"oauth_grant"`
+}
+
+type provisioningMetadata struct {
+	Language        string `json:"language"`
+	EmailPreference bool   `json:"email_preference"`
+}
+
+type oauthGrant struct {
+	CodeType  string `json:"type"`
+	Code      string `json:"code"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type planChangeRequest struct {
+	PlanSlug string `json:"plan_slug"`
+}
+
+type notification struct {
+	Type      string      `json:"type"`
+	CreatedAt int64       `json:"created_at"`
+	Payload   interface{} `json:"payload"`
+}
+
+type resourcesPayload struct {
+	ResourceUUIDs []string `json:"resources_uuids"`
+}
+
+type updatedPayload struct {
+	Resource resourceState `json:"resource"`
+	Plan     planState     `json:"plan"`
+}
+
+type timestamp struct {
+	Seconds int64 `json:"seconds"`
+}
+
+type resourceState struct {
+	UUID      string    `json:"uuid"`
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	CreatedAt timestamp `json:"created_at"`
+	UpdatedAt timestamp `json:"updated_at"`
+}
+
+type planState struct {
+	DisplayName string    `json:"display_name"`
+	Slug        string    `json:"slug"`
+	CreatedAt   timestamp `json:"created_at"`
+	UpdatedAt   timestamp `json:"updated_at"`
+}
+
+// Send a provisioning request with a fresh OAuth grant
+func (s *Simulator) Provision(ctx context.Context, r Resource) (*Response, error) {
+	req := provisioningRequest{
+		Name:     r.Name,
+		AppSlug:  r.AppSlug,
+		PlanSlug: r.PlanSlug,
+		UUID:     r.UUID,
+		Metadata: provisioningMetadata{
+			Language:        r.Language,
+			EmailPreference: true,
+		},
+		Email:  r.Email,
+		TeamID: r.TeamID,
+		OauthGrant: oauthGrant{
+			CodeType:  "authorization_code",
+			Code:      newCode(r.UUID),
+			ExpiresAt: time.Now().Add(5 * time.Minute).Unix(),
+		},
+	}
+
+	return s.sendJSON(ctx, http.MethodPost, "/digitalocean/resources", req)
+}
+
+// Send a plan change request
+func (s *Simulator) ChangePlan(ctx context.Context, resourceUUID string, planSlug string) (*Response, error) {
+	req := planChangeRequest{
+		PlanSlug: planSlug,
+	}
+
+	return s.sendJSON(ctx, http.MethodPut, "/digitalocean/resources/"+url.PathEscape(resourceUUID), req)
+}
+
+// Send a deprovisioning request
+func (s *Simulator) Deprovision(ctx context.Context, resourceUUID string) (*Response, error) {
+	return s.sendJSON(ctx, http.MethodDelete, "/digitalocean/resources/"+url.PathEscape(resourceUUID), nil)
+}
+
+// Send a suspended, reactivated or deprovisioning failed notification for the given resources
+func (s *Simulator) NotifyResources(ctx context.Context, notificationType string, resourceUUIDs []string) (*Response, error) {
+	switch notificationType {
+	case Suspended, Reactivated, DeprovisioningFailed:
+	default:
+		return nil, fmt.Errorf("%q is not a notification about a list of resources", notificationType)
+	}
+
+	n := notification{
+		Type:      notificationType,
+		CreatedAt: time.Now().Unix(),
+		Payload: resourcesPayload{
+			ResourceUUIDs: resourceUUIDs,
+		},
+	}
+
+	return s.sendJSON(ctx, http.MethodPost, "/digitalocean/notifications", n)
+}
+
+// Send a resources.updated notification with the resource's current name,
+// state and plan
+func (s *Simulator) NotifyUpdated(ctx context.Context, r Resource, state string, planDisplayName string) (*Response, error) {
+	now := timestamp{Seconds: time.Now().Unix()}
+	n := notification{
+		Type:      Updated,
+		CreatedAt: now.Seconds,
+		Payload: updatedPayload{
+			Resource: resourceState{
+				UUID:      r.UUID,
+				Name:      r.Name,
+				State:     state,
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+			Plan: planState{
+				DisplayName: planDisplayName,
+				Slug:        r.PlanSlug,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			},
+		},
+	}
+
+	return s.sendJSON(ctx, http.MethodPost, "/digitalocean/notifications", n)
+}
+
+// Send a signed single sign-on request, the way DigitalOcean does when a user
+// opens the add-on from their dashboard. Redirects are not followed so the
+// returned Location can be inspected.
+func (s *Simulator) SSO(ctx context.Context, resourceUUID string, email string, userID string) (*Response, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	form := url.Values{
+		"resource_uuid": {resourceUUID},
+		"token":         {SignSSO(s.AppSalt, timestamp, resourceUUID)},
+		"timestamp":     {timestamp},
+		"user_email":    {email},
+		"user_id":       {userID},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.AddonURL+"/digitalocean/sso", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return s.do(req)
+}
+
+// Compute the token DigitalOcean includes in an SSO request: a hex encoded
+// HMAC-SHA256 of "timestamp:resource_uuid", keyed with the app salt
+func SignSSO(salt string, timestamp string, resourceUUID string) string {
+	hash := hmac.New(sha256.New, []byte(salt))
+	hash.Write([]byte(timestamp + ":" + resourceUUID))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (s *Simulator) sendJSON(ctx context.Context, method string, path string, body interface{}) (*Response, error) {
+	var reader io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(jsonBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.AddonURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return s.do(req)
+}
+
+func (s *Simulator) do(req *http.Request) (*Response, error) {
+	req.SetBasicAuth(s.AppSlug, s.AppPassword)
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	// Copy the client so redirects are never followed
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	res, err := noRedirect.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       string(body),
+	}, nil
+}
@@ -0,0 +1,106 @@
+package dosim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// The last request the add-on received
+type received struct {
+	method   string
+	path     string
+	user     string
+	password string
+	body     []byte
+}
+
+// Serve as the add-on, answering every request with the given status
+func testSimulator(t *testing.T, status int) (*Simulator, *received) {
+	t.Helper()
+	got := &received{}
+	addon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.method = r.Method
+		got.path = r.URL.Path
+		got.user, got.password, _ = r.BasicAuth()
+		got.body, _ = io.ReadAll(r.Body)
+
+		w.Header().Set("Location", "/dashboard")
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(addon.Close)
+
+	return &Simulator{AddonURL: addon.URL, AppSlug: "app", AppPassword: "password", AppSalt: "salt"}, got
+}
+
+func TestProvision(t *testing.T) {
+	sim, got := testSimulator(t, http.StatusOK)
+	r := Resource{UUID: "resource-uuid", Name: "name", AppSlug: "app", PlanSlug: "basic", Email: "someone@example.com", TeamID: "team", Language: "en"}
+
+	res, err := sim.Provision(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.OK() {
+		t.Errorf("got %s, want OK", res)
+	}
+
+	if got.method != http.MethodPost || got.path != "/digitalocean/resources" || got.user != "app" || got.password != "password" {
+		t.Errorf("sent %s %s as %s:%s", got.method, got.path, got.user, got.password)
+	}
+	sent := &provisioningRequest{}
+	err = json.Unmarshal(got.body, sent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.UUID != r.UUID || sent.TeamID != r.TeamID || sent.PlanSlug != r.PlanSlug {
+		t.Errorf("sent %+v, want the resource's details", sent)
+	}
+	if codeResource(sent.OauthGrant.Code) != r.UUID || sent.OauthGrant.ExpiresAt == 0 {
+		t.Errorf("sent grant %+v, want a code for the resource that expires", sent.OauthGrant)
+	}
+}
+
+func TestSSO(t *testing.T) {
+	sim, got := testSimulator(t, http.StatusTemporaryRedirect)
+
+	res, err := sim.SSO(context.Background(), "resource-uuid", "someone@example.com", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusTemporaryRedirect || res.Header.Get("Location") != "/dashboard" {
+		t.Errorf("got %s, want the redirect itself", res)
+	}
+
+	form, err := url.ParseQuery(string(got.body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Get("token") != SignSSO("salt", form.Get("timestamp"), "resource-uuid") {
+		t.Errorf("sent token %q, not signed with the salt", form.Get("token"))
+	}
+	if form.Get("user_email") != "someone@example.com" {
+		t.Errorf("sent user_email %q", form.Get("user_email"))
+	}
+}
+
+func TestSignSSO(t *testing.T) {
+	// Hex encoded HMAC-SHA256 of "1700000000:resource-uuid" keyed with "salt"
+	want := "3074112624bc6c3b48062dcc85d47197f9ff04846697f2d4800c2813c45e7230"
+	if got := SignSSO("salt", "1700000000", "resource-uuid"); got != want {
+		t.Errorf("SignSSO() = %q, want %q", got, want)
+	}
+}
+
+func TestNotifyResourcesType(t *testing.T) {
+	sim, _ := testSimulator(t, http.StatusOK)
+
+	_, err := sim.NotifyResources(context.Background(), Updated, []string{"resource-uuid"})
+	if err == nil {
+		t.Error("resources.updated sent as a list of resources")
+	}
+}
@@ -0,0 +1,83 @@
+package jsonfile
+
+/**
+ * JSON files the server is configured with, such as the plan catalog and the
+ * policies, which are checked when they are read and can be read again while
+ * the server is running.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Decode data into a new T and check it with validate. Unknown fields are
+// rejected so typos in the file are caught instead of silently ignored.
+// Decoding errors are prefixed with name.
+func Parse[T any](name string, data []byte, validate func(*T) error) (*T, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	v := new(T)
+	err := decoder.Decode(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	err = validate(v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Read the file at path and Parse it
+func Load[T any](name string, path string, validate func(*T) error) (*T, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return Parse(name, data, validate)
+}
+
+// A file that can be reloaded while what was read from it is in use
+type File[T any] struct {
+	path string
+	load func(path string) (*T, error)
+
+	mu      sync.RWMutex
+	current *T
+}
+
+// Read the file at path with load, which is used again on every Reload
+func Open[T any](path string, load func(path string) (*T, error)) (*File[T], error) {
+	f := &File[T]{path: path, load: load}
+	_, err := f.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// What was most recently read from the file. It must not be modified.
+func (f *File[T]) Current() *T {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.current
+}
+
+// Read the file again. If it cannot be read, what was read before is kept.
+func (f *File[T]) Reload() (*T, error) {
+	v, err := f.load(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	f.current = v
+	f.mu.Unlock()
+	return v, nil
+}
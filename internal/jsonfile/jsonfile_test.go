@@ -0,0 +1,98 @@
+package jsonfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type settings struct {
+	Limit int `json:"limit"`
+}
+
+func validateSettings(s *settings) error {
+	if s.Limit < 0 {
+		return errors.New("settings: limit must be at least 0")
+	}
+	return nil
+}
+
+func loadSettings(path string) (*settings, error) {
+	return Load("settings", path, validateSettings)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"valid", `{"limit": 3}`, ""},
+		{"unknown field", `{"limit": 3, "limt": 4}`, `settings: json: unknown field "limt"`},
+		{"malformed", `{"limit": `, "settings: unexpected EOF"},
+		{"invalid", `{"limit": -1}`, "limit must be at least 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse("settings", []byte(tt.data), validateSettings)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Limit != 3 {
+				t.Errorf("Limit = %d, want 3", s.Limit)
+			}
+		})
+	}
+}
+
+func TestFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	write := func(data string) {
+		t.Helper()
+		err := os.WriteFile(path, []byte(data), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"limit": 1}`)
+	f, err := Open(path, loadSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Current().Limit != 1 {
+		t.Fatalf("Limit = %d, want 1", f.Current().Limit)
+	}
+
+	write(`{"limit": 2}`)
+	s, err := f.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Limit != 2 || f.Current() != s {
+		t.Fatalf("Current() = %+v after reload, want limit 2", f.Current())
+	}
+
+	write(`{"limit": -1}`)
+	_, err = f.Reload()
+	if err == nil {
+		t.Fatal("Reload() of an invalid file succeeded")
+	}
+	if f.Current() != s {
+		t.Errorf("Current() = %+v after a failed reload, want limit 2", f.Current())
+	}
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing.json"), loadSettings)
+	if err == nil || !strings.HasPrefix(err.Error(), "settings: ") {
+		t.Errorf("Open() of a missing file error = %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package license
+
+/**
+ * License keys are JWTs signed with Ed25519, so our product can check a key
+ * and read what it grants without calling this server. The key that signed a
+ * license is named by the kid in its header. Every key in the keyring is
+ * published, so keys can be rotated by putting a new one first: licenses
+ * signed with the old one keep verifying until it is removed.
+ */
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+// Returned when a license key is malformed, has been tampered with, was
+// signed by a key we do not have, or has expired
+var ErrInvalid = errors.New("license: invalid license key")
+
+// What a license key says about the resource it was issued to. Subject holds
+// the resource UUID and Id is unique to each license key.
+type Claims struct {
+	AppSlug  string `json:"app"`
+	PlanSlug string `json:"plan"`
+	jwt.StandardClaims
+}
+
+// The resource the license key was issued to
+func (c *Claims) ResourceUUID() string {
+	return c.Subject
+}
+
+// A set of Ed25519 signing keys, the first of which signs new licenses
+type Keyring struct {
+	primary string
+	keys    map[string]ed25519.PrivateKey
+
+	// In the order they were given
+	ids []string
+}
+
+// A public key in JSON Web Key form
+type PublicKey struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+
+	// The key itself, base64url encoded
+	X string `json:"x"`
+}
+
+// Parse a keyring from a comma separated list of id:base64seed pairs, e.g.
+// "2024-06:q83v...,2023-01:ZmFr...". The first key is the primary one. Seeds
+// must decode to 32 bytes; generate a key with GenerateKey.
+func ParseKeyring(spec string) (*Keyring, error) {
+	k := &Keyring{keys: map[string]ed25519.PrivateKey{}}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("license: key %q is not in id:base64seed form", entry)
+		}
+		seed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("license: key %q is not valid base64: %w", id, err)
+		}
+		if len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("license: key %q is %d bytes, expected %d", id, len(seed), ed25519.SeedSize)
+		}
+		if _, ok := k.keys[id]; ok {
+			return nil, fmt.Errorf("license: key %q is listed twice", id)
+		}
+
+		if k.primary == "" {
+			k.primary = id
+		}
+		k.keys[id] = ed25519.NewKeyFromSeed(seed)
+		k.ids = append(k.ids, id)
+	}
+
+	if k.primary == "" {
+		return nil, errors.New("license: no keys given")
+	}
+	return k, nil
+}
+
+// Generate a new signing key, in the id:base64seed form ParseKeyring reads
+func GenerateKey(id string) (string, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	_, err := rand.Read(seed)
+	if err != nil {
+		return "", err
+	}
+	return id + ":" + base64.StdEncoding.EncodeToString(seed), nil
+}
+
+// ID of the key that signs new licenses
+func (k *Keyring) PrimaryID() string {
+	return k.primary
+}
+
+// Sign a license key for a resource. expiresAt may be zero for a license that
+// does not expire.
+func (k *Keyring) Issue(resourceUUID string, appSlug string, planSlug string, expiresAt time.Time) (string, error) {
+	claims := &Claims{
+		AppSlug:  appSlug,
+		PlanSlug: planSlug,
+		StandardClaims: jwt.StandardClaims{
+			Id:       uuid.New().String(),
+			Subject:  resourceUUID,
+			IssuedAt: time.Now().Unix(),
+		},
+	}
+	if !expiresAt.IsZero() {
+		claims.ExpiresAt = expiresAt.Unix()
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = k.primary
+	return token.SignedString(k.keys[k.primary])
+}
+
+// Check a license key's signature and expiry and return what it says
+func (k *Keyring) Verify(licenseKey string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(licenseKey, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodEdDSA {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		id, _ := token.Header["kid"].(string)
+		key, ok := k.keys[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", id)
+		}
+		return key.Public(), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	return claims, nil
+}
+
+// The public half of every key, primary first, for publishing to whoever
+// verifies licenses
+func (k *Keyring) PublicKeys() []PublicKey {
+	keys := []PublicKey{}
+	for _, id := range k.ids {
+		keys = append(keys, PublicKey{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			KeyID:     id,
+			Use:       "sig",
+			Algorithm: jwt.SigningMethodEdDSA.Alg(),
+			X:         base64.RawURLEncoding.EncodeToString(k.keys[id].Public().(ed25519.PublicKey)),
+		})
+	}
+	return keys
+}
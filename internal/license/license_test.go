@@ -0,0 +1,196 @@
+package license
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newKeyring(t *testing.T, ids ...string) (*Keyring, []string) {
+	t.Helper()
+	specs := []string{}
+	for _, id := range ids {
+		spec, err := GenerateKey(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		specs = append(specs, spec)
+	}
+	k, err := ParseKeyring(strings.Join(specs, ","))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k, specs
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	k, _ := newKeyring(t, "2024-06")
+
+	licenseKey, err := k.Issue("resource-uuid", "sample_app", "basic", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := k.Verify(licenseKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.ResourceUUID() != "resource-uuid" {
+		t.Errorf("ResourceUUID() = %q, want %q", claims.ResourceUUID(), "resource-uuid")
+	}
+	if claims.AppSlug != "sample_app" || claims.PlanSlug != "basic" {
+		t.Errorf("app, plan = %q, %q, want %q, %q", claims.AppSlug, claims.PlanSlug, "sample_app", "basic")
+	}
+	if claims.Id == "" {
+		t.Error("license key has no ID")
+	}
+	if claims.ExpiresAt != 0 {
+		t.Errorf("ExpiresAt = %d, want none", claims.ExpiresAt)
+	}
+
+	other, err := k.Issue("resource-uuid", "sample_app", "basic", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherClaims, err := k.Verify(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherClaims.Id == claims.Id {
+		t.Error("two license keys share an ID")
+	}
+}
+
+func TestVerifyExpiry(t *testing.T) {
+	k, _ := newKeyring(t, "2024-06")
+
+	expiresAt := time.Now().Add(time.Hour)
+	licenseKey, err := k.Issue("resource-uuid", "sample_app", "basic", expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := k.Verify(licenseKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ExpiresAt != expiresAt.Unix() {
+		t.Errorf("ExpiresAt = %d, want %d", claims.ExpiresAt, expiresAt.Unix())
+	}
+
+	expired, err := k.Issue("resource-uuid", "sample_app", "basic", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = k.Verify(expired)
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify() of an expired key error = %v, want ErrInvalid", err)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	k, _ := newKeyring(t, "2024-06")
+	stranger, _ := newKeyring(t, "2024-06")
+
+	licenseKey, err := k.Issue("resource-uuid", "sample_app", "basic", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(licenseKey, ".")
+	forged, err := k.Issue("resource-uuid", "sample_app", "pro", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		licenseKey string
+	}{
+		{"not a JWT", "3f1c9a52-0c1b-4b5e-9a43-52c1f0b0f4a1"},
+		{"payload swapped", parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]},
+		{"signature removed", parts[0] + "." + parts[1] + "."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := k.Verify(tt.licenseKey)
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("Verify() error = %v, want ErrInvalid", err)
+			}
+		})
+	}
+
+	// Same key ID, different key
+	_, err = stranger.Verify(licenseKey)
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify() with another keyring error = %v, want ErrInvalid", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old, oldSpecs := newKeyring(t, "2023-01")
+	licenseKey, err := old.Issue("resource-uuid", "sample_app", "basic", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newSpec, err := GenerateKey("2024-06")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := ParseKeyring(newSpec + "," + oldSpecs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.PrimaryID() != "2024-06" {
+		t.Errorf("PrimaryID() = %q, want %q", rotated.PrimaryID(), "2024-06")
+	}
+
+	// Licenses signed with the old key keep verifying
+	_, err = rotated.Verify(licenseKey)
+	if err != nil {
+		t.Errorf("Verify() of a license signed with the old key: %v", err)
+	}
+
+	// Both keys are published, primary first
+	published := rotated.PublicKeys()
+	if len(published) != 2 || published[0].KeyID != "2024-06" || published[1].KeyID != "2023-01" {
+		t.Errorf("PublicKeys() = %+v, want 2024-06 then 2023-01", published)
+	}
+
+	// Until the old key is removed
+	removed, err := ParseKeyring(newSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = removed.Verify(licenseKey)
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify() after removing the key error = %v, want ErrInvalid", err)
+	}
+}
+
+func TestParseKeyringErrors(t *testing.T) {
+	valid, err := GenerateKey("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr string
+	}{
+		{"no keys", " , ", "no keys given"},
+		{"missing id", ":abc", "not in id:base64seed form"},
+		{"bad base64", "a:???", "not valid base64"},
+		{"short seed", "a:YWJj", "expected 32"},
+		{"duplicate id", valid + "," + valid, "listed twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKeyring(tt.spec)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseKeyring(%q) error = %v, want one containing %q", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
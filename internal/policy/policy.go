@@ -0,0 +1,259 @@
+package policy
+
+/**
+ * Policies decide which provisioning requests and plan changes we accept,
+ * on top of the app and plan being in the catalog. They are read from a JSON
+ * file that can be reloaded while the server is running, so limits can be
+ * changed without a new build. A refusal carries a message meant for the
+ * customer, which DigitalOcean shows them.
+ */
+
+import (
+	"fmt"
+	"sample_app/internal/jsonfile"
+	"sort"
+	"strings"
+)
+
+type Policy struct {
+	// Revision of the policies. Bump it whenever the file changes.
+	Version int `json:"version"`
+
+	// Most live resources one team may have. 0 means there is no limit.
+	MaxResourcesPerTeam int `json:"max_resources_per_team"`
+
+	// Limits for particular teams, by team ID, used in place of MaxResourcesPerTeam
+	TeamLimits map[string]int `json:"team_limits"`
+
+	// Plans closed to new signups, by app slug. Resources already on them
+	// keep them, but nothing can be provisioned on or changed to them.
+	ClosedPlans map[string][]string `json:"closed_plans"`
+
+	// Team IDs that may not provision resources or change plans
+	BlockedTeams []string `json:"blocked_teams"`
+
+	// Email addresses, or whole domains written as "@example.com", that may
+	// not provision resources
+	BlockedEmails []string `json:"blocked_emails"`
+
+	// The values each metadata field may take, by field. Fields that are not
+	// listed may take any value.
+	AllowedMetadata map[string][]string `json:"allowed_metadata"`
+
+	// Wording to show customers in place of the default, by rule
+	Messages map[Rule]string `json:"messages"`
+}
+
+// What a policy refused a request for
+type Rule string
+
+const (
+	TeamLimit    Rule = "team_limit"
+	ClosedPlan   Rule = "closed_plan"
+	BlockedTeam  Rule = "blocked_team"
+	BlockedEmail Rule = "blocked_email"
+	Metadata     Rule = "metadata"
+)
+
+var rules = map[Rule]bool{
+	TeamLimit:    true,
+	ClosedPlan:   true,
+	BlockedTeam:  true,
+	BlockedEmail: true,
+	Metadata:     true,
+}
+
+// The metadata fields DigitalOcean sends with provisioning requests
+var MetadataFields = []string{"language", "email_preference"}
+
+// Returned when a request breaks a policy. The message is meant for the customer.
+type Violation struct {
+	Rule    Rule
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+// A request to provision a resource, either for the first time or again
+type Provisioning struct {
+	AppSlug  string
+	PlanSlug string
+
+	// Display name of the plan, for messages
+	PlanName string
+
+	// The plan the resource is on already, when it is provisioned again
+	CurrentPlanSlug string
+
+	Email  string
+	TeamID string
+
+	// Values of the request's metadata fields, by field
+	Metadata map[string]string
+
+	// How many live resources the team has, not counting this one
+	TeamResources int
+}
+
+// A request to move a resource to another plan
+type PlanChange struct {
+	AppSlug  string
+	PlanSlug string
+	PlanName string
+	TeamID   string
+
+	// The plan the resource is on now
+	CurrentPlanSlug string
+}
+
+// Parse and validate policies
+func Parse(data []byte) (*Policy, error) {
+	return jsonfile.Parse("policy", data, (*Policy).validate)
+}
+
+// Read and parse the policies at path
+func Load(path string) (*Policy, error) {
+	return jsonfile.Load("policy", path, (*Policy).validate)
+}
+
+func (p *Policy) validate() error {
+	if p.Version < 1 {
+		return fmt.Errorf("policy: version must be at least 1")
+	}
+	if p.MaxResourcesPerTeam < 0 {
+		return fmt.Errorf("policy: max_resources_per_team must be at least 0")
+	}
+	for team, limit := range p.TeamLimits {
+		if limit < 0 {
+			return fmt.Errorf("policy: team %q has a negative limit", team)
+		}
+	}
+	for _, email := range p.BlockedEmails {
+		if !strings.Contains(email, "@") {
+			return fmt.Errorf("policy: blocked email %q is not an address or an @domain", email)
+		}
+	}
+	for field, values := range p.AllowedMetadata {
+		known := false
+		for _, name := range MetadataFields {
+			known = known || name == field
+		}
+		if !known {
+			return fmt.Errorf("policy: unknown metadata field %q, expected one of: %s", field, strings.Join(MetadataFields, ", "))
+		}
+		if len(values) == 0 {
+			return fmt.Errorf("policy: metadata field %q allows no values", field)
+		}
+	}
+	for rule, message := range p.Messages {
+		if !rules[rule] {
+			return fmt.Errorf("policy: message for unknown rule %q", rule)
+		}
+		if message == "" {
+			return fmt.Errorf("policy: message for rule %q is empty", rule)
+		}
+	}
+
+	return nil
+}
+
+// Check a provisioning request against every policy. Returns a *Violation
+// for the first one it breaks.
+func (p *Policy) CheckProvisioning(req *Provisioning) error {
+	if p.blockedTeam(req.TeamID) {
+		return p.violation(BlockedTeam, "Your team can no longer add this add-on. Please contact support.")
+	}
+	if p.blockedEmail(req.Email) {
+		return p.violation(BlockedEmail, "This email address can not be used with this add-on. Please contact support.")
+	}
+	if p.closedPlan(req.AppSlug, req.PlanSlug, req.CurrentPlanSlug) {
+		return p.violation(ClosedPlan, fmt.Sprintf("The %s plan is no longer available. Please choose a different plan.", req.PlanName))
+	}
+
+	fields := make([]string, 0, len(p.AllowedMetadata))
+	for field := range p.AllowedMetadata {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		allowed := p.AllowedMetadata[field]
+		value := req.Metadata[field]
+		if !contains(allowed, value) {
+			return p.violation(Metadata, fmt.Sprintf("%q is not an accepted %s. Please choose one of: %s.", value, strings.ReplaceAll(field, "_", " "), strings.Join(allowed, ", ")))
+		}
+	}
+
+	limit := p.teamLimit(req.TeamID)
+	if req.TeamID != "" && limit > 0 && req.TeamResources >= limit {
+		return p.violation(TeamLimit, fmt.Sprintf("Your team already has %d of the %d resources it may have for this add-on. Please remove one before adding another.", req.TeamResources, limit))
+	}
+	return nil
+}
+
+// Check a plan change against the policies that apply to one. Returns a
+// *Violation for the first one it breaks.
+func (p *Policy) CheckPlanChange(req *PlanChange) error {
+	if p.blockedTeam(req.TeamID) {
+		return p.violation(BlockedTeam, "Your team can no longer change plans of this add-on. Please contact support.")
+	}
+	if p.closedPlan(req.AppSlug, req.PlanSlug, req.CurrentPlanSlug) {
+		return p.violation(ClosedPlan, fmt.Sprintf("The %s plan is no longer available. Please choose a different plan.", req.PlanName))
+	}
+	return nil
+}
+
+// The most live resources a team may have, or 0 if there is no limit
+func (p *Policy) teamLimit(team string) int {
+	if limit, ok := p.TeamLimits[team]; ok {
+		return limit
+	}
+	return p.MaxResourcesPerTeam
+}
+
+func (p *Policy) blockedTeam(team string) bool {
+	return team != "" && contains(p.BlockedTeams, team)
+}
+
+// Emails match blocked addresses and domains regardless of case
+func (p *Policy) blockedEmail(email string) bool {
+	email = strings.ToLower(email)
+	for _, blocked := range p.BlockedEmails {
+		blocked = strings.ToLower(blocked)
+		if email == blocked || (strings.HasPrefix(blocked, "@") && strings.HasSuffix(email, blocked)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resources already on a closed plan keep it, so it is only closed to others
+func (p *Policy) closedPlan(appSlug string, planSlug string, currentPlanSlug string) bool {
+	return planSlug != currentPlanSlug && contains(p.ClosedPlans[appSlug], planSlug)
+}
+
+// A violation of rule, worded as configured or with the default message
+func (p *Policy) violation(rule Rule, message string) *Violation {
+	if configured, ok := p.Messages[rule]; ok {
+		message = configured
+	}
+	return &Violation{Rule: rule, Message: message}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// A policy file that can be reloaded while it is in use
+type File = jsonfile.File[Policy]
+
+// Load the policies at path
+func Open(path string) (*File, error) {
+	return jsonfile.Open(path, Load)
+}
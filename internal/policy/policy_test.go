@@ -0,0 +1,229 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"minimal", `{"version": 1}`, ""},
+		{"everything", `{
+			"version": 3,
+			"max_resources_per_team": 5,
+			"team_limits": {"big-team": 50},
+			"closed_plans": {"sample_app": ["legacy"]},
+			"blocked_teams": ["bad-team"],
+			"blocked_emails": ["spam@example.com", "@example.net"],
+			"allowed_metadata": {"language": ["en", "fr"]},
+			"messages": {"team_limit": "Too many."}
+		}`, ""},
+		{"not JSON", `version: 1`, "invalid character"},
+		{"unknown field", `{"version": 1, "max_resources": 5}`, "unknown field"},
+		{"missing version", `{}`, "version must be at least 1"},
+		{"negative limit", `{"version": 1, "max_resources_per_team": -1}`, "max_resources_per_team must be at least 0"},
+		{"negative team limit", `{"version": 1, "team_limits": {"t": -2}}`, `team "t" has a negative limit`},
+		{"blocked email without @", `{"version": 1, "blocked_emails": ["example.com"]}`, "is not an address or an @domain"},
+		{"unknown metadata field", `{"version": 1, "allowed_metadata": {"colour": ["red"]}}`, `unknown metadata field "colour"`},
+		{"metadata without values", `{"version": 1, "allowed_metadata": {"language": []}}`, "allows no values"},
+		{"message for unknown rule", `{"version": 1, "messages": {"too_rich": "No."}}`, `unknown rule "too_rich"`},
+		{"empty message", `{"version": 1, "messages": {"closed_plan": ""}}`, "is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(): %v", err)
+			}
+			if p.Version < 1 {
+				t.Errorf("Version = %d", p.Version)
+			}
+		})
+	}
+}
+
+func testPolicy(t *testing.T) *Policy {
+	t.Helper()
+	p, err := Parse([]byte(`{
+		"version": 1,
+		"max_resources_per_team": 2,
+		"team_limits": {"big-team": 10, "unlimited-team": 0},
+		"closed_plans": {"sample_app": ["legacy"]},
+		"blocked_teams": ["bad-team"],
+		"blocked_emails": ["spam@example.com", "@Example.NET"],
+		"allowed_metadata": {"language": ["en", "fr"]},
+		"messages": {"blocked_team": "Talk to us first."}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestCheckProvisioning(t *testing.T) {
+	p := testPolicy(t)
+	valid := Provisioning{
+		AppSlug:  "sample_app",
+		PlanSlug: "basic",
+		PlanName: "Basic",
+		Email:    "someone@example.com",
+		TeamID:   "team",
+		Metadata: map[string]string{"language": "en"},
+	}
+
+	tests := []struct {
+		name     string
+		change   func(r *Provisioning)
+		wantRule Rule
+	}{
+		{"allowed", func(r *Provisioning) {}, ""},
+		{"under the limit", func(r *Provisioning) { r.TeamResources = 1 }, ""},
+		{"at the limit", func(r *Provisioning) { r.TeamResources = 2 }, TeamLimit},
+		{"team with a higher limit", func(r *Provisioning) { r.TeamID = "big-team"; r.TeamResources = 9 }, ""},
+		{"team over its own limit", func(r *Provisioning) { r.TeamID = "big-team"; r.TeamResources = 10 }, TeamLimit},
+		{"team without a limit", func(r *Provisioning) { r.TeamID = "unlimited-team"; r.TeamResources = 100 }, ""},
+		{"no team", func(r *Provisioning) { r.TeamID = ""; r.TeamResources = 100 }, ""},
+		{"blocked team", func(r *Provisioning) { r.TeamID = "bad-team" }, BlockedTeam},
+		{"blocked address", func(r *Provisioning) { r.Email = "Spam@Example.com" }, BlockedEmail},
+		{"blocked domain", func(r *Provisioning) { r.Email = "someone@example.net" }, BlockedEmail},
+		{"domain only as a suffix", func(r *Provisioning) { r.Email = "someone@notexample.net" }, ""},
+		{"closed plan", func(r *Provisioning) { r.PlanSlug = "legacy" }, ClosedPlan},
+		{"plan closed for another app", func(r *Provisioning) { r.AppSlug = "other_app"; r.PlanSlug = "legacy" }, ""},
+		{"provisioned again on its closed plan", func(r *Provisioning) { r.PlanSlug = "legacy"; r.CurrentPlanSlug = "legacy" }, ""},
+		{"provisioned again on another closed plan", func(r *Provisioning) { r.PlanSlug = "legacy"; r.CurrentPlanSlug = "basic" }, ClosedPlan},
+		{"metadata not allowed", func(r *Provisioning) { r.Metadata["language"] = "de" }, Metadata},
+		{"metadata missing", func(r *Provisioning) { delete(r.Metadata, "language") }, Metadata},
+		{"blocked team checked first", func(r *Provisioning) { r.TeamID = "bad-team"; r.PlanSlug = "legacy" }, BlockedTeam},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			req.Metadata = map[string]string{}
+			for k, v := range valid.Metadata {
+				req.Metadata[k] = v
+			}
+			tt.change(&req)
+
+			err := p.CheckProvisioning(&req)
+			checkViolation(t, err, tt.wantRule)
+		})
+	}
+}
+
+func TestCheckPlanChange(t *testing.T) {
+	p := testPolicy(t)
+
+	tests := []struct {
+		name     string
+		req      PlanChange
+		wantRule Rule
+	}{
+		{"allowed", PlanChange{AppSlug: "sample_app", PlanSlug: "pro", TeamID: "team"}, ""},
+		{"closed plan", PlanChange{AppSlug: "sample_app", PlanSlug: "legacy", PlanName: "Legacy", TeamID: "team", CurrentPlanSlug: "basic"}, ClosedPlan},
+		{"staying on a closed plan", PlanChange{AppSlug: "sample_app", PlanSlug: "legacy", TeamID: "team", CurrentPlanSlug: "legacy"}, ""},
+		{"blocked team", PlanChange{AppSlug: "sample_app", PlanSlug: "pro", TeamID: "bad-team"}, BlockedTeam},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.CheckPlanChange(&tt.req)
+			checkViolation(t, err, tt.wantRule)
+		})
+	}
+}
+
+func TestViolationMessages(t *testing.T) {
+	p := testPolicy(t)
+
+	// Configured wording replaces the default
+	err := p.CheckPlanChange(&PlanChange{AppSlug: "sample_app", PlanSlug: "pro", TeamID: "bad-team"})
+	if err == nil || err.Error() != "Talk to us first." {
+		t.Errorf("blocked team message = %v, want the configured one", err)
+	}
+
+	// Defaults name what was refused
+	err = p.CheckPlanChange(&PlanChange{AppSlug: "sample_app", PlanSlug: "legacy", PlanName: "Legacy"})
+	if err == nil || !strings.Contains(err.Error(), "The Legacy plan is no longer available") {
+		t.Errorf("closed plan message = %v, want one naming the plan", err)
+	}
+}
+
+func checkViolation(t *testing.T, err error, want Rule) {
+	t.Helper()
+	if want == "" {
+		if err != nil {
+			t.Fatalf("refused: %v", err)
+		}
+		return
+	}
+
+	var violation *Violation
+	if !errors.As(err, &violation) {
+		t.Fatalf("error = %v, want a %s violation", err, want)
+	}
+	if violation.Rule != want {
+		t.Errorf("Rule = %s, want %s", violation.Rule, want)
+	}
+	if violation.Message == "" {
+		t.Error("violation has no message")
+	}
+}
+
+func TestFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	write := func(data string) {
+		t.Helper()
+		err := os.WriteFile(path, []byte(data), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"version": 1, "max_resources_per_team": 2}`)
+	f, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Current().MaxResourcesPerTeam != 2 {
+		t.Fatalf("MaxResourcesPerTeam = %d, want 2", f.Current().MaxResourcesPerTeam)
+	}
+
+	write(`{"version": 2, "max_resources_per_team": 5}`)
+	p, err := f.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version != 2 || f.Current() != p {
+		t.Fatalf("Current() = %+v after reload, want version 2", f.Current())
+	}
+
+	// A broken file keeps the policies already loaded
+	write(`{"version": 3, "max_resources_per_team": -1}`)
+	_, err = f.Reload()
+	if err == nil {
+		t.Fatal("Reload() of an invalid file succeeded")
+	}
+	if f.Current() != p {
+		t.Errorf("Current() = %+v after a failed reload, want version 2", f.Current())
+	}
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing.json"))
+	if err == nil {
+		t.Error("Open() of a missing file succeeded")
+	}
+}
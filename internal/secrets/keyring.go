@@ -0,0 +1,183 @@
+package secrets
+
+/**
+ * Envelope encryption for values we store at rest. Each row gets its own
+ * random data key, which encrypts the row's values with AES-GCM. The data key
+ * itself is encrypted ("wrapped") with one of the keyring's master keys and
+ * stored next to the row along with that master key's ID. Rotating master
+ * keys therefore only means re-wrapping data keys, and old rows stay readable
+ * as long as their master key is still in the keyring.
+ */
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Returned when a value was encrypted with a master key the keyring does not have
+var ErrUnknownKey = errors.New("secrets: unknown key id")
+
+// A set of 256-bit master keys, one of which is used for everything newly encrypted
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// A per-row key, and the wrapped form of it that is stored with the row
+type DataKey struct {
+	KeyID   string
+	Wrapped []byte
+
+	aead cipher.AEAD
+}
+
+// Parse a keyring from a comma separated list of id:base64key pairs, e.g.
+// "2024-06:q83v...,2023-01:ZmFr...". The first key is the primary one.
+// Keys must decode to 32 bytes; generate one with `openssl rand -base64 32`.
+func ParseKeyring(spec string) (*Keyring, error) {
+	k := &Keyring{keys: map[string][]byte{}}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("secrets: key %q is not in id:base64key form", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("secrets: key %q is not valid base64: %w", id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("secrets: key %q is %d bytes, expected 32", id, len(key))
+		}
+		if _, ok := k.keys[id]; ok {
+			return nil, fmt.Errorf("secrets: key %q is listed twice", id)
+		}
+
+		if k.primary == "" {
+			k.primary = id
+		}
+		k.keys[id] = key
+	}
+
+	if k.primary == "" {
+		return nil, errors.New("secrets: no keys given")
+	}
+	return k, nil
+}
+
+// ID of the key used to wrap new data keys
+func (k *Keyring) PrimaryID() string {
+	return k.primary
+}
+
+// Generate a fresh data key, wrapped with the primary master key
+func (k *Keyring) NewDataKey() (*DataKey, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+
+	master, err := newAEAD(k.keys[k.primary])
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(master, key, []byte(k.primary))
+	if err != nil {
+		return nil, err
+	}
+
+	return newDataKey(k.primary, wrapped, key)
+}
+
+// Unwrap a data key that was stored with a row
+func (k *Keyring) OpenDataKey(keyID string, wrapped []byte) (*DataKey, error) {
+	masterKey, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+
+	master, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := open(master, wrapped, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("secrets: unable to unwrap data key: %w", err)
+	}
+
+	return newDataKey(keyID, wrapped, key)
+}
+
+// Encrypt a value. context is authenticated but not stored, so the same
+// context must be given to Decrypt. Use it to tie a value to where it is
+// stored, e.g. the row and column, so ciphertexts cannot be swapped around.
+func (d *DataKey) Encrypt(plaintext string, context string) (string, error) {
+	ciphertext, err := seal(d.aead, []byte(plaintext), []byte(context))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt a value produced by Encrypt with the same context
+func (d *DataKey) Decrypt(ciphertext string, context string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("secrets: ciphertext is not valid base64: %w", err)
+	}
+
+	plaintext, err := open(d.aead, raw, []byte(context))
+	if err != nil {
+		return "", fmt.Errorf("secrets: unable to decrypt: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+func newDataKey(keyID string, wrapped []byte, key []byte) (*DataKey, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataKey{
+		KeyID:   keyID,
+		Wrapped: wrapped,
+		aead:    aead,
+	}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt with a random nonce, which is prepended to the result
+func seal(aead cipher.AEAD, plaintext []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
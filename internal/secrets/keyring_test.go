@@ -0,0 +1,142 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var (
+	keyA = "a:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32)))
+	keyB = "b:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 32)))
+)
+
+func TestParseKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		primary string
+		wantErr string
+	}{
+		{"one key", keyA, "a", ""},
+		{"first key is primary", keyB + "," + keyA, "b", ""},
+		{"spaces and empty entries", " " + keyA + " ,, ", "a", ""},
+		{"no keys", "", "", "no keys given"},
+		{"missing id", "YWFh", "", "not in id:base64key form"},
+		{"bad base64", "a:not base64", "", "not valid base64"},
+		{"short key", "a:" + base64.StdEncoding.EncodeToString([]byte("short")), "", "expected 32"},
+		{"duplicate id", keyA + "," + keyA, "", "listed twice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKeyring(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseKeyring(%q) error = %v, want one containing %q", tt.spec, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseKeyring(%q): %v", tt.spec, err)
+			}
+			if k.PrimaryID() != tt.primary {
+				t.Errorf("PrimaryID() = %q, want %q", k.PrimaryID(), tt.primary)
+			}
+		})
+	}
+}
+
+func TestDataKeyRoundTrip(t *testing.T) {
+	k, err := ParseKeyring(keyA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataKey, err := k.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dataKey.KeyID != "a" {
+		t.Errorf("KeyID = %q, want %q", dataKey.KeyID, "a")
+	}
+	ciphertext, err := dataKey.Encrypt("hunter2", "tokens.access_token:uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(ciphertext, "hunter2") {
+		t.Fatalf("ciphertext %q contains the plaintext", ciphertext)
+	}
+
+	opened, err := k.OpenDataKey(dataKey.KeyID, dataKey.Wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := opened.Decrypt(ciphertext, "tokens.access_token:uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext != "hunter2" {
+		t.Errorf("Decrypt() = %q, want %q", plaintext, "hunter2")
+	}
+
+	// The context ties a ciphertext to where it is stored
+	_, err = opened.Decrypt(ciphertext, "tokens.refresh_token:uuid")
+	if err == nil {
+		t.Error("Decrypt() with a different context succeeded")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old, err := ParseKeyring(keyA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKey, err := old.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := dataKey.Encrypt("hunter2", "context")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A new key at the front is used for new data keys, and data keys
+	// wrapped with the old one stay readable
+	rotated, err := ParseKeyring(keyB + "," + keyA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := rotated.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.KeyID != "b" {
+		t.Errorf("new data key KeyID = %q, want %q", fresh.KeyID, "b")
+	}
+	opened, err := rotated.OpenDataKey(dataKey.KeyID, dataKey.Wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := opened.Decrypt(ciphertext, "context")
+	if err != nil || plaintext != "hunter2" {
+		t.Fatalf("Decrypt() = %q, %v, want %q", plaintext, err, "hunter2")
+	}
+
+	// Once the old key is removed, its data keys can no longer be opened
+	removed, err := ParseKeyring(keyB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = removed.OpenDataKey(dataKey.KeyID, dataKey.Wrapped)
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("OpenDataKey() error = %v, want ErrUnknownKey", err)
+	}
+
+	// A wrapped key cannot be passed off as wrapped by another master key
+	_, err = rotated.OpenDataKey("b", dataKey.Wrapped)
+	if err == nil {
+		t.Error("OpenDataKey() with the wrong key ID succeeded")
+	}
+}
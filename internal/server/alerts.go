@@ -0,0 +1,41 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Tell whoever runs the app about something a person needs to look at. Alerts
+// are always logged, and also posted to ALERT_WEBHOOK_URL as {"text": message}
+// when it is set, which Slack and most chat tools accept.
+func (s *server) alert(ctx context.Context, message string) {
+	s.e.Logger.Error("ALERT: " + message)
+	if s.config.alertWebhookURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(map[string]string{"text": message})
+	if err != nil {
+		s.e.Logger.Error("Unable to encode alert: " + err.Error())
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.alertWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		s.e.Logger.Error("Unable to build alert request: " + err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		s.e.Logger.Error("Unable to send alert: " + err.Error())
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		s.e.Logger.Error("Alert webhook responded " + strconv.Itoa(resp.StatusCode))
+	}
+}
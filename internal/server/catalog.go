@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sample_app/internal/catalog"
+	"strconv"
+	"syscall"
+)
+
+// Check that DigitalOcean asked for an app and plan we actually offer
+func (s *server) checkPlan(appSlug string, planSlug string) error {
+	_, err := s.catalog.Current().Plan(appSlug, planSlug)
+	return err
+}
+
+// Load the plan catalog again, keeping the current one if the file is invalid
+func (s *server) reloadCatalog() (*catalog.Catalog, error) {
+	c, err := s.catalog.Reload()
+	if err != nil {
+		s.e.Logger.Error("Unable to reload plan catalog: " + err.Error())
+		return nil, err
+	}
+
+	s.e.Logger.Info("Loaded plan catalog version " + strconv.Itoa(c.Version))
+	s.entitlementCache.clear()
+	return c, nil
+}
+
+// Reload the plan catalog and policies whenever the process receives SIGHUP,
+// until ctx is cancelled
+func (s *server) reloadOnHangup(ctx context.Context) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+			s.reloadCatalog()
+			s.reloadPolicy()
+		}
+	}
+}
@@ -1,6 +1,14 @@
 package server
 
-import "os"
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sample_app/internal/digitalocean"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type serverConfig struct {
 	// This would be the URL to direct users to after authentication
@@ -16,6 +24,107 @@ type serverConfig struct {
 
 	// Address this sample server should run on
 	serverAddr string
+
+	// JSON file describing the apps and plans we offer
+	catalogPath string
+
+	// JSON file of the policies provisioning requests and plan changes must meet
+	policyPath string
+
+	// Ed25519 keys license keys are signed with, as id:base64seed pairs, the
+	// one that signs new licenses first. License keys are random when empty.
+	licenseSigningKeys string
+
+	// How long signed license keys are valid for after they are issued. 0
+	// means they do not expire.
+	licenseKeyLifetime time.Duration
+
+	// How often to look for license keys that are about to expire, and how
+	// long before expiry to give their resources new ones
+	licenseKeyRenewalInterval time.Duration
+	licenseKeyRenewalLeadTime time.Duration
+
+	// How long a replaced license key keeps being accepted
+	licenseKeyGracePeriod time.Duration
+
+	// Most license verifications allowed a minute from one client IP, and for
+	// one license key. 0 turns the limit off.
+	licenseVerifyIPRate  int
+	licenseVerifyKeyRate int
+
+	// How long to keep the audit log of license verifications
+	licenseAuditRetention time.Duration
+
+	// Whether to take client IPs from X-Forwarded-For, set by a proxy in front
+	// of this server. Otherwise they are taken from the connection.
+	trustProxyHeaders bool
+
+	// How long a front-end session may go unused, and how long it may last
+	// however much it is used
+	sessionIdleTimeout time.Duration
+	sessionMaxAge      time.Duration
+
+	// Whether session cookies are only sent over HTTPS, and when browsers
+	// send them with requests from other sites
+	sessionCookieSecure   bool
+	sessionCookieSameSite http.SameSite
+
+	// Base URL of the DigitalOcean API. Can be pointed at a local stand-in.
+	digitaloceanAPI string
+
+	// Bearer token required by operator endpoints under /admin. They are
+	// disabled when this is empty.
+	adminAPIKey string
+
+	// Bearer token our product services use to look up entitlements and
+	// report usage. Their endpoints are disabled when this is empty.
+	serviceAPIKey string
+
+	// How long an instance may keep serving entitlements it has looked up.
+	// Changes made through this instance take effect straight away either way.
+	entitlementsCacheTTL time.Duration
+
+	// Most usage events accepted in one batch
+	meteringMaxBatch int
+
+	// How often to look for access tokens that are about to expire, and how
+	// long before expiry to refresh them
+	tokenRefreshInterval time.Duration
+	tokenRefreshLeadTime time.Duration
+
+	// Most token refreshes in flight at once, and the most each one is
+	// randomly delayed so refreshes do not all hit DigitalOcean together
+	tokenRefreshConcurrency int
+	tokenRefreshJitter      time.Duration
+
+	// How often to retry deprovisioning resources DigitalOcean failed to
+	// deprovision, the wait before the first retry, which doubles after each
+	// failed one, and how many retries to make before leaving it to an operator
+	deprovisionRetryInterval time.Duration
+	deprovisionRetryBackoff  time.Duration
+	deprovisionRetryAttempts int
+
+	// How often to deliver queued config pushes, the wait before retrying a
+	// failed one, which doubles after each failure, and how many attempts to
+	// make before giving up
+	configPushInterval time.Duration
+	configPushBackoff  time.Duration
+	configPushAttempts int
+
+	// How often to exchange queued authorization codes for tokens, and the
+	// wait before retrying a failed exchange, which doubles after each failure.
+	// Exchanges are retried until the code expires.
+	oauthExchangeInterval time.Duration
+	oauthExchangeBackoff  time.Duration
+
+	// How long to keep a deprovisioned account's data before purging it, and
+	// how often to look for accounts to purge
+	deprovisionRetention     time.Duration
+	deprovisionPurgeInterval time.Duration
+
+	// Where to post alerts about things that need a person to look at them,
+	// in addition to logging them. Alerts are only logged when this is empty.
+	alertWebhookURL string
 }
 
 func setupServer() *serverConfig {
@@ -26,6 +135,59 @@ func setupServer() *serverConfig {
 		appHomepage:  valueOrDefault("APP_HOMEPAGE", ""),
 		clientSecret: valueOrDefault("CLIENT_SECRET", ""),
 		serverAddr:   valueOrDefault("SERVER_ADDR", ":8082"),
+
+		catalogPath: valueOrDefault("CATALOG_FILE", "catalog.json"),
+		policyPath:  valueOrDefault("POLICY_FILE", "policy.json"),
+
+		licenseSigningKeys: valueOrDefault("LICENSE_SIGNING_KEYS", ""),
+
+		licenseKeyLifetime:    durationOrDefault("LICENSE_KEY_LIFETIME", 0),
+		licenseKeyGracePeriod: durationOrDefault("LICENSE_KEY_GRACE_PERIOD", 24*time.Hour),
+
+		licenseKeyRenewalInterval: durationOrDefault("LICENSE_KEY_RENEWAL_INTERVAL", time.Hour),
+		licenseKeyRenewalLeadTime: durationOrDefault("LICENSE_KEY_RENEWAL_LEAD_TIME", 7*24*time.Hour),
+
+		licenseVerifyIPRate:   intOrDefault("LICENSE_VERIFY_IP_RATE", 60),
+		licenseVerifyKeyRate:  intOrDefault("LICENSE_VERIFY_KEY_RATE", 20),
+		licenseAuditRetention: durationOrDefault("LICENSE_AUDIT_RETENTION", 90*24*time.Hour),
+
+		trustProxyHeaders: valueOrDefault("TRUST_PROXY_HEADERS", "") == "true",
+
+		sessionIdleTimeout:    durationOrDefault("SESSION_IDLE_TIMEOUT", 30*time.Minute),
+		sessionMaxAge:         durationOrDefault("SESSION_MAX_AGE", 12*time.Hour),
+		sessionCookieSecure:   valueOrDefault("SESSION_COOKIE_SECURE", "true") == "true",
+		sessionCookieSameSite: sameSiteOrDefault("SESSION_COOKIE_SAMESITE", http.SameSiteLaxMode),
+
+		digitaloceanAPI: valueOrDefault("DIGITALOCEAN_API_URL", digitalocean.DefaultBaseURL),
+
+		adminAPIKey: valueOrDefault("ADMIN_API_KEY", ""),
+
+		// ENTITLEMENTS_API_KEY is its name from before services could report usage
+		serviceAPIKey:        valueOrDefault("SERVICE_API_KEY", valueOrDefault("ENTITLEMENTS_API_KEY", "")),
+		entitlementsCacheTTL: durationOrDefault("ENTITLEMENTS_CACHE_TTL", 30*time.Second),
+
+		meteringMaxBatch: intOrDefault("METERING_MAX_BATCH", 1000),
+
+		tokenRefreshInterval:    durationOrDefault("TOKEN_REFRESH_INTERVAL", 5*time.Minute),
+		tokenRefreshLeadTime:    durationOrDefault("TOKEN_REFRESH_LEAD_TIME", 30*time.Minute),
+		tokenRefreshConcurrency: intOrDefault("TOKEN_REFRESH_CONCURRENCY", 4),
+		tokenRefreshJitter:      durationOrDefault("TOKEN_REFRESH_JITTER", 30*time.Second),
+
+		deprovisionRetryInterval: durationOrDefault("DEPROVISION_RETRY_INTERVAL", time.Minute),
+		deprovisionRetryBackoff:  durationOrDefault("DEPROVISION_RETRY_BACKOFF", time.Minute),
+		deprovisionRetryAttempts: intOrDefault("DEPROVISION_RETRY_ATTEMPTS", 5),
+
+		configPushInterval: durationOrDefault("CONFIG_PUSH_INTERVAL", 15*time.Second),
+		configPushBackoff:  durationOrDefault("CONFIG_PUSH_BACKOFF", 30*time.Second),
+		configPushAttempts: intOrDefault("CONFIG_PUSH_ATTEMPTS", 8),
+
+		oauthExchangeInterval: durationOrDefault("OAUTH_EXCHANGE_INTERVAL", 10*time.Second),
+		oauthExchangeBackoff:  durationOrDefault("OAUTH_EXCHANGE_BACKOFF", 5*time.Second),
+
+		deprovisionRetention:     durationOrDefault("DEPROVISION_RETENTION", 30*24*time.Hour),
+		deprovisionPurgeInterval: durationOrDefault("DEPROVISION_PURGE_INTERVAL", time.Hour),
+
+		alertWebhookURL: valueOrDefault("ALERT_WEBHOOK_URL", ""),
 	}
 
 	return config
@@ -38,3 +200,54 @@ func valueOrDefault(key string, defaultVal string) string {
 	}
 	return envVar
 }
+
+// Read a duration such as "90s" or "5m". Invalid values fall back to the default.
+func durationOrDefault(key string, defaultVal time.Duration) time.Duration {
+	envVar, isSet := os.LookupEnv(key)
+	if !isSet {
+		return defaultVal
+	}
+
+	d, err := time.ParseDuration(envVar)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid duration for %s, using %s: %v\n", key, defaultVal, err)
+		return defaultVal
+	}
+	return d
+}
+
+// Read an integer. Invalid values fall back to the default.
+func intOrDefault(key string, defaultVal int) int {
+	envVar, isSet := os.LookupEnv(key)
+	if !isSet {
+		return defaultVal
+	}
+
+	i, err := strconv.Atoi(envVar)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid integer for %s, using %d: %v\n", key, defaultVal, err)
+		return defaultVal
+	}
+	return i
+}
+
+var sameSiteModes = map[string]http.SameSite{
+	"strict": http.SameSiteStrictMode,
+	"lax":    http.SameSiteLaxMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+// Read a cookie SameSite mode: strict, lax or none. Invalid values fall back to the default.
+func sameSiteOrDefault(key string, defaultVal http.SameSite) http.SameSite {
+	envVar, isSet := os.LookupEnv(key)
+	if !isSet {
+		return defaultVal
+	}
+
+	mode, ok := sameSiteModes[strings.ToLower(envVar)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Invalid SameSite mode for %s, expected strict, lax or none\n", key)
+		return defaultVal
+	}
+	return mode
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sample_app/internal/store"
+	"sample_app/models"
+	"time"
+)
+
+// What the front-end sees of a config push
+type ConfigPushResponse struct {
+	ResourceUUID string `json:"resource_uuid"`
+
+	// One of queued, delivered, failed or superseded
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+func newConfigPushResponse(push *models.ConfigPush) *ConfigPushResponse {
+	resp := &ConfigPushResponse{
+		ResourceUUID: push.ResourceUUID,
+		Status:       string(push.Status),
+		Attempts:     push.Attempts,
+		LastError:    push.LastError,
+		CreatedAt:    push.CreatedAt,
+		DeliveredAt:  push.DeliveredAt,
+	}
+	if push.Status == models.PushPending {
+		resp.Status = "queued"
+		next := push.NextAttemptAt
+		resp.NextAttemptAt = &next
+	}
+	return resp
+}
+
+// HTTP status to answer the front-end with for a push
+func configPushHTTPStatus(push *ConfigPushResponse) int {
+	switch push.Status {
+	case string(models.PushDelivered):
+		return http.StatusOK
+	case string(models.PushFailed):
+		return http.StatusBadGateway
+	}
+	return http.StatusAccepted
+}
+
+// Deliver every queued config push that is due
+func (s *server) dispatchConfigPushes(ctx context.Context) {
+	pushes, err := s.db.ListDueConfigPushes(ctx, time.Now())
+	if err != nil {
+		s.e.Logger.Error("Unable to list config pushes: " + err.Error())
+		return
+	}
+
+	for i := range pushes {
+		if ctx.Err() != nil {
+			return
+		}
+		err = s.deliverConfigPush(ctx, &pushes[i])
+		if err != nil {
+			s.e.Logger.Error("Unable to record config push for " + pushes[i].ResourceUUID + ": " + err.Error())
+		}
+	}
+}
+
+// Make one attempt at sending a queued push to DigitalOcean and record the
+// outcome on push. Pushes for a resource are sent one at a time, newest only,
+// so an older push can never overwrite a newer one. The returned error is only
+// set if the outcome could not be recorded.
+func (s *server) deliverConfigPush(ctx context.Context, push *models.ConfigPush) error {
+	// Fetched up front, as a refresh must not run inside the transaction below
+	token, tokenErr := s.getAccessToken(ctx, push.ResourceUUID)
+
+	return s.db.InTx(ctx, func(tx store.Store) error {
+		latest, err := tx.LockLatestConfigPush(ctx, push.ResourceUUID)
+		if err != nil {
+			return err
+		}
+		if latest.Id != push.Id {
+			push.Status = models.PushSuperseded
+			return nil
+		}
+		*push = *latest
+		if push.Status != models.PushPending {
+			// Someone else delivered it while we waited for the lock
+			return nil
+		}
+
+		err = tokenErr
+		if err == nil {
+			err = s.api.UpdateConfig(ctx, token, push.ResourceUUID, push.Config)
+		}
+		s.recordConfigPushAttempt(push, err)
+
+		return tx.UpdateConfigPush(ctx, push)
+	})
+}
+
+// Update push with the outcome of an attempt to send it. Failed pushes are
+// retried with backoff, unless DigitalOcean rejected the config itself or
+// retries ran out.
+func (s *server) recordConfigPushAttempt(push *models.ConfigPush, err error) {
+	push.Attempts++
+	now := time.Now()
+	if err == nil {
+		push.Status = models.PushDelivered
+		push.DeliveredAt = &now
+		push.LastError = ""
+		return
+	}
+
+	s.e.Logger.Error("Unable to push config for " + push.ResourceUUID + ": " + err.Error())
+	push.LastError = err.Error()
+	if !retryableAPIError(err) || push.Attempts >= s.config.configPushAttempts {
+		push.Status = models.PushFailed
+		return
+	}
+	push.NextAttemptAt = now.Add(backoffDelay(s.config.configPushBackoff, push.Attempts, maxRetryDelay))
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"sample_app/models"
+	"testing"
+)
+
+func TestConfigPushRetries(t *testing.T) {
+	ts := newTestServer(t)
+	ts.config.configPushBackoff = 0
+	ctx := context.Background()
+	r := testResource("e1d2c3b4-a596-4877-8695-a4b3c2d1e0f9")
+	ts.provision(t, r)
+
+	edit := func(apiURL string) *ConfigPushResponse {
+		t.Helper()
+		resp, err := ts.editConfig(ctx, r.UUID, &ConfigEditRequest{Set: map[string]string{"API_URL": apiURL}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Push == nil {
+			t.Fatalf("setting API_URL to %s pushed nothing", apiURL)
+		}
+		return resp.Push
+	}
+	latest := func() *models.ConfigPush {
+		t.Helper()
+		push, err := ts.db.GetLatestConfigPush(ctx, r.UUID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return push
+	}
+
+	// A push DigitalOcean did not take is queued and sent by the worker
+	ts.api.FailConfigUpdates(1)
+	push := edit("https://one.example.com")
+	if push.Status != "queued" || push.Attempts != 1 || push.LastError == "" {
+		t.Fatalf("push during an outage: %+v, want queued after one attempt", push)
+	}
+	ts.dispatchConfigPushes(ctx)
+	if got := latest(); got.Status != models.PushDelivered || got.Attempts != 2 {
+		t.Errorf("push after the outage: %+v, want delivered on the second attempt", got)
+	}
+	if apiURL := ts.api.Config(r.UUID)["API_URL"]; apiURL != "https://one.example.com" {
+		t.Errorf("DigitalOcean has API_URL %q, want the one set", apiURL)
+	}
+
+	// Only the newest of several queued pushes is sent
+	ts.api.FailConfigUpdates(2)
+	edit("https://two.example.com")
+	edit("https://three.example.com")
+	ts.dispatchConfigPushes(ctx)
+	if apiURL := ts.api.Config(r.UUID)["API_URL"]; apiURL != "https://three.example.com" {
+		t.Errorf("DigitalOcean has API_URL %q, want the newest", apiURL)
+	}
+	if got := latest(); got.Status != models.PushDelivered || got.Config["API_URL"] != "https://three.example.com" {
+		t.Errorf("newest push: %+v, want it delivered", got)
+	}
+
+	// Pushes fail for good once attempts run out
+	ts.config.configPushAttempts = 2
+	ts.api.FailConfigUpdates(5)
+	edit("https://four.example.com")
+	ts.dispatchConfigPushes(ctx)
+	if got := latest(); got.Status != models.PushFailed || got.Attempts != 2 {
+		t.Errorf("push after running out of attempts: %+v, want failed after 2", got)
+	}
+	ts.dispatchConfigPushes(ctx)
+	if got := latest(); got.Attempts != 2 {
+		t.Errorf("failed push was attempted again, %d attempts", got.Attempts)
+	}
+
+	// As DigitalOcean's config is then unknown, the same edit is pushed again
+	ts.api.FailConfigUpdates(0)
+	if push = edit("https://four.example.com"); push.Status != string(models.PushDelivered) {
+		t.Errorf("repeated edit after a failed push: %+v, want it delivered", push)
+	}
+}
@@ -0,0 +1,390 @@
+package server
+
+import (
+	"context"
+	"sample_app/internal/catalog"
+	"sample_app/internal/store"
+	"sample_app/models"
+	"sort"
+	"time"
+)
+
+// Longest value a config var may be set to
+const maxConfigVarLength = 4096
+
+// Changes to a resource's config vars. Each var may only be named once.
+type ConfigEditRequest struct {
+	// Values to set vars to. Vars set by hand keep their value until they
+	// are unset or rotated.
+	Set map[string]string `json:"set"`
+
+	// Vars to put back to what their template gives
+	Unset []string `json:"unset"`
+
+	// Vars to render again, generating new secrets or a new license key
+	Rotate []string `json:"rotate"`
+}
+
+// A resource's config vars and the push carrying them to DigitalOcean
+type ConfigResponse struct {
+	ResourceUUID string            `json:"resource_uuid"`
+	Config       map[string]string `json:"config"`
+
+	// Names of the vars that were set by hand
+	Pinned []string `json:"pinned"`
+
+	// The latest push, or nil if DigitalOcean already had this config
+	Push *ConfigPushResponse `json:"push"`
+}
+
+func newConfigResponse(uuid string, vars []models.ConfigVar, push *models.ConfigPush) *ConfigResponse {
+	resp := &ConfigResponse{
+		ResourceUUID: uuid,
+		Config:       configVarMap(vars),
+		Pinned:       []string{},
+	}
+	for _, v := range vars {
+		if v.Pinned {
+			resp.Pinned = append(resp.Pinned, v.Name)
+		}
+	}
+	if push != nil {
+		resp.Push = newConfigPushResponse(push)
+	}
+	return resp
+}
+
+// Returned when a config edit asks for something the plan's templates do not
+// allow. Vars lists what is wrong with each var.
+type InvalidConfigError struct {
+	Message string           `json:"message"`
+	Vars    []ConfigVarError `json:"errors,omitempty"`
+}
+
+type ConfigVarError struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+func (e *InvalidConfigError) Error() string {
+	return e.Message
+}
+
+// Apply an edit to a resource's config vars and, if DigitalOcean does not
+// already have the result, push it. The new vars and the push are committed
+// together, so they can never diverge for good. Delivery is attempted straight
+// away, and retried in the background if that fails.
+func (s *server) editConfig(ctx context.Context, uuid string, req *ConfigEditRequest) (*ConfigResponse, error) {
+	var vars []models.ConfigVar
+	var push *models.ConfigPush
+	err := s.db.InTx(ctx, func(tx store.Store) error {
+		account, err := tx.GetAccount(ctx, uuid)
+		if err == store.ErrNotFound || (err == nil && account.Deprovisioned()) {
+			return &NotFoundError{}
+		} else if err != nil {
+			return err
+		}
+		if account.OAuthState == models.OAuthFailed {
+			// Without tokens the push could never be delivered
+			return &NoGrantError{}
+		}
+
+		plan, err := s.catalog.Current().Plan(account.AppSlug, account.PlanSlug)
+		if err != nil {
+			return err
+		}
+		rotate, err := checkConfigEdit(req, plan.ConfigTemplates())
+		if err != nil {
+			return err
+		}
+
+		current, err := tx.ListConfigVars(ctx, uuid)
+		if err != nil {
+			return err
+		}
+		unset := map[string]bool{}
+		for _, name := range req.Unset {
+			unset[name] = true
+		}
+		edited := []models.ConfigVar{}
+		for _, v := range current {
+			_, set := req.Set[v.Name]
+			if !set && !unset[v.Name] {
+				edited = append(edited, v)
+			}
+		}
+		for name, value := range req.Set {
+			edited = append(edited, models.ConfigVar{Name: name, Value: value, Pinned: true})
+		}
+
+		if rotatesLicenseKey(rotate, plan.ConfigTemplates()) {
+			licenseKey, expiresAt, err := s.newLicenseKey(account.ResourceUUID, account.AppSlug, account.PlanSlug)
+			if err != nil {
+				return err
+			}
+			err = s.updateLicenseKey(ctx, tx, licenseKey, expiresAt, uuid)
+			if err != nil {
+				return err
+			}
+			account.LicenseKey = licenseKey
+		}
+
+		vars, err = s.renderConfigVars(account, edited, rotate)
+		if err != nil {
+			return err
+		}
+
+		// Only picked up by the dispatcher if the attempt below does not get to it
+		push, err = s.applyConfigVars(ctx, tx, uuid, current, vars, s.config.configPushBackoff)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if push != nil {
+		err = s.deliverConfigPush(ctx, push)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newConfigResponse(uuid, vars, push), nil
+}
+
+// Look up a resource's config vars and the latest push of them
+func (s *server) configStatus(ctx context.Context, uuid string) (*ConfigResponse, error) {
+	account, err := s.db.GetAccount(ctx, uuid)
+	if err == store.ErrNotFound || (err == nil && account.Deprovisioned()) {
+		return nil, &NotFoundError{}
+	} else if err != nil {
+		return nil, err
+	}
+
+	vars, err := s.db.ListConfigVars(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	push, err := s.db.GetLatestConfigPush(ctx, uuid)
+	if err == store.ErrNotFound {
+		push = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return newConfigResponse(uuid, vars, push), nil
+}
+
+// Check an edit against the plan's config var templates, and return the vars
+// it rotates
+func checkConfigEdit(req *ConfigEditRequest, templates map[string]string) (map[string]bool, error) {
+	invalid := []ConfigVarError{}
+	named := map[string]bool{}
+	check := func(name string, message func(template string) string) {
+		template, ok := templates[name]
+		switch {
+		case named[name]:
+			invalid = append(invalid, ConfigVarError{Name: name, Message: "may only be set, unset or rotated once"})
+		case !ok:
+			invalid = append(invalid, ConfigVarError{Name: name, Message: "is not one of the plan's config vars"})
+		default:
+			if m := message(template); m != "" {
+				invalid = append(invalid, ConfigVarError{Name: name, Message: m})
+			}
+		}
+		named[name] = true
+	}
+
+	names := []string{}
+	for name := range req.Set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := req.Set[name]
+		check(name, func(template string) string {
+			switch {
+			case catalog.UsesLicenseKey(template):
+				return "holds the license key, rotate it instead"
+			case value == "":
+				return "cannot be set to an empty value, unset it instead"
+			case len(value) > maxConfigVarLength:
+				return "is too long"
+			}
+			return ""
+		})
+	}
+	for _, name := range req.Unset {
+		check(name, func(template string) string {
+			return ""
+		})
+	}
+	rotate := map[string]bool{}
+	for _, name := range req.Rotate {
+		check(name, func(template string) string {
+			if !catalog.GeneratesSecret(template) && !catalog.UsesLicenseKey(template) {
+				return "has no secret or license key to rotate"
+			}
+			return ""
+		})
+		rotate[name] = true
+	}
+
+	if len(invalid) > 0 {
+		return nil, &InvalidConfigError{Message: "Config edit has invalid vars", Vars: invalid}
+	}
+	return rotate, nil
+}
+
+// Whether rotating the given vars means issuing a new license key
+func rotatesLicenseKey(rotate map[string]bool, templates map[string]string) bool {
+	for name := range rotate {
+		if catalog.UsesLicenseKey(templates[name]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Render an account's config vars from its plan's templates, ordered by name.
+// Vars in current that were set by hand or hold a generated secret keep their
+// value, unless they are named in rotate. Vars the plan has no template for
+// are dropped.
+func (s *server) renderConfigVars(account *models.Account, current []models.ConfigVar, rotate map[string]bool) ([]models.ConfigVar, error) {
+	plan, err := s.catalog.Current().Plan(account.AppSlug, account.PlanSlug)
+	if err != nil {
+		return nil, err
+	}
+	templates := plan.ConfigTemplates()
+
+	existing := map[string]models.ConfigVar{}
+	for _, v := range current {
+		existing[v.Name] = v
+	}
+	names := []string{}
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := catalog.ConfigValues{
+		ResourceUUID: account.ResourceUUID,
+		AppSlug:      account.AppSlug,
+		PlanSlug:     account.PlanSlug,
+		LicenseKey:   account.LicenseKey,
+	}
+	vars := []models.ConfigVar{}
+	for _, name := range names {
+		old, ok := existing[name]
+		if ok && !rotate[name] && (old.Pinned || catalog.GeneratesSecret(templates[name])) {
+			vars = append(vars, models.ConfigVar{Name: name, Value: old.Value, Pinned: old.Pinned})
+			continue
+		}
+
+		value, err := catalog.RenderConfigVar(templates[name], values)
+		if err != nil {
+			return nil, err
+		}
+		vars = append(vars, models.ConfigVar{Name: name, Value: value})
+	}
+	return vars, nil
+}
+
+// Render an account's config vars again and save them without pushing them.
+// Call it from inside a transaction.
+func (s *server) saveConfigVars(ctx context.Context, tx store.Store, account *models.Account) error {
+	current, err := tx.ListConfigVars(ctx, account.ResourceUUID)
+	if err != nil {
+		return err
+	}
+
+	vars, err := s.renderConfigVars(account, current, nil)
+	if err != nil {
+		return err
+	}
+	return tx.SetConfigVars(ctx, account.ResourceUUID, vars)
+}
+
+// Render an account's config vars again, save them and push them if
+// DigitalOcean does not already have them. The push is due after the given
+// delay, and is nil when none was needed. Call it from inside a transaction.
+func (s *server) refreshConfigVars(ctx context.Context, tx store.Store, account *models.Account, delay time.Duration) (*models.ConfigPush, error) {
+	current, err := tx.ListConfigVars(ctx, account.ResourceUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	vars, err := s.renderConfigVars(account, current, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.applyConfigVars(ctx, tx, account.ResourceUUID, current, vars, delay)
+}
+
+// Replace a resource's config vars, which were current, with vars. Unless
+// DigitalOcean already has or is about to get exactly these, queue a push of
+// them due after the given delay. Returns nil when no push was needed.
+func (s *server) applyConfigVars(ctx context.Context, tx store.Store, uuid string, current []models.ConfigVar, vars []models.ConfigVar, delay time.Duration) (*models.ConfigPush, error) {
+	err := tx.SetConfigVars(ctx, uuid, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	sent, err := sentConfig(ctx, tx, uuid, current)
+	if err != nil {
+		return nil, err
+	}
+	config := configVarMap(vars)
+	if sent != nil && configVarsEqual(sent, config) {
+		return nil, nil
+	}
+
+	push := &models.ConfigPush{
+		ResourceUUID:  uuid,
+		Config:        config,
+		NextAttemptAt: time.Now().Add(delay),
+	}
+	err = tx.EnqueueConfigPush(ctx, push)
+	if err != nil {
+		return nil, err
+	}
+	return push, nil
+}
+
+// The config DigitalOcean has for a resource, or will have once its pending
+// push is delivered. Resources that were never pushed to still have the vars
+// they were given at provisioning, which were current. Returns nil when it
+// is not known, e.g. because the latest push failed.
+func sentConfig(ctx context.Context, tx store.Store, uuid string, current []models.ConfigVar) (map[string]string, error) {
+	push, err := tx.GetLatestConfigPush(ctx, uuid)
+	if err == store.ErrNotFound {
+		return configVarMap(current), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if push.Status == models.PushFailed {
+		return nil, nil
+	}
+	return push.Config, nil
+}
+
+func configVarMap(vars []models.ConfigVar) map[string]string {
+	m := make(map[string]string, len(vars))
+	for _, v := range vars {
+		m[v.Name] = v.Value
+	}
+	return m
+}
+
+func configVarsEqual(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		other, ok := b[name]
+		if !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"sample_app/internal/catalog"
+	"testing"
+)
+
+func TestEditConfig(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	r := testResource("9f8e7d6c-5b4a-4392-8170-6f5e4d3c2b1a")
+	account := ts.provision(t, r)
+
+	before, err := ts.configStatus(ctx, r.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Config["API_USERNAME"] != "do-"+r.UUID || before.Config["LICENSE_KEY"] != account.LicenseKey || before.Config["API_SECRET"] == "" {
+		t.Fatalf("provisioned config %v, want it rendered from the basic plan", before.Config)
+	}
+
+	// Set vars keep their value and are pushed
+	resp, err := ts.editConfig(ctx, r.UUID, &ConfigEditRequest{Set: map[string]string{"API_URL": "https://eu.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Config["API_URL"] != "https://eu.example.com" || !reflect.DeepEqual(resp.Pinned, []string{"API_URL"}) || resp.Push == nil {
+		t.Errorf("after setting API_URL: %+v, want it pinned and pushed", resp)
+	}
+	if pushed := ts.api.Config(r.UUID)["API_URL"]; pushed != "https://eu.example.com" {
+		t.Errorf("DigitalOcean has API_URL %q, want the one set", pushed)
+	}
+
+	// Rotating renders only the named vars again
+	resp, err = ts.editConfig(ctx, r.UUID, &ConfigEditRequest{Rotate: []string{"API_SECRET", "LICENSE_KEY"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Config["API_SECRET"] == before.Config["API_SECRET"] || resp.Config["API_URL"] != "https://eu.example.com" {
+		t.Errorf("after rotating: %v, want a new API_SECRET and API_URL kept", resp.Config)
+	}
+	licenseKey := ts.account(t, r.UUID).LicenseKey
+	if licenseKey == account.LicenseKey || resp.Config["LICENSE_KEY"] != licenseKey {
+		t.Errorf("LICENSE_KEY %q after rotating, want the account's new key", resp.Config["LICENSE_KEY"])
+	}
+
+	resp, err = ts.editConfig(ctx, r.UUID, &ConfigEditRequest{Unset: []string{"API_URL"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Config["API_URL"] != before.Config["API_URL"] || len(resp.Pinned) != 0 {
+		t.Errorf("after unsetting API_URL: %+v, want the plan's value back", resp)
+	}
+
+	// Nothing to push when nothing changed
+	resp, err = ts.editConfig(ctx, r.UUID, &ConfigEditRequest{Unset: []string{"API_URL"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Push != nil {
+		t.Errorf("edit changing nothing pushed %+v", resp.Push)
+	}
+
+	_, err = ts.editConfig(ctx, "unknown-uuid", &ConfigEditRequest{Unset: []string{"API_URL"}})
+	if _, ok := err.(*NotFoundError); !ok {
+		t.Errorf("edit of an unknown resource: %v, want not found", err)
+	}
+}
+
+func TestCheckConfigEdit(t *testing.T) {
+	templates := map[string]string{
+		"LICENSE_KEY": "{{license_key}}",
+		"API_URL":     "https://api.example.com",
+		"API_SECRET":  "{{secret}}",
+	}
+
+	tests := []struct {
+		name       string
+		req        ConfigEditRequest
+		wantVars   []string
+		wantRotate map[string]bool
+	}{
+		{"valid", ConfigEditRequest{Set: map[string]string{"API_URL": "x"}, Rotate: []string{"API_SECRET"}}, nil, map[string]bool{"API_SECRET": true}},
+		{"unknown var", ConfigEditRequest{Unset: []string{"COLOUR"}}, []string{"COLOUR"}, nil},
+		{"named twice", ConfigEditRequest{Set: map[string]string{"API_URL": "x"}, Unset: []string{"API_URL"}}, []string{"API_URL"}, nil},
+		{"license key set by hand", ConfigEditRequest{Set: map[string]string{"LICENSE_KEY": "mine"}}, []string{"LICENSE_KEY"}, nil},
+		{"empty value", ConfigEditRequest{Set: map[string]string{"API_URL": ""}}, []string{"API_URL"}, nil},
+		{"nothing to rotate", ConfigEditRequest{Rotate: []string{"API_URL"}}, []string{"API_URL"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rotate, err := checkConfigEdit(&tt.req, templates)
+			if tt.wantVars == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(rotate, tt.wantRotate) {
+					t.Errorf("rotate = %v, want %v", rotate, tt.wantRotate)
+				}
+				return
+			}
+
+			invalid, ok := err.(*InvalidConfigError)
+			if !ok {
+				t.Fatalf("checkConfigEdit() error = %v, want an InvalidConfigError", err)
+			}
+			names := []string{}
+			for _, v := range invalid.Vars {
+				names = append(names, v.Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantVars) {
+				t.Errorf("invalid vars %v, want %v", names, tt.wantVars)
+			}
+		})
+	}
+
+	if !rotatesLicenseKey(map[string]bool{"LICENSE_KEY": true}, templates) || rotatesLicenseKey(map[string]bool{"API_SECRET": true}, templates) {
+		t.Error("rotatesLicenseKey() does not match only vars holding the license key")
+	}
+	if catalog.UsesLicenseKey(templates["API_SECRET"]) {
+		t.Error("API_SECRET uses the license key")
+	}
+}
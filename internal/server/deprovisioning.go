@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"sample_app/internal/store"
+	"time"
 )
 
 // Custom error used specifically to indicate no account was found
@@ -11,32 +13,55 @@ func (e *NotFoundError) Error() string {
 	return "Resource not found"
 }
 
-const (
-	DeactivateAccountSQL = `
-	DELETE FROM accounts 
-	WHERE resource_uuid=$1;
-	`
+// If given a deprovisioning request, mark the account deprovisioned, which
+// revokes its license key, and delete its tokens and any unexchanged
+// authorization code. The rest of the account's data is kept until the
+// retention period runs out. Deprovisioning an account that is already
+// deprovisioned does nothing, and returns false rather than true.
+func (s *server) deprovisionRequest(ctx context.Context, uuid string) (bool, error) {
+	deprovisioned := false
+	err := s.db.InTx(ctx, func(tx store.Store) error {
+		deprovisioned = false
+		account, err := tx.GetAccount(ctx, uuid)
+		if err == store.ErrNotFound {
+			return &NotFoundError{}
+		} else if err != nil {
+			return err
+		}
+		if account.Deprovisioned() {
+			return nil
+		}
+		deprovisioned = true
 
-	DeleteTokenSQL = `
-	DELETE FROM tokens
-	WHERE resource_uuid=$1
-	`
-)
+		err = tx.DeprovisionAccount(ctx, uuid, time.Now())
+		if err != nil {
+			return err
+		}
+
+		err = tx.DeleteOAuthGrant(ctx, uuid)
+		if err != nil {
+			return err
+		}
 
-// If given a deprovisioning request, delete the account's row and token entries
-func (s *server) deprovisionRequest(ctx context.Context, uuid string) error {
-	commandTag, err := s.db.Exec(ctx, DeactivateAccountSQL, uuid)
+		return tx.DeleteTokens(ctx, uuid)
+	})
 	if err != nil {
-		return err
-	}
-	if commandTag.RowsAffected() == 0 {
-		return &NotFoundError{}
+		return false, err
 	}
 
-	_, err = s.db.Exec(ctx, DeleteTokenSQL, uuid)
+	s.entitlementCache.invalidate(uuid)
+	return deprovisioned, nil
+}
+
+// Permanently remove accounts whose retention period has run out
+func (s *server) purgeDeprovisioned(ctx context.Context) {
+	purged, err := s.db.PurgeDeprovisionedAccounts(ctx, time.Now().Add(-s.config.deprovisionRetention))
 	if err != nil {
-		return err
+		s.e.Logger.Error("Unable to purge deprovisioned accounts: " + err.Error())
+		return
 	}
 
-	return nil
+	for _, uuid := range purged {
+		s.e.Logger.Info("Purged deprovisioned account " + uuid)
+	}
 }
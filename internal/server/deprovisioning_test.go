@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sample_app/internal/store"
+	"testing"
+	"time"
+)
+
+func TestPurgeDeprovisioned(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	r := testResource("f0e1d2c3-b4a5-4697-8879-6a5b4c3d2e1f")
+	kept := testResource("a1b2c3d4-e5f6-4788-99aa-bbccddeeff00")
+	ts.provision(t, r)
+	ts.provision(t, kept)
+
+	res, err := ts.sim.Deprovision(ctx, r.UUID)
+	expectStatus(t, "deprovision", res, err, http.StatusOK)
+	account := ts.account(t, r.UUID)
+	if !account.Deprovisioned() {
+		t.Fatalf("account %+v not marked deprovisioned", account)
+	}
+	_, err = ts.db.GetToken(ctx, r.UUID)
+	if err != store.ErrNotFound {
+		t.Errorf("token of a deprovisioned account: %v, want it deleted", err)
+	}
+
+	// Nothing goes within the retention period
+	ts.config.deprovisionRetention = time.Hour
+	ts.purgeDeprovisioned(ctx)
+	ts.account(t, r.UUID)
+	vars, err := ts.db.ListConfigVars(ctx, r.UUID)
+	if err != nil || len(vars) == 0 {
+		t.Errorf("config vars within the retention period: %v, %v, want them kept", vars, err)
+	}
+
+	ts.config.deprovisionRetention = -time.Second
+	ts.purgeDeprovisioned(ctx)
+	_, err = ts.db.GetAccount(ctx, r.UUID)
+	if err != store.ErrNotFound {
+		t.Errorf("account after its retention period: %v, want it purged", err)
+	}
+	vars, err = ts.db.ListConfigVars(ctx, r.UUID)
+	if err != nil || len(vars) != 0 {
+		t.Errorf("config vars after purging: %v, %v, want none", vars, err)
+	}
+	if ts.account(t, kept.UUID).Deprovisioned() {
+		t.Error("live account caught up in the purge")
+	}
+
+	// The resource can be provisioned again from scratch
+	account = ts.provision(t, r)
+	if account.Deprovisioned() {
+		t.Errorf("reprovisioned account %+v still deprovisioned", account)
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// Keeps resolved entitlements for a short while, so product services polling
+// for them do not each cost several queries. Anything that changes what a
+// resource is entitled to invalidates it, which takes effect straight away on
+// this instance. Other instances notice once their entry expires.
+type entitlementCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*entitlementEntry
+
+	// Every invalidation takes the next generation, so a lookup that started
+	// before one cannot store what it read afterwards. Invalidations of cached
+	// resources are recorded against the resource. Others, and clearing, only
+	// move cleared on, which keeps any lookup in flight from being stored.
+	generation  uint64
+	invalidated map[string]uint64
+	cleared     uint64
+}
+
+type entitlementEntry struct {
+	entitlements *Entitlements
+	etag         string
+	expiresAt    time.Time
+}
+
+func newEntitlementCache(ttl time.Duration) *entitlementCache {
+	return &entitlementCache{
+		ttl:         ttl,
+		entries:     map[string]*entitlementEntry{},
+		invalidated: map[string]uint64{},
+	}
+}
+
+// Return the cached entry for uuid, if it has not expired, and otherwise the
+// generation to pass to put once the entitlements have been resolved
+func (c *entitlementCache) get(uuid string) (*entitlementEntry, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[uuid]
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry, 0
+	}
+	delete(c.entries, uuid)
+	return nil, c.generation
+}
+
+// Cache an entry, unless uuid was invalidated since get returned generation
+func (c *entitlementCache) put(uuid string, generation uint64, entry *entitlementEntry) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation < c.cleared || generation < c.invalidated[uuid] {
+		return
+	}
+	entry.expiresAt = time.Now().Add(c.ttl)
+	c.entries[uuid] = entry
+}
+
+// Forget what is cached for uuid. Call it after the change has been committed.
+func (c *entitlementCache) invalidate(uuid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if _, ok := c.entries[uuid]; ok {
+		delete(c.entries, uuid)
+		c.invalidated[uuid] = c.generation
+	} else {
+		delete(c.invalidated, uuid)
+		c.cleared = c.generation
+	}
+}
+
+// Forget everything, e.g. after the plan catalog changes
+func (c *entitlementCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.entries = map[string]*entitlementEntry{}
+	c.invalidated = map[string]uint64{}
+	c.cleared = c.generation
+}
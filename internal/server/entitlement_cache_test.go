@@ -0,0 +1,70 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEntitlementCacheInvalidation(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// Run between the lookup starting and storing what it read
+		change func(c *entitlementCache)
+		stored bool
+	}{
+		{"nothing changed", func(c *entitlementCache) {}, true},
+		{"resource invalidated", func(c *entitlementCache) { c.invalidate("uuid") }, false},
+		{"cached resource invalidated", func(c *entitlementCache) {
+			c.put("uuid", 0, &entitlementEntry{etag: "stale"})
+			c.invalidate("uuid")
+		}, false},
+		{"other cached resource invalidated", func(c *entitlementCache) {
+			_, generation := c.get("other")
+			c.put("other", generation, &entitlementEntry{})
+			c.invalidate("other")
+		}, true},
+		{"cleared", func(c *entitlementCache) { c.clear() }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newEntitlementCache(time.Minute)
+			_, generation := c.get("uuid")
+			tt.change(c)
+			c.put("uuid", generation, &entitlementEntry{etag: "looked up"})
+
+			entry, _ := c.get("uuid")
+			if tt.stored && (entry == nil || entry.etag != "looked up") {
+				t.Errorf("entry = %+v, want the lookup stored", entry)
+			} else if !tt.stored && entry != nil {
+				t.Errorf("entry = %+v, want nothing stored", entry)
+			}
+		})
+	}
+}
+
+// Invalidations are only remembered per resource while they could matter
+func TestEntitlementCacheForgetsInvalidations(t *testing.T) {
+	c := newEntitlementCache(time.Minute)
+	for _, uuid := range []string{"a", "b", "c"} {
+		_, generation := c.get(uuid)
+		c.put(uuid, generation, &entitlementEntry{})
+		c.invalidate(uuid)
+	}
+	if len(c.invalidated) != 3 {
+		t.Fatalf("%d invalidations remembered, want 3", len(c.invalidated))
+	}
+
+	// Nothing is cached for a any more
+	c.invalidate("a")
+	c.invalidate("unknown")
+	if len(c.invalidated) != 2 {
+		t.Errorf("%d invalidations remembered, want 2", len(c.invalidated))
+	}
+
+	c.clear()
+	if len(c.invalidated) != 0 {
+		t.Errorf("%d invalidations remembered after clearing, want 0", len(c.invalidated))
+	}
+}
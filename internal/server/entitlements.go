@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sample_app/internal/catalog"
+	"sample_app/internal/store"
+	"sample_app/models"
+	"sort"
+	"time"
+)
+
+// What a resource is allowed to do right now
+type Entitlements struct {
+	ResourceUUID string `json:"resource_uuid"`
+	AppSlug      string `json:"app_slug"`
+	PlanSlug     string `json:"plan_slug"`
+	Status       string `json:"status"`
+
+	// Features the resource may use, sorted by name
+	Features []string `json:"features"`
+
+	// Numeric limits by name. Suspended resources have every limit at zero.
+	Limits map[string]int64 `json:"limits"`
+
+	// Version of the plan catalog the entitlements were resolved against
+	CatalogVersion int `json:"catalog_version"`
+}
+
+// The body of a request to set an override. Enabled is used by feature
+// overrides and Limit by limit overrides.
+type EntitlementOverrideRequest struct {
+	Enabled bool   `json:"enabled"`
+	Limit   int64  `json:"limit"`
+	Reason  string `json:"reason"`
+}
+
+type EntitlementOverrideResponse struct {
+	Kind      models.OverrideKind `json:"kind"`
+	Name      string              `json:"name"`
+	Enabled   *bool               `json:"enabled,omitempty"`
+	Limit     *int64              `json:"limit,omitempty"`
+	Reason    string              `json:"reason"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+func newEntitlementOverrideResponse(o *models.EntitlementOverride) *EntitlementOverrideResponse {
+	resp := &EntitlementOverrideResponse{
+		Kind:      o.Kind,
+		Name:      o.Name,
+		Reason:    o.Reason,
+		CreatedAt: o.CreatedAt,
+	}
+	if o.Kind == models.LimitOverride {
+		resp.Limit = &o.Limit
+	} else {
+		resp.Enabled = &o.Enabled
+	}
+	return resp
+}
+
+// Returned when an override is not one we know how to apply
+type InvalidOverrideError struct {
+	Message string
+}
+
+func (e *InvalidOverrideError) Error() string {
+	return e.Message
+}
+
+// Look up the entitlements for a resource, and an ETag identifying them
+func (s *server) entitlements(ctx context.Context, uuid string) (*Entitlements, string, error) {
+	entry, generation := s.entitlementCache.get(uuid)
+	if entry != nil {
+		return entry.entitlements, entry.etag, nil
+	}
+
+	account, err := s.db.GetAccount(ctx, uuid)
+	if err == store.ErrNotFound || (err == nil && account.Deprovisioned()) {
+		return nil, "", &NotFoundError{}
+	} else if err != nil {
+		return nil, "", err
+	}
+	overrides, err := s.db.ListEntitlementOverrides(ctx, uuid)
+	if err != nil {
+		return nil, "", err
+	}
+
+	entitlements := s.resolveEntitlements(account, overrides, s.catalog.Current())
+	etag, err := entitlementsETag(entitlements)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.entitlementCache.put(uuid, generation, &entitlementEntry{entitlements: entitlements, etag: etag})
+	return entitlements, etag, nil
+}
+
+// Look up the entitlements for whoever holds a license key. Keys replaced
+// within their grace period are still accepted.
+func (s *server) entitlementsForLicenseKey(ctx context.Context, licenseKey string) (*Entitlements, string, error) {
+	key, err := s.lookupLicenseKey(ctx, licenseKey)
+	if err == store.ErrNotFound || (err == nil && !key.Accepted(time.Now())) {
+		return nil, "", &NotFoundError{}
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	return s.entitlements(ctx, key.ResourceUUID)
+}
+
+// Combine the account's plan with its overrides. Suspended accounts keep the
+// names of their limits but get no features and nothing to spend.
+func (s *server) resolveEntitlements(account *models.Account, overrides []models.EntitlementOverride, c *catalog.Catalog) *Entitlements {
+	entitlements := &Entitlements{
+		ResourceUUID:   account.ResourceUUID,
+		AppSlug:        account.AppSlug,
+		PlanSlug:       account.PlanSlug,
+		Status:         statusName(account.Status),
+		Features:       []string{},
+		Limits:         map[string]int64{},
+		CatalogVersion: c.Version,
+	}
+
+	features := map[string]bool{}
+	plan, err := c.Plan(account.AppSlug, account.PlanSlug)
+	if err != nil {
+		// Grant nothing rather than guess
+		s.e.Logger.Warn("No entitlements for " + account.ResourceUUID + ": " + err.Error())
+	} else {
+		for _, feature := range plan.Features {
+			features[feature] = true
+		}
+		for name, limit := range plan.Limits {
+			entitlements.Limits[name] = limit
+		}
+	}
+
+	for _, override := range overrides {
+		switch override.Kind {
+		case models.FeatureOverride:
+			features[override.Name] = override.Enabled
+		case models.LimitOverride:
+			entitlements.Limits[override.Name] = override.Limit
+		}
+	}
+
+	if account.Status == models.Suspended {
+		for name := range entitlements.Limits {
+			entitlements.Limits[name] = 0
+		}
+		return entitlements
+	}
+
+	for feature, enabled := range features {
+		if enabled {
+			entitlements.Features = append(entitlements.Features, feature)
+		}
+	}
+	sort.Strings(entitlements.Features)
+	return entitlements
+}
+
+// A strong ETag derived from the entitlements themselves, so it only changes
+// when they do
+func entitlementsETag(entitlements *Entitlements) (string, error) {
+	body, err := json.Marshal(entitlements)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// The name DigitalOcean uses for a status
+func statusName(status models.Status) string {
+	if status == models.Suspended {
+		return "suspended"
+	}
+	return "active"
+}
+
+// Save an override for a live account
+func (s *server) setEntitlementOverride(ctx context.Context, override *models.EntitlementOverride) error {
+	switch override.Kind {
+	case models.FeatureOverride:
+	case models.LimitOverride:
+		if override.Limit < 0 {
+			return &InvalidOverrideError{Message: "Limits cannot be negative"}
+		}
+	default:
+		return &InvalidOverrideError{Message: "Unknown override kind \"" + string(override.Kind) + "\", expected feature or limit"}
+	}
+	if override.Name == "" {
+		return &InvalidOverrideError{Message: "Overrides need a name"}
+	}
+
+	err := s.db.InTx(ctx, func(tx store.Store) error {
+		account, err := tx.GetAccount(ctx, override.ResourceUUID)
+		if err == store.ErrNotFound || (err == nil && account.Deprovisioned()) {
+			return &NotFoundError{}
+		} else if err != nil {
+			return err
+		}
+
+		return tx.SetEntitlementOverride(ctx, override)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.entitlementCache.invalidate(override.ResourceUUID)
+	return nil
+}
+
+// Remove an override, putting the account back to what its plan gives it
+func (s *server) deleteEntitlementOverride(ctx context.Context, uuid string, kind models.OverrideKind, name string) error {
+	err := s.db.DeleteEntitlementOverride(ctx, uuid, kind, name)
+	if err == store.ErrNotFound {
+		return &NotFoundError{}
+	} else if err != nil {
+		return err
+	}
+
+	s.entitlementCache.invalidate(uuid)
+	return nil
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sample_app/internal/dosim"
+	"sample_app/models"
+	"testing"
+)
+
+func TestEntitlements(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	r := testResource("8c7b6a59-4837-4261-9f0e-8d7c6b5a4938")
+	ts.provision(t, r)
+
+	entitlements, etag, err := ts.entitlements(ctx, r.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entitlements.Features, []string{"dashboard"}) || entitlements.Limits["seats"] != 1 {
+		t.Fatalf("basic plan entitlements %+v, want the dashboard and one seat", entitlements)
+	}
+
+	// Overrides take effect straight away, despite the cache
+	for _, override := range []*models.EntitlementOverride{
+		{ResourceUUID: r.UUID, Kind: models.FeatureOverride, Name: "api_access", Enabled: true},
+		{ResourceUUID: r.UUID, Kind: models.FeatureOverride, Name: "dashboard", Enabled: false},
+		{ResourceUUID: r.UUID, Kind: models.LimitOverride, Name: "seats", Limit: 5},
+	} {
+		err = ts.setEntitlementOverride(ctx, override)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	entitlements, overriddenETag, err := ts.entitlements(ctx, r.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entitlements.Features, []string{"api_access"}) || entitlements.Limits["seats"] != 5 || entitlements.Limits["projects"] != 3 {
+		t.Errorf("overridden entitlements %+v, want api_access, 5 seats and the plan's 3 projects", entitlements)
+	}
+	if overriddenETag == etag {
+		t.Error("ETag did not change with the entitlements")
+	}
+
+	res, err := ts.sim.NotifyResources(ctx, dosim.Suspended, []string{r.UUID})
+	expectStatus(t, "suspend", res, err, http.StatusOK)
+	entitlements, _, err = ts.entitlements(ctx, r.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entitlements.Status != "suspended" || len(entitlements.Features) != 0 || entitlements.Limits["seats"] != 0 {
+		t.Errorf("suspended entitlements %+v, want no features and zero limits", entitlements)
+	}
+
+	_, _, err = ts.entitlements(ctx, "unknown-uuid")
+	if _, ok := err.(*NotFoundError); !ok {
+		t.Errorf("entitlements of an unknown resource: %v, want not found", err)
+	}
+}
+
+func TestInvalidEntitlementOverrides(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	r := testResource("1f2e3d4c-5b6a-4798-8a9b-0c1d2e3f4a5b")
+	ts.provision(t, r)
+
+	tests := []struct {
+		name     string
+		override models.EntitlementOverride
+	}{
+		{"unknown kind", models.EntitlementOverride{ResourceUUID: r.UUID, Kind: "quota", Name: "seats"}},
+		{"negative limit", models.EntitlementOverride{ResourceUUID: r.UUID, Kind: models.LimitOverride, Name: "seats", Limit: -1}},
+		{"no name", models.EntitlementOverride{ResourceUUID: r.UUID, Kind: models.FeatureOverride, Enabled: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ts.setEntitlementOverride(ctx, &tt.override)
+			if _, ok := err.(*InvalidOverrideError); !ok {
+				t.Errorf("setEntitlementOverride() = %v, want an InvalidOverrideError", err)
+			}
+		})
+	}
+
+	err := ts.setEntitlementOverride(ctx, &models.EntitlementOverride{ResourceUUID: "unknown-uuid", Kind: models.FeatureOverride, Name: "api_access"})
+	if _, ok := err.(*NotFoundError); !ok {
+		t.Errorf("override of an unknown resource: %v, want not found", err)
+	}
+}
+
+// Product services revalidate with the ETag and only get a body when the
+// entitlements changed
+func TestEntitlementsETag(t *testing.T) {
+	ts := newTestServer(t)
+	ts.config.serviceAPIKey = "service-key"
+	r := testResource("5a4b3c2d-1e0f-4a9b-8c7d-6e5f4a3b2c1d")
+	account := ts.provision(t, r)
+
+	get := func(path string, ifNoneMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer service-key")
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		ts.e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/entitlements/"+r.UUID, "")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("got %d with ETag %q, want 200 with an ETag", rec.Code, etag)
+	}
+
+	rec = get("/entitlements/"+r.UUID, `"stale", `+etag)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("revalidation got %d, want 304 without a body", rec.Code)
+	}
+
+	// Looking up by license key gives the same entitlements
+	rec = get("/entitlements?license_key="+url.QueryEscape(account.LicenseKey), "")
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != etag {
+		t.Errorf("lookup by license key got %d with ETag %q, want 200 with %q", rec.Code, rec.Header().Get("ETag"), etag)
+	}
+
+	err := ts.setEntitlementOverride(context.Background(), &models.EntitlementOverride{ResourceUUID: r.UUID, Kind: models.LimitOverride, Name: "seats", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = get("/entitlements/"+r.UUID, etag)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("revalidation after a change got %d with ETag %q, want 200 with a new ETag", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	rec = get("/entitlements?license_key=made-up", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown license key got %d, want 404", rec.Code)
+	}
+}
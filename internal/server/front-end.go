@@ -7,23 +7,27 @@ package server
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
-	"fmt"
+	"sample_app/models"
 	"time"
-
-	"github.com/golang-jwt/jwt"
 )
 
 /**
- * This is what our sample front-end will send to this app when someone tries signing in
+ * This is what our sample front-end will send to this app to exchange the code
+ * from an SSO redirect for a session
+ */
+type SessionRequest struct {
+	Code string `json:"code"`
+}
+
+/**
+ * This is what our sample front-end will send to switch to another of the team's resources
  */
-type AuthorizeRequest struct {
-	Secret string `json:"secret"`
+type SwitchResourceRequest struct {
+	ResourceUUID string `json:"resource_uuid"`
 }
 
 /**
- * This is what our smaple front-end will expect to get back from an authorize request
+ * This is what our smaple front-end will expect to get back about the account it is signed in to
  */
 type AuthorizeResponse struct {
 	AccessToken  string    `json:"access_token"`
@@ -34,96 +38,34 @@ type AuthorizeResponse struct {
 	ModifiedAt   time.Time `json:"modified_at"`
 	ResourceUUID string    `json:"resource_uuid"`
 	Message      string    `json:"message"`
-}
-
-const (
-	GetAccountDataSQL = `
-	SELECT email, app_slug, plan_slug, created_at, modified_at FROM accounts WHERE resource_uuid=$1;
-	`
-)
-
-// Create and sign a JWT with a secret salt to give front-end in order to
-// verify authorization of a user
-func getJWT(salt string, uuid string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"iat":  time.Now().Unix(),
-		"exp":  time.Now().Add(time.Minute * 15).Unix(),
-		"uuid": uuid,
-	})
-
-	// Sign and get the complete encoded token as a string using the salt
-	tokenString, err := token.SignedString(salt)
-
-	return tokenString, err
-}
-
-// Check that a given JWT is still valid and untampered with
-func validateToken(tokenString string, salt string) (bool, error) {
-	// Parse the given token to ensure it is signed correctly and unmodified
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-
-		return salt, nil
-	})
-
-	if err != nil {
-		return false, err
-	}
 
-	// Verify token is still valid and unexpired
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims.VerifyExpiresAt(time.Now().Unix(), true), nil
-	} else {
-		return false, nil
-	}
+	// The resource's team, for switching between its resources. Omitted for
+	// resources provisioned before we kept track of teams.
+	Team *TeamResponse `json:"team,omitempty"`
 }
 
-// Construct a response to an auth request from the front-end
-func (s *server) buildAuthResponse(ctx context.Context, req *AuthorizeRequest) ([]byte, error) {
-	claims, err := getClaims(req.Secret, s.config.appSalt)
-
+// Describe a signed in account to the front-end
+func (s *server) authResponse(ctx context.Context, account *models.Account) (*AuthorizeResponse, error) {
+	accessToken, err := s.getAccessToken(ctx, account.ResourceUUID)
 	if err != nil {
 		return nil, err
 	}
 
-	uuid := string(claims["uuid"].(string))
-	accessToken, err := s.getAccessToken(ctx, uuid)
-	if err != nil {
-		return nil, err
+	resp := &AuthorizeResponse{
+		AccessToken:  accessToken,
+		Email:        account.Email,
+		AppSlug:      account.AppSlug,
+		PlanSlug:     account.PlanSlug,
+		CreatedAt:    account.CreatedAt,
+		ModifiedAt:   account.ModifiedAt,
+		ResourceUUID: account.ResourceUUID,
+		Message:      "Welcome to your dashboard!",
 	}
-
-	resp := &AuthorizeResponse{}
-	err = s.db.QueryRow(ctx, GetAccountDataSQL, uuid).Scan(resp)
-	if err != nil {
-		return nil, err
-	}
-
-	resp.AccessToken = accessToken
-	resp.Message = "Welcome to your dashboard!"
-	resp.ResourceUUID = uuid
-
-	respJson, err := json.Marshal(resp)
-	return respJson, err
-}
-
-func getClaims(tokenString string, salt string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	if account.TeamId != "" {
+		resp.Team, err = s.team(ctx, account.TeamId)
+		if err != nil {
+			return nil, err
 		}
-
-		return salt, nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
-	} else {
-		return nil, errors.New("invalid JWT")
 	}
+	return resp, nil
 }
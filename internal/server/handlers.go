@@ -5,7 +5,14 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
+	"sample_app/internal/license"
+	"sample_app/internal/store"
+	"sample_app/models"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
@@ -14,6 +21,61 @@ type ErrorResponse struct {
 	Message string `json:"message"`
 }
 
+type NotificationResponse struct {
+	Warnings []string `json:"warnings"`
+}
+
+// Public endpoints
+
+// Publish the public keys license keys are signed with, as a JSON Web Key
+// Set, so our product can verify license keys offline
+func (s *server) licenseKeysHandler(c echo.Context) error {
+	keys := []license.PublicKey{}
+	if s.licenses != nil {
+		keys = s.licenses.PublicKeys()
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+// Tell whoever holds a license key, such as a customer's deployment of our
+// product, whether it is valid and what it is entitled to. Lookups are limited
+// per client IP and per key.
+func (s *server) verifyLicenseHandler(c echo.Context) error {
+	req := &LicenseVerifyRequest{}
+	err := c.Bind(req)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "malformed request: "+err.Error())
+	}
+	if req.LicenseKey == "" {
+		return c.String(http.StatusBadRequest, "license_key is required")
+	}
+	if len(req.LicenseKey) > maxLicenseKeyLength {
+		return c.String(http.StatusBadRequest, "license_key is too long")
+	}
+
+	remoteIP := c.RealIP()
+	if ok, wait := s.verifyIPLimiter.allow(remoteIP); !ok {
+		return tooManyRequests(c, wait)
+	}
+	if ok, wait := s.verifyKeyLimiter.allow(req.LicenseKey); !ok {
+		return tooManyRequests(c, wait)
+	}
+
+	resp, err := s.verifyLicense(context.Background(), req.LicenseKey, remoteIP)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Turn away a rate limited client, telling it when to try again
+func tooManyRequests(c echo.Context, wait time.Duration) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return c.JSON(http.StatusTooManyRequests, &ErrorResponse{Message: "Too many requests"})
+}
+
 // DigitalOcean endpoints
 
 // DigitalOcean will send a provisioning request when a user adds
@@ -39,11 +101,14 @@ func (s *server) provisionHandler(c echo.Context) error {
 	}
 
 	// Trade in the authorization code provided with the provisioning request
-	// for a longer-lived access token and permanent refresh token
-	err = s.tradeAuthCode(ctx, req.OauthGrant, req.ResourceUUID)
-	if err != nil {
-		s.e.Logger.Info("Error while trading auth code: " + err.Error())
-	}
+	// for a longer-lived access token and permanent refresh token. It was
+	// queued with the account, so failed attempts are retried in the background.
+	go func() {
+		err := s.exchangeAuthCode(context.Background(), req.ResourceUUID)
+		if err != nil {
+			s.e.Logger.Error("Unable to exchange authorization code for " + req.ResourceUUID + ": " + err.Error())
+		}
+	}()
 
 	// Return a successful response
 	return c.JSON(http.StatusOK, resp)
@@ -57,7 +122,7 @@ func (s *server) deprovisionHandler(c echo.Context) error {
 	s.e.Logger.Info("Got deprovision request for " + uuid)
 
 	// Deprovision this account
-	err := s.deprovisionRequest(context.Background(), uuid)
+	_, err := s.deprovisionRequest(context.Background(), uuid)
 	if err != nil {
 		s.e.Logger.Info("Got " + err.Error())
 		_, ok := err.(*NotFoundError)
@@ -168,7 +233,7 @@ func (s *server) notificationHandler(c echo.Context) error {
 	}
 
 	// Pass to the relevant handler
-	errs := s.parseNotification(context.Background(), n)
+	warnings, errs := s.parseNotification(context.Background(), n)
 
 	if len(errs) > 0 {
 		resp := &ErrorResponse{
@@ -177,6 +242,10 @@ func (s *server) notificationHandler(c echo.Context) error {
 		// Return a 422 with message if errors occur
 		return c.JSON(http.StatusUnprocessableEntity, resp)
 	}
+	if len(warnings) > 0 {
+		// The notification was applied, except for the parts skipped
+		return c.JSON(http.StatusOK, &NotificationResponse{Warnings: warnings})
+	}
 	// Return a successful response
 	return c.NoContent(http.StatusOK)
 }
@@ -202,64 +271,593 @@ func (s *server) ssoHandler(c echo.Context) error {
 		return c.NoContent(http.StatusUnauthorized)
 	}
 
+	// Suspended accounts may not sign in
+	account, err := s.checkActive(context.Background(), req.ResourceUUID)
+	if err != nil {
+		switch err.(type) {
+		case *NotFoundError:
+			return c.NoContent(http.StatusNotFound)
+		case *SuspendedError:
+			return c.JSON(http.StatusForbidden, &ErrorResponse{Message: err.Error()})
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
 	// Redirect the user to your homepage.
-	// Because this example uses a separate front-end, we create
-	// a token with the app salt to add as a query parameter. This gets
-	// passed to the front-end as part of the redirect, and the front-end will
-	// validate it to log the user in.
-	token, err := getJWT(s.config.appSalt, req.ResourceUUID)
+	// Because this example uses a separate front-end, we create a
+	// single-use code to add as a query parameter. This gets passed to the
+	// front-end as part of the redirect, and the front-end exchanges it for a
+	// session cookie to log the user in. The code is useless once exchanged,
+	// so it does no harm in browser history or logs.
+	code, err := s.issueSSOCode(context.Background(), account)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
-	c.Response().Header().Set("Location", s.config.appHomepage+"?secret="+token)
+	c.Response().Header().Set("Location", s.config.appHomepage+"?code="+code)
 	return c.NoContent(http.StatusTemporaryRedirect)
 }
 
-// Vendor endpoints: for use by this example's front-end
+// Session endpoints: called by this example's front-end from the browser,
+// which holds the session cookie
 
-// Called by the front end to verify a given authorization token and
-// log a user in. The front-end's half of the SSO request above.
-func (s *server) authorizeHandler(c echo.Context) error {
-	// Validate the given token
-	req := &AuthorizeRequest{}
+// Exchange the code from an SSO redirect for a session, delivered as a
+// cookie. The front-end's half of the SSO request above.
+func (s *server) createSessionHandler(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "no-store")
+	req := &SessionRequest{}
 	err := c.Bind(req)
 	if err != nil {
 		return c.String(http.StatusBadRequest, "malformed request: "+err.Error())
 	}
 
-	authorized, err := validateToken(req.Secret, s.config.appSalt)
+	ctx := context.Background()
+	token, session, account, err := s.startSession(ctx, req.Code)
+	if err != nil {
+		return s.sessionError(c, err)
+	}
+	c.SetCookie(s.sessionCookie(token, session.ExpiresAt))
+
+	res, err := s.authResponse(ctx, account)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
+	return c.JSON(http.StatusOK, res)
+}
 
-	// If it is invalid, return a 401
-	if !authorized {
-		return c.NoContent(http.StatusUnauthorized)
+// Describe the account the session is signed in to
+func (s *server) sessionHandler(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "no-store")
+	ctx := context.Background()
+	_, account, err := s.currentSession(ctx, sessionToken(c))
+	if err != nil {
+		return s.sessionError(c, err)
 	}
 
-	// Otherwise, return a successful response
-	res, err := s.buildAuthResponse(context.Background(), req)
+	res, err := s.authResponse(ctx, account)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
 	return c.JSON(http.StatusOK, res)
 }
 
+// Switch the session to another of its team's resources, and describe that
+// resource's account
+func (s *server) switchSessionHandler(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "no-store")
+	req := &SwitchResourceRequest{}
+	err := c.Bind(req)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "malformed request: "+err.Error())
+	}
+
+	ctx := context.Background()
+	session, _, err := s.currentSession(ctx, sessionToken(c))
+	if err != nil {
+		return s.sessionError(c, err)
+	}
+	account, err := s.switchSession(ctx, session, req.ResourceUUID)
+	if err != nil {
+		return s.sessionError(c, err)
+	}
+
+	res, err := s.authResponse(ctx, account)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// Log out: revoke the session and clear its cookie
+func (s *server) deleteSessionHandler(c echo.Context) error {
+	err := s.endSession(context.Background(), sessionToken(c))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	c.SetCookie(s.sessionCookie("", time.Unix(0, 0)))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// The session cookie, holding token until expires. HttpOnly keeps it out of
+// reach of scripts on the page.
+func (s *server) sessionCookie(token string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   s.config.sessionCookieSecure,
+		HttpOnly: true,
+		SameSite: s.config.sessionCookieSameSite,
+	}
+}
+
+// The session token from the request's cookie, or "" if there is none
+func sessionToken(c echo.Context) string {
+	cookie, err := c.Cookie(sessionCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// Respond to a failed session request. Ended sessions also lose their cookie.
+func (s *server) sessionError(c echo.Context, err error) error {
+	switch err.(type) {
+	case *UnauthorizedError:
+		c.SetCookie(s.sessionCookie("", time.Unix(0, 0)))
+		return c.NoContent(http.StatusUnauthorized)
+	case *NotFoundError:
+		return c.NoContent(http.StatusNotFound)
+	case *SuspendedError:
+		// Suspended accounts may not sign in
+		return c.JSON(http.StatusForbidden, &ErrorResponse{Message: err.Error()})
+	}
+	return c.String(http.StatusInternalServerError, err.Error())
+}
+
+// Vendor endpoints: for use by this example's front-end
+
 // Used to demonstrate sending updated config information to DigitalOcean.
-// In this example, a license key is used to represent a vendor's config info.
+// The front-end can set, unset and rotate a resource's config vars.
 func (s *server) changeConfig(c echo.Context) error {
-	// Parse the request
-	s.e.Logger.Info("Got config request")
-	uuid := c.Param("uuid")
+	s.e.Logger.Info("Got config request for " + c.Param("uuid"))
+	return s.editConfigResponse(c, c.Param("uuid"))
+}
 
-	s.e.Logger.Info("UUID: " + uuid)
+// Report a resource's config vars and whether the last change to them has
+// reached DigitalOcean
+func (s *server) configStatusHandler(c echo.Context) error {
+	return s.configStatusResponse(c, c.Param("uuid"))
+}
 
-	// Send the config update to DigitalOcean
-	err := s.updateConfig(context.Background(), uuid)
+// Apply a config edit from the request body and report the resulting config
+func (s *server) editConfigResponse(c echo.Context, uuid string) error {
+	req := &ConfigEditRequest{}
+	err := c.Bind(req)
 	if err != nil {
+		return c.String(http.StatusBadRequest, "malformed request: "+err.Error())
+	}
+
+	resp, err := s.editConfig(context.Background(), uuid, req)
+	if err != nil {
+		switch err.(type) {
+		case *NotFoundError:
+			return c.NoContent(http.StatusNotFound)
+		case *NoGrantError:
+			return c.JSON(http.StatusConflict, &ErrorResponse{Message: err.Error()})
+		case *InvalidConfigError:
+			return c.JSON(http.StatusUnprocessableEntity, err)
+		}
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
 
-	// Return success back to the front end
-	return c.NoContent(http.StatusOK)
+	if resp.Push == nil {
+		// DigitalOcean already had this config, so there was nothing to send
+		return c.JSON(http.StatusOK, resp)
+	}
+
+	// Tell the caller whether DigitalOcean has the update yet, or it is
+	// queued to be retried
+	return c.JSON(configPushHTTPStatus(resp.Push), resp)
+}
+
+func (s *server) configStatusResponse(c echo.Context, uuid string) error {
+	resp, err := s.configStatus(context.Background(), uuid)
+	if err != nil {
+		if _, ok := err.(*NotFoundError); ok {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// List the license keys issued to a resource, newest first, with whether each
+// is still accepted and when it was last used
+func (s *server) licenseKeysListHandler(c echo.Context) error {
+	keys, err := s.listLicenseKeys(context.Background(), c.Param("uuid"))
+	if err != nil {
+		if _, ok := err.(*NotFoundError); ok {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	now := time.Now()
+	resp := []*LicenseKeyResponse{}
+	for i := range keys {
+		resp = append(resp, newLicenseKeyResponse(&keys[i], now))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Stop accepting one of a resource's license keys straight away
+func (s *server) revokeLicenseKeyHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.NoContent(http.StatusNotFound)
+	}
+
+	err = s.revokeLicenseKey(context.Background(), c.Param("uuid"), id)
+	if err != nil {
+		if _, ok := err.(*NotFoundError); ok {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// List a team's live resources and how many are on each plan
+func (s *server) teamHandler(c echo.Context) error {
+	resp, err := s.team(context.Background(), c.Param("team_id"))
+	if err != nil {
+		if _, ok := err.(*NotFoundError); ok {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Report the usage of a team's resources added together, taking the same
+// query parameters as a resource's usage
+func (s *server) teamUsageHandler(c echo.Context) error {
+	granularity, from, to, err := usageParams(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	resp, err := s.teamUsage(context.Background(), c.Param("team_id"), granularity, from, to, c.QueryParam("meter"))
+	if err != nil {
+		switch err.(type) {
+		case *NotFoundError:
+			return c.NoContent(http.StatusNotFound)
+		case *InvalidUsageError:
+			return c.JSON(http.StatusUnprocessableEntity, err)
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// List the apps and plans we offer, along with the catalog's version
+func (s *server) catalogHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.catalog.Current())
+}
+
+// Product service endpoints: for our own services to check what a resource may do
+
+// Look up what a resource is entitled to
+func (s *server) entitlementsHandler(c echo.Context) error {
+	entitlements, etag, err := s.entitlements(context.Background(), c.Param("resource_uuid"))
+	return entitlementsResponse(c, entitlements, etag, err)
+}
+
+// Look up what the holder of a license key is entitled to, given as ?license_key=
+func (s *server) licenseKeyEntitlementsHandler(c echo.Context) error {
+	licenseKey := c.QueryParam("license_key")
+	if licenseKey == "" {
+		return c.String(http.StatusBadRequest, "license_key is required")
+	}
+
+	entitlements, etag, err := s.entitlementsForLicenseKey(context.Background(), licenseKey)
+	return entitlementsResponse(c, entitlements, etag, err)
+}
+
+// Send entitlements with their ETag, or a 304 if the caller already has them.
+// Callers are asked to revalidate every time so changes reach them at once.
+func entitlementsResponse(c echo.Context, entitlements *Entitlements, etag string, err error) error {
+	if err != nil {
+		if _, ok := err.(*NotFoundError); ok {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	c.Response().Header().Set("ETag", etag)
+	c.Response().Header().Set("Cache-Control", "private, no-cache")
+	if etagMatches(c.Request().Header.Get("If-None-Match"), etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.JSON(http.StatusOK, entitlements)
+}
+
+// Record a batch of usage events
+func (s *server) recordUsageHandler(c echo.Context) error {
+	req := &UsageBatchRequest{}
+	err := c.Bind(req)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "malformed request: "+err.Error())
+	}
+
+	resp, err := s.recordUsage(context.Background(), req)
+	if err != nil {
+		if _, ok := err.(*InvalidUsageError); ok {
+			return c.JSON(http.StatusUnprocessableEntity, err)
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Report a resource's usage by hour or day. Takes granularity (hour or day,
+// default day), from and to as RFC 3339 times (default the last 30 days, or
+// the last day by hour) and an optional meter.
+func (s *server) usageHandler(c echo.Context) error {
+	granularity, from, to, err := usageParams(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	resp, err := s.usage(context.Background(), c.Param("resource_uuid"), granularity, from, to, c.QueryParam("meter"))
+	if err != nil {
+		switch err.(type) {
+		case *NotFoundError:
+			return c.NoContent(http.StatusNotFound)
+		case *InvalidUsageError:
+			return c.JSON(http.StatusUnprocessableEntity, err)
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Read the granularity, from and to of a usage query, with their defaults
+func usageParams(c echo.Context) (models.UsageGranularity, time.Time, time.Time, error) {
+	granularity := models.UsageGranularity(c.QueryParam("granularity"))
+	if granularity == "" {
+		granularity = models.UsageDaily
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if granularity == models.UsageHourly {
+		from = to.Add(-24 * time.Hour)
+	}
+	for param, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		value := c.QueryParam(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return granularity, from, to, fmt.Errorf("%s must be an RFC 3339 time", param)
+		}
+		*t = parsed
+	}
+	return granularity, from, to, nil
+}
+
+// Whether an If-None-Match header lists etag
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Operator endpoints: for use by whoever runs this app
+
+// Report the last background token refresh pass and any resources whose
+// tokens are failing to refresh
+func (s *server) tokenRefreshStatusHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.refresher.status())
+}
+
+// List when each of a resource's tokens was issued and expires, newest first.
+// The tokens themselves are never returned.
+func (s *server) tokenHistoryHandler(c echo.Context) error {
+	history, err := s.tokenHistory(context.Background(), c.Param("resource_uuid"))
+	if err == store.ErrNotFound {
+		return c.NoContent(http.StatusNotFound)
+	} else if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, history)
+}
+
+// List resources DigitalOcean failed to deprovision that still need attention.
+// Pass ?all=true to include ones that have been dealt with.
+func (s *server) listDeprovisionFailuresHandler(c echo.Context) error {
+	failures, err := s.db.ListDeprovisionFailures(context.Background(), c.QueryParam("all") == "true")
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	resp := []*DeprovisionFailureResponse{}
+	for i := range failures {
+		resp = append(resp, newDeprovisionFailureResponse(&failures[i]))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Retry deprovisioning a failed resource straight away
+func (s *server) retryDeprovisionHandler(c echo.Context) error {
+	failure, err := s.retryDeprovisionNow(context.Background(), c.Param("resource_uuid"))
+	if err != nil {
+		return deprovisionFailureError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, newDeprovisionFailureResponse(failure))
+}
+
+// Mark a failed deprovisioning as dealt with, stopping any further retries
+func (s *server) resolveDeprovisionFailureHandler(c echo.Context) error {
+	req := &ResolveRequest{}
+	err := c.Bind(req)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "malformed request: "+err.Error())
+	}
+
+	failure, err := s.resolveDeprovisionFailure(context.Background(), c.Param("resource_uuid"), req.Resolution)
+	if err != nil {
+		return deprovisionFailureError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, newDeprovisionFailureResponse(failure))
+}
+
+func deprovisionFailureError(c echo.Context, err error) error {
+	switch err.(type) {
+	case *NotFoundError:
+		return c.NoContent(http.StatusNotFound)
+	case *ClosedFailureError:
+		return c.JSON(http.StatusConflict, &ErrorResponse{Message: err.Error()})
+	}
+	return c.String(http.StatusInternalServerError, err.Error())
+}
+
+// Load the plan catalog file again. If it is invalid, the current catalog is
+// kept and a 422 explains why.
+func (s *server) reloadCatalogHandler(c echo.Context) error {
+	current, err := s.reloadCatalog()
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, &ErrorResponse{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, current)
+}
+
+// Show the policies in use
+func (s *server) policyHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.policies.Current())
+}
+
+// Load the policy file again. If it is invalid, the error is returned and the
+// policies already loaded stay in use.
+func (s *server) reloadPolicyHandler(c echo.Context) error {
+	current, err := s.reloadPolicy()
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, &ErrorResponse{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, current)
+}
+
+// List the overrides on a resource's entitlements
+func (s *server) listEntitlementOverridesHandler(c echo.Context) error {
+	overrides, err := s.db.ListEntitlementOverrides(context.Background(), c.Param("resource_uuid"))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	resp := []*EntitlementOverrideResponse{}
+	for i := range overrides {
+		resp = append(resp, newEntitlementOverrideResponse(&overrides[i]))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Grant or withhold a feature, or replace a limit, for one resource
+func (s *server) setEntitlementOverrideHandler(c echo.Context) error {
+	req := &EntitlementOverrideRequest{}
+	err := c.Bind(req)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "malformed request: "+err.Error())
+	}
+
+	override := &models.EntitlementOverride{
+		ResourceUUID: c.Param("resource_uuid"),
+		Kind:         models.OverrideKind(c.Param("kind")),
+		Name:         c.Param("name"),
+		Enabled:      req.Enabled,
+		Limit:        req.Limit,
+		Reason:       req.Reason,
+	}
+	err = s.setEntitlementOverride(context.Background(), override)
+	if err != nil {
+		switch err.(type) {
+		case *NotFoundError:
+			return c.NoContent(http.StatusNotFound)
+		case *InvalidOverrideError:
+			return c.JSON(http.StatusUnprocessableEntity, &ErrorResponse{Message: err.Error()})
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, newEntitlementOverrideResponse(override))
+}
+
+// Set, unset and rotate a resource's config vars
+func (s *server) adminEditConfigHandler(c echo.Context) error {
+	return s.editConfigResponse(c, c.Param("resource_uuid"))
+}
+
+// Report a resource's config vars and the latest push of them
+func (s *server) adminConfigStatusHandler(c echo.Context) error {
+	return s.configStatusResponse(c, c.Param("resource_uuid"))
+}
+
+// Remove an override, so the resource gets what its plan gives it again
+func (s *server) deleteEntitlementOverrideHandler(c echo.Context) error {
+	err := s.deleteEntitlementOverride(context.Background(), c.Param("resource_uuid"), models.OverrideKind(c.Param("kind")), c.Param("name"))
+	if err != nil {
+		if _, ok := err.(*NotFoundError); ok {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// List the most recent lookups of a resource's license keys, newest first.
+// Pass ?limit= to see more or fewer than 100.
+func (s *server) licenseVerificationsHandler(c echo.Context) error {
+	limit := 100
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			return c.String(http.StatusBadRequest, "limit must be between 1 and 1000")
+		}
+		limit = parsed
+	}
+
+	verifications, err := s.db.ListLicenseVerifications(context.Background(), c.Param("resource_uuid"), limit)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	resp := []*LicenseVerificationResponse{}
+	for _, v := range verifications {
+		resp = append(resp, &LicenseVerificationResponse{
+			KeyHash:   v.KeyHash,
+			Result:    v.Result,
+			RemoteIP:  v.RemoteIP,
+			CreatedAt: v.CreatedAt,
+		})
+	}
+	return c.JSON(http.StatusOK, resp)
 }
@@ -1,105 +1,225 @@
 package server
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"io/ioutil"
-	"net/http"
+	"crypto/sha256"
+	"encoding/hex"
+	"sample_app/internal/store"
+	"sample_app/models"
+	"time"
 
 	"github.com/google/uuid"
 )
 
-const (
-	UpdateLicenseKeySQL = `
-	UPDATE accounts
-	SET license_key=$2
-	WHERE resource_uuid=$1;
-	`
-)
-
 // License keys are used as an example of config information that a vendor may send
 // to DigitalOcean on account provisioning, and potentially update at a later time.
-// Our example provides the option to replace a license key for a user to simulate a case
-// where you may need to update the config information sent to DigitalOcean for a given user.
-// This function demonstrates how to send that config update to DigitalOcean.
-func (s *server) updateConfig(ctx context.Context, uuid string) error {
-	configURL := "https://api.digitalocean.com:443/v2/add-ons/resources/" + uuid + "/config"
-
-	s.e.Logger.Info("Searching for tokens for " + uuid)
+// Resources are given a new key when their plan changes, when their
+// LICENSE_KEY config var is rotated, and shortly before their key expires.
+
+// Issue account a new license key, save it and render its config vars again.
+// If they changed, a push of them to DigitalOcean is queued, due after the
+// given delay; otherwise the returned push is nil. Call it from inside a
+// transaction.
+func (s *server) reissueLicenseKey(ctx context.Context, tx store.Store, account *models.Account, delay time.Duration) (*models.ConfigPush, error) {
+	licenseKey, expiresAt, err := s.newLicenseKey(account.ResourceUUID, account.AppSlug, account.PlanSlug)
+	if err != nil {
+		return nil, err
+	}
 
-	// Fetch the access token to authorize the request
-	token, err := s.getAccessToken(ctx, uuid)
+	err = s.updateLicenseKey(ctx, tx, licenseKey, expiresAt, account.ResourceUUID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	account.LicenseKey = licenseKey
+
+	return s.refreshConfigVars(ctx, tx, account, delay)
+}
+
+// Give an account a new license key and config vars to match, and queue a
+// push of them to DigitalOcean. Without tokens the push could never be
+// delivered, so they are only saved then. Call it from inside a transaction.
+func (s *server) replaceLicenseKey(ctx context.Context, tx store.Store, account *models.Account) error {
+	if account.OAuthState == models.OAuthFailed {
+		licenseKey, expiresAt, err := s.newLicenseKey(account.ResourceUUID, account.AppSlug, account.PlanSlug)
+		if err != nil {
+			return err
+		}
+		err = s.updateLicenseKey(ctx, tx, licenseKey, expiresAt, account.ResourceUUID)
+		if err != nil {
+			return err
+		}
+		account.LicenseKey = licenseKey
+
+		return s.saveConfigVars(ctx, tx, account)
 	}
 
-	// Update the license key
-	licenseKey := newLicenseKey()
-	err = s.updateLicenseKey(ctx, licenseKey, uuid)
+	_, err := s.reissueLicenseKey(ctx, tx, account, 0)
+	return err
+}
+
+// This saves our new license key for a given user, which expires at expiresAt
+// if that is set. The key it replaces keeps working for the grace period, so
+// deployments using it have time to pick up the new one.
+func (s *server) updateLicenseKey(ctx context.Context, db store.Store, licenseKey string, expiresAt *time.Time, uuid string) error {
+	err := db.UpdateLicenseKey(ctx, uuid, licenseKey)
 	if err != nil {
+		s.e.Logger.Info("error updating license key: " + err.Error())
 		return err
 	}
 
-	// Construct the config update request
-	configReq := ConfigUpdate{
-		Config: ProvisioningConfig{
-			LicenseKey: licenseKey,
-		},
+	return s.recordLicenseKey(ctx, db, uuid, licenseKey, expiresAt, s.config.licenseKeyGracePeriod)
+}
+
+// Add a resource's new license key to its key history, along with when it
+// expires, if it does. Keys it replaces are accepted for the given grace
+// period at most.
+func (s *server) recordLicenseKey(ctx context.Context, db store.Store, uuid string, licenseKey string, expiresAt *time.Time, grace time.Duration) error {
+	key := &models.LicenseKey{
+		ResourceUUID: uuid,
+		KeyHash:      hashLicenseKey(licenseKey),
+		Hint:         licenseKeyHint(licenseKey),
+		ExpiresAt:    expiresAt,
 	}
+	return db.IssueLicenseKey(ctx, key, time.Now().Add(grace))
+}
 
-	jsonBody, err := json.Marshal(configReq)
+// Find the license key someone presented to us, and note that it was used.
+// The key may no longer be accepted.
+func (s *server) lookupLicenseKey(ctx context.Context, licenseKey string) (*models.LicenseKey, error) {
+	key, err := s.db.GetLicenseKey(ctx, hashLicenseKey(licenseKey))
 	if err != nil {
-		s.e.Logger.Info("error converting config update request to json: " + err.Error())
-		return err
+		return nil, err
 	}
-	bodyReader := bytes.NewReader(jsonBody)
 
-	req, err := http.NewRequest(http.MethodPatch, configURL, bodyReader)
+	now := time.Now()
+	err = s.db.TouchLicenseKey(ctx, key.Id, now)
 	if err != nil {
-		s.e.Logger.Info("error creating config HTTP request: " + err.Error())
-		return err
+		return nil, err
 	}
-	// Add the access token for authorization
-	req.Header.Add("Authorization", "Bearer "+token)
-	req.Header.Add("Content-Type", "application/json")
+	key.LastUsedAt = &now
+	return key, nil
+}
+
+// List the license keys issued to a live resource, newest first
+func (s *server) listLicenseKeys(ctx context.Context, uuid string) ([]models.LicenseKey, error) {
+	account, err := s.db.GetAccount(ctx, uuid)
+	if err == store.ErrNotFound || (err == nil && account.Deprovisioned()) {
+		return nil, &NotFoundError{}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s.db.ListLicenseKeys(ctx, uuid)
+}
 
-	// Send the PATCH request
-	res, err := http.DefaultClient.Do(req)
+// Stop accepting one of a resource's license keys straight away. Revoking the
+// current key also issues a new one and pushes it to DigitalOcean, so the
+// resource is not left without a working key.
+func (s *server) revokeLicenseKey(ctx context.Context, uuid string, id int) error {
+	return s.db.InTx(ctx, func(tx store.Store) error {
+		account, err := tx.GetAccount(ctx, uuid)
+		if err == store.ErrNotFound || (err == nil && account.Deprovisioned()) {
+			return &NotFoundError{}
+		} else if err != nil {
+			return err
+		}
+
+		err = tx.RevokeLicenseKey(ctx, uuid, id, time.Now())
+		if err == store.ErrNotFound {
+			return &NotFoundError{}
+		} else if err != nil {
+			return err
+		}
+
+		current, err := tx.GetLicenseKey(ctx, hashLicenseKey(account.LicenseKey))
+		if err == store.ErrNotFound || (err == nil && current.Id != id) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		s.e.Logger.Info("Revoked the current license key of " + uuid + ", issuing a new one")
+		return s.replaceLicenseKey(ctx, tx, account)
+	})
+}
+
+// Give every resource whose license key expires within the renewal lead time
+// a new one, and push it to DigitalOcean, so customers' deployments pick it up
+// before the old one stops working
+func (s *server) renewLicenseKeys(ctx context.Context) {
+	keys, err := s.db.ListExpiringLicenseKeys(ctx, time.Now().Add(s.config.licenseKeyRenewalLeadTime))
 	if err != nil {
-		s.e.Logger.Info("error making config http request: " + err.Error())
-		return err
+		s.e.Logger.Error("Unable to list expiring license keys: " + err.Error())
+		return
 	}
 
-	// If an error occurs, log it and continue in this case
-	if res.StatusCode >= 400 {
-		s.e.Logger.Info("got bad status response from config update")
-		resBody, err := ioutil.ReadAll(res.Body)
+	for i := range keys {
+		if ctx.Err() != nil {
+			return
+		}
+		err = s.renewLicenseKey(ctx, &keys[i])
 		if err != nil {
-			s.e.Logger.Info("could not read error response: " + err.Error())
-			return err
+			s.e.Logger.Error("Unable to renew the license key of " + keys[i].ResourceUUID + ": " + err.Error())
 		}
-		s.e.Logger.Info("response body: " + string(resBody))
 	}
+}
 
-	return nil
+// Replace an expiring license key, unless the resource has been given another
+// key or deprovisioned since it was listed
+func (s *server) renewLicenseKey(ctx context.Context, key *models.LicenseKey) error {
+	return s.db.InTx(ctx, func(tx store.Store) error {
+		account, err := tx.GetAccount(ctx, key.ResourceUUID)
+		if err == store.ErrNotFound || (err == nil && account.Deprovisioned()) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if hashLicenseKey(account.LicenseKey) != key.KeyHash {
+			return nil
+		}
+
+		s.e.Logger.Info("License key of " + key.ResourceUUID + " expires at " + key.ExpiresAt.Format(time.RFC3339) + ", issuing a new one")
+		return s.replaceLicenseKey(ctx, tx, account)
+	})
 }
 
-// This saves our new license key for a given user
-func (s *server) updateLicenseKey(ctx context.Context, licenseKey string, uuid string) error {
-	_, err := s.db.Exec(ctx, UpdateLicenseKeySQL,
-		uuid,
-		licenseKey,
-	)
+// Issue a license key for a resource. Keys are signed when license signing
+// keys are configured, so our product can verify them offline, and random
+// otherwise. Signed keys expire once the configured lifetime has passed, and
+// when they do is returned; it is nil for keys that do not expire.
+func (s *server) newLicenseKey(uuid string, appSlug string, planSlug string) (string, *time.Time, error) {
+	if s.licenses == nil {
+		return randomLicenseKey(), nil, nil
+	}
+	if s.config.licenseKeyLifetime <= 0 {
+		licenseKey, err := s.licenses.Issue(uuid, appSlug, planSlug, time.Time{})
+		return licenseKey, nil, err
+	}
 
+	// Truncated to match the exp claim, which is in whole seconds
+	expiresAt := time.Now().Add(s.config.licenseKeyLifetime).Truncate(time.Second)
+	licenseKey, err := s.licenses.Issue(uuid, appSlug, planSlug, expiresAt)
 	if err != nil {
-		s.e.Logger.Info("error updating license key: " + err.Error())
-		return err
+		return "", nil, err
 	}
-
-	return nil
+	return licenseKey, &expiresAt, nil
 }
 
-func newLicenseKey() string {
+func randomLicenseKey() string {
 	return uuid.New().String()
 }
+
+// How license keys are stored in their history and the audit log
+func hashLicenseKey(licenseKey string) string {
+	sum := sha256.Sum256([]byte(licenseKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// The end of a license key, which is enough to tell keys apart without
+// showing them
+func licenseKeyHint(licenseKey string) string {
+	if len(licenseKey) <= 6 {
+		return licenseKey
+	}
+	return licenseKey[len(licenseKey)-6:]
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"sample_app/models"
+	"testing"
+	"time"
+)
+
+func TestLicenseKeyRenewal(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	ts.config.licenseKeyLifetime = 30 * 24 * time.Hour
+	ts.config.licenseKeyRenewalLeadTime = 7 * 24 * time.Hour
+	r := testResource("2f1e0d9c-8b7a-4695-a4b3-c2d1e0f9a8b7")
+	original := ts.provision(t, r).LicenseKey
+
+	// The expiry signed into the key is recorded with it
+	claims, err := ts.licenses.Verify(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ts.db.ListLicenseKeys(ctx, r.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys[0].ExpiresAt == nil || keys[0].ExpiresAt.Unix() != claims.ExpiresAt {
+		t.Fatalf("recorded expiry %v, want the key's exp %d", keys[0].ExpiresAt, claims.ExpiresAt)
+	}
+
+	ts.renewLicenseKeys(ctx)
+	if ts.account(t, r.UUID).LicenseKey != original {
+		t.Fatal("renewed a key that is not due")
+	}
+
+	ts.config.licenseKeyRenewalLeadTime = 31 * 24 * time.Hour
+	ts.renewLicenseKeys(ctx)
+	renewed := ts.account(t, r.UUID).LicenseKey
+	if renewed == original {
+		t.Fatal("did not renew a key that is due")
+	}
+
+	ts.dispatchConfigPushes(ctx)
+	if pushed := ts.api.Config(r.UUID)["LICENSE_KEY"]; pushed != renewed {
+		t.Errorf("pushed LICENSE_KEY %q, want the renewed key", pushed)
+	}
+	old, err := ts.db.GetLicenseKey(ctx, hashLicenseKey(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := old.Status(time.Now()); status != models.LicenseKeyGrace {
+		t.Errorf("renewed key is %s, want grace", status)
+	}
+}
+
+// Keys past their recorded expiry are refused even if their signature says
+// otherwise
+func TestExpiredLicenseKeyRefused(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	r := testResource("9e8d7c6b-5a49-4382-b1a0-f9e8d7c6b5a4")
+	licenseKey := ts.provision(t, r).LicenseKey
+
+	resp, err := ts.verifyLicense(ctx, licenseKey, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Valid {
+		t.Fatal("current key is not valid")
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	err = ts.recordLicenseKey(ctx, ts.db, r.UUID, "expired-key", &expired, ts.config.licenseKeyGracePeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = ts.verifyLicense(ctx, "expired-key", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Valid {
+		t.Error("expired key is valid")
+	}
+	_, _, err = ts.entitlementsForLicenseKey(ctx, "expired-key")
+	if _, ok := err.(*NotFoundError); !ok {
+		t.Errorf("entitlements of an expired key: %v, want not found", err)
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"sample_app/internal/store"
+	"sample_app/models"
+	"time"
+)
+
+// Longest license key worth looking up. Signed keys are a few hundred bytes.
+const maxLicenseKeyLength = 2048
+
+// The body of a license verification request
+type LicenseVerifyRequest struct {
+	LicenseKey string `json:"license_key"`
+}
+
+// What a license key is good for. Plan and status are only given for keys
+// belonging to a live account, and entitlements only for valid keys.
+type LicenseVerifyResponse struct {
+	Valid        bool          `json:"valid"`
+	AppSlug      string        `json:"app_slug,omitempty"`
+	PlanSlug     string        `json:"plan_slug,omitempty"`
+	Status       string        `json:"status,omitempty"`
+	Entitlements *Entitlements `json:"entitlements,omitempty"`
+
+	// When a replaced key stops being accepted. The holder should pick up
+	// the resource's new key before then.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// A license key as shown to the front-end. The key itself is never shown.
+type LicenseKeyResponse struct {
+	Id         int                     `json:"id"`
+	Hint       string                  `json:"hint"`
+	Status     models.LicenseKeyStatus `json:"status"`
+	IssuedAt   time.Time               `json:"issued_at"`
+	ReplacedAt *time.Time              `json:"replaced_at,omitempty"`
+	ExpiresAt  *time.Time              `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time              `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time              `json:"last_used_at,omitempty"`
+}
+
+func newLicenseKeyResponse(key *models.LicenseKey, now time.Time) *LicenseKeyResponse {
+	return &LicenseKeyResponse{
+		Id:         key.Id,
+		Hint:       key.Hint,
+		Status:     key.Status(now),
+		IssuedAt:   key.IssuedAt,
+		ReplacedAt: key.ReplacedAt,
+		ExpiresAt:  key.ExpiresAt,
+		RevokedAt:  key.RevokedAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+}
+
+// A recorded license key lookup, as shown to operators
+type LicenseVerificationResponse struct {
+	KeyHash   string                           `json:"key_hash"`
+	Result    models.LicenseVerificationResult `json:"result"`
+	RemoteIP  string                           `json:"remote_ip"`
+	CreatedAt time.Time                        `json:"created_at"`
+}
+
+// Check whether a license key belongs to a live, active account and what it
+// is entitled to. Every lookup is recorded, whatever it finds.
+func (s *server) verifyLicense(ctx context.Context, licenseKey string, remoteIP string) (*LicenseVerifyResponse, error) {
+	resp := &LicenseVerifyResponse{}
+	verification := &models.LicenseVerification{
+		KeyHash:  hashLicenseKey(licenseKey),
+		Result:   models.LicenseUnknown,
+		RemoteIP: remoteIP,
+	}
+
+	key, err := s.lookupLicenseKey(ctx, licenseKey)
+	if err == nil {
+		switch key.Status(time.Now()) {
+		case models.LicenseKeyRevoked:
+			verification.ResourceUUID = key.ResourceUUID
+			verification.Result = models.LicenseRevoked
+		case models.LicenseKeyExpired:
+			verification.ResourceUUID = key.ResourceUUID
+			verification.Result = models.LicenseExpired
+		default:
+			err = s.checkLicenseHolder(ctx, key, verification, resp)
+		}
+	}
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+
+	err = s.db.RecordLicenseVerification(ctx, verification)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Fill in what the account holding an accepted license key is entitled to.
+// Keys of deprovisioned accounts stay unknown.
+func (s *server) checkLicenseHolder(ctx context.Context, key *models.LicenseKey, verification *models.LicenseVerification, resp *LicenseVerifyResponse) error {
+	account, err := s.db.GetAccount(ctx, key.ResourceUUID)
+	if err == store.ErrNotFound || (err == nil && account.Deprovisioned()) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	verification.ResourceUUID = account.ResourceUUID
+	resp.AppSlug = account.AppSlug
+	resp.PlanSlug = account.PlanSlug
+	resp.Status = statusName(account.Status)
+	resp.ExpiresAt = key.ExpiresAt
+	if account.Status == models.Suspended {
+		verification.Result = models.LicenseSuspended
+		return nil
+	}
+
+	entitlements, _, err := s.entitlements(ctx, account.ResourceUUID)
+	if err != nil {
+		return err
+	}
+	verification.Result = models.LicenseValid
+	resp.Valid = true
+	resp.Entitlements = entitlements
+	return nil
+}
+
+// Remove license verifications older than the audit retention period
+func (s *server) purgeLicenseVerifications(ctx context.Context) {
+	purged, err := s.db.PurgeLicenseVerifications(ctx, time.Now().Add(-s.config.licenseAuditRetention))
+	if err != nil {
+		s.e.Logger.Error("Unable to purge license verifications: " + err.Error())
+		return
+	}
+
+	if purged > 0 {
+		s.e.Logger.Infof("Purged %d license verifications", purged)
+	}
+}
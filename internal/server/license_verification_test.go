@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sample_app/internal/dosim"
+	"sample_app/internal/store"
+	"sample_app/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Verify a license key the way a customer's deployment does
+func (ts *testServer) verify(t *testing.T, licenseKey string) (*httptest.ResponseRecorder, *LicenseVerifyResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/license/verify", strings.NewReader(`{"license_key": "`+licenseKey+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	ts.e.ServeHTTP(rec, req)
+
+	resp := &LicenseVerifyResponse{}
+	if rec.Code == http.StatusOK {
+		err := json.Unmarshal(rec.Body.Bytes(), resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec, resp
+}
+
+func TestVerifyLicense(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	r := testResource("2a3b4c5d-6e7f-4809-9a1b-2c3d4e5f6a7b")
+	account := ts.provision(t, r)
+	original := account.LicenseKey
+
+	_, resp := ts.verify(t, original)
+	if !resp.Valid || resp.PlanSlug != "basic" || resp.Entitlements == nil || resp.ExpiresAt != nil {
+		t.Fatalf("current key: %+v, want valid with entitlements and no expiry", resp)
+	}
+
+	// A replaced key is accepted for its grace period, and says so
+	err := ts.db.InTx(ctx, func(tx store.Store) error {
+		return ts.replaceLicenseKey(ctx, tx, account)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replacement := ts.account(t, r.UUID).LicenseKey
+	_, resp = ts.verify(t, original)
+	if !resp.Valid || resp.ExpiresAt == nil {
+		t.Errorf("replaced key: %+v, want valid with an expiry", resp)
+	}
+
+	keys, err := ts.db.ListLicenseKeys(ctx, r.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ts.revokeLicenseKey(ctx, r.UUID, keys[1].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, resp = ts.verify(t, original)
+	if resp.Valid {
+		t.Error("revoked key is valid")
+	}
+
+	_, resp = ts.verify(t, "made-up")
+	if resp.Valid {
+		t.Error("made up key is valid")
+	}
+
+	res, err := ts.sim.NotifyResources(ctx, dosim.Suspended, []string{r.UUID})
+	expectStatus(t, "suspend", res, err, http.StatusOK)
+	_, resp = ts.verify(t, replacement)
+	if resp.Valid || resp.Status != "suspended" || resp.Entitlements != nil {
+		t.Errorf("key of a suspended account: %+v, want invalid and suspended", resp)
+	}
+
+	res, err = ts.sim.Deprovision(ctx, r.UUID)
+	expectStatus(t, "deprovision", res, err, http.StatusOK)
+	_, resp = ts.verify(t, replacement)
+	if resp.Valid || resp.Status != "" {
+		t.Errorf("key of a deprovisioned account: %+v, want nothing but invalid", resp)
+	}
+
+	// Every lookup is in the audit log, newest first
+	verifications, err := ts.db.ListLicenseVerifications(ctx, r.UUID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.LicenseVerificationResult{
+		models.LicenseRevoked,
+		models.LicenseSuspended,
+		models.LicenseRevoked,
+		models.LicenseValid,
+		models.LicenseValid,
+	}
+	if len(verifications) != len(want) {
+		t.Fatalf("%d verifications recorded, want %d", len(verifications), len(want))
+	}
+	for i, v := range verifications {
+		if v.Result != want[i] {
+			t.Errorf("verification %d is %s, want %s", i, v.Result, want[i])
+		}
+	}
+}
+
+func TestPurgeLicenseVerifications(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	r := testResource("b2c3d4e5-f6a7-4b89-9a0b-1c2d3e4f5a6b")
+	account := ts.provision(t, r)
+	ts.verify(t, account.LicenseKey)
+	ts.verify(t, account.LicenseKey)
+
+	ts.purgeLicenseVerifications(ctx)
+	verifications, err := ts.db.ListLicenseVerifications(ctx, r.UUID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifications) != 2 {
+		t.Errorf("%d verifications within the retention period, want 2 kept", len(verifications))
+	}
+
+	ts.config.licenseAuditRetention = -time.Second
+	ts.purgeLicenseVerifications(ctx)
+	verifications, err = ts.db.ListLicenseVerifications(ctx, r.UUID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifications) != 0 {
+		t.Errorf("%d verifications after the retention period, want none", len(verifications))
+	}
+}
+
+func TestVerifyLicenseRateLimit(t *testing.T) {
+	ts := newTestServer(t)
+	ts.verifyKeyLimiter = newRateLimiter(2)
+
+	for i := 0; i < 2; i++ {
+		rec, _ := ts.verify(t, "some-key")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d got %d, want 200", i, rec.Code)
+		}
+	}
+	rec, _ := ts.verify(t, "some-key")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("third request got %d, want 429 with a Retry-After", rec.Code)
+	}
+
+	// Other keys have their own allowance
+	rec, _ = ts.verify(t, "other-key")
+	if rec.Code != http.StatusOK {
+		t.Errorf("another key got %d, want 200", rec.Code)
+	}
+
+	rec, _ = ts.verify(t, "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("no key got %d, want 400", rec.Code)
+	}
+}
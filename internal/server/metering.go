@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"sample_app/internal/store"
+	"sample_app/models"
+	"strconv"
+	"time"
+)
+
+// How far ahead of our clock an event's timestamp may be
+const maxUsageClockSkew = 5 * time.Minute
+
+// Longest period one usage query may cover, by granularity
+var maxUsageRange = map[models.UsageGranularity]time.Duration{
+	models.UsageHourly: 31 * 24 * time.Hour,
+	models.UsageDaily:  366 * 24 * time.Hour,
+}
+
+var meterName = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// A batch of usage events from one of our product services
+type UsageBatchRequest struct {
+	Events []UsageEventRequest `json:"events"`
+}
+
+type UsageEventRequest struct {
+	ResourceUUID   string    `json:"resource_uuid"`
+	Meter          string    `json:"meter"`
+	Quantity       *float64  `json:"quantity"`
+	Timestamp      time.Time `json:"timestamp"`
+	IdempotencyKey string    `json:"idempotency_key"`
+}
+
+type UsageBatchResponse struct {
+	// Events recorded for the first time
+	Recorded int `json:"recorded"`
+
+	// Events dropped because their idempotency key was already recorded
+	Duplicates int `json:"duplicates"`
+}
+
+// A resource's usage over a period
+type UsageResponse struct {
+	ResourceUUID string                  `json:"resource_uuid"`
+	Granularity  models.UsageGranularity `json:"granularity"`
+	From         time.Time               `json:"from"`
+	To           time.Time               `json:"to"`
+
+	// Total quantity over the whole period, by meter
+	Totals map[string]float64 `json:"totals"`
+
+	// Periods with any usage, oldest first
+	Periods []UsagePeriod `json:"periods"`
+}
+
+type UsagePeriod struct {
+	Meter       string    `json:"meter"`
+	PeriodStart time.Time `json:"period_start"`
+	Quantity    float64   `json:"quantity"`
+	EventCount  int64     `json:"event_count"`
+}
+
+// Returned when a usage batch or query cannot be accepted. Events lists what
+// is wrong with each rejected event of a batch.
+type InvalidUsageError struct {
+	Message string            `json:"message"`
+	Events  []UsageEventError `json:"errors,omitempty"`
+}
+
+type UsageEventError struct {
+	// Position of the event in the batch
+	Index   int    `json:"index"`
+	Message string `json:"message"`
+}
+
+func (e *InvalidUsageError) Error() string {
+	return e.Message
+}
+
+// Record a batch of usage events. Either every event in the batch is valid and
+// the batch is recorded, or nothing is. Events that were already recorded are
+// skipped, so a batch can be resent after a failure.
+func (s *server) recordUsage(ctx context.Context, req *UsageBatchRequest) (*UsageBatchResponse, error) {
+	if len(req.Events) == 0 {
+		return nil, &InvalidUsageError{Message: "No events in batch"}
+	}
+	if len(req.Events) > s.config.meteringMaxBatch {
+		return nil, &InvalidUsageError{Message: "Batches may hold at most " + strconv.Itoa(s.config.meteringMaxBatch) + " events"}
+	}
+
+	resp := &UsageBatchResponse{}
+	err := s.db.InTx(ctx, func(tx store.Store) error {
+		invalid := []UsageEventError{}
+		now := time.Now()
+
+		// Usage is only recorded against resources we know about
+		known := map[string]bool{}
+		for i, event := range req.Events {
+			message := validateUsageEvent(&event, now)
+			if message != "" {
+				invalid = append(invalid, UsageEventError{Index: i, Message: message})
+				continue
+			}
+
+			live, ok := known[event.ResourceUUID]
+			if !ok {
+				account, err := tx.GetAccount(ctx, event.ResourceUUID)
+				if err != nil && err != store.ErrNotFound {
+					return err
+				}
+				live = err == nil && !account.Deprovisioned()
+				known[event.ResourceUUID] = live
+			}
+			if !live {
+				invalid = append(invalid, UsageEventError{Index: i, Message: "Unknown resource " + event.ResourceUUID})
+			}
+		}
+		if len(invalid) > 0 {
+			return &InvalidUsageError{Message: "Batch has invalid events", Events: invalid}
+		}
+
+		for _, event := range req.Events {
+			recorded, err := tx.RecordUsageEvent(ctx, &models.UsageEvent{
+				ResourceUUID:   event.ResourceUUID,
+				Meter:          event.Meter,
+				Quantity:       *event.Quantity,
+				OccurredAt:     event.Timestamp.UTC(),
+				IdempotencyKey: event.IdempotencyKey,
+			})
+			if err != nil {
+				return err
+			}
+			if recorded {
+				resp.Recorded++
+			} else {
+				resp.Duplicates++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Describe what is wrong with an event, or return "" if nothing is
+func validateUsageEvent(event *UsageEventRequest, now time.Time) string {
+	switch {
+	case event.ResourceUUID == "":
+		return "resource_uuid is required"
+	case !meterName.MatchString(event.Meter):
+		return "meter must be 1 to 64 lowercase letters, digits, '_', '.' or '-'"
+	case event.Quantity == nil:
+		return "quantity is required"
+	case *event.Quantity < 0 || math.IsNaN(*event.Quantity) || math.IsInf(*event.Quantity, 0):
+		return "quantity must be a number of at least 0"
+	case event.Timestamp.IsZero():
+		return "timestamp is required"
+	case event.Timestamp.After(now.Add(maxUsageClockSkew)):
+		return "timestamp is in the future"
+	case event.IdempotencyKey == "":
+		return "idempotency_key is required"
+	case len(event.IdempotencyKey) > 128:
+		return "idempotency_key may be at most 128 characters"
+	}
+	return ""
+}
+
+// Total a resource's usage by hour or day over [from, to). from is rounded
+// down to the start of its period.
+func (s *server) usage(ctx context.Context, uuid string, granularity models.UsageGranularity, from time.Time, to time.Time, meter string) (*UsageResponse, error) {
+	from, to, err := usageRange(granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deprovisioned resources keep their usage until they are purged
+	_, err = s.db.GetAccount(ctx, uuid)
+	if err == store.ErrNotFound {
+		return nil, &NotFoundError{}
+	} else if err != nil {
+		return nil, err
+	}
+
+	rollups, err := s.db.ListUsageRollups(ctx, uuid, granularity, from, to, meter)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &UsageResponse{
+		ResourceUUID: uuid,
+		Granularity:  granularity,
+		From:         from,
+		To:           to,
+		Totals:       map[string]float64{},
+		Periods:      []UsagePeriod{},
+	}
+	for _, rollup := range rollups {
+		resp.Totals[rollup.Meter] += rollup.Quantity
+		resp.Periods = append(resp.Periods, UsagePeriod{
+			Meter:       rollup.Meter,
+			PeriodStart: rollup.PeriodStart,
+			Quantity:    rollup.Quantity,
+			EventCount:  rollup.EventCount,
+		})
+	}
+	return resp, nil
+}
+
+// Check that a usage query covers a period we can serve, and round from down
+// to the start of its period
+func usageRange(granularity models.UsageGranularity, from time.Time, to time.Time) (time.Time, time.Time, error) {
+	maxRange, ok := maxUsageRange[granularity]
+	if !ok {
+		return from, to, &InvalidUsageError{Message: "granularity must be hour or day"}
+	}
+	from = usagePeriodStart(from, granularity)
+	to = to.UTC()
+	if !from.Before(to) {
+		return from, to, &InvalidUsageError{Message: "from must be before to"}
+	}
+	if to.Sub(from) > maxRange {
+		return from, to, &InvalidUsageError{Message: "Usage by " + string(granularity) + " can cover at most " + strconv.Itoa(int(maxRange.Hours()/24)) + " days"}
+	}
+	return from, to, nil
+}
+
+// The start of the hour or UTC day t falls in
+func usagePeriodStart(t time.Time, granularity models.UsageGranularity) time.Time {
+	t = t.UTC()
+	if granularity == models.UsageDaily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
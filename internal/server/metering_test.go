@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"sample_app/models"
+	"testing"
+	"time"
+)
+
+func usageEvent(uuid string, meter string, quantity float64, at time.Time, key string) UsageEventRequest {
+	return UsageEventRequest{ResourceUUID: uuid, Meter: meter, Quantity: &quantity, Timestamp: at, IdempotencyKey: key}
+}
+
+func TestRecordUsage(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	r := testResource("4b3a2918-0706-4f5e-8d4c-3b2a19080706")
+	ts.provision(t, r)
+
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	if day.Add(3 * time.Hour).After(time.Now()) {
+		day = day.Add(-24 * time.Hour)
+	}
+	batch := &UsageBatchRequest{Events: []UsageEventRequest{
+		usageEvent(r.UUID, "api_calls", 2, day.Add(time.Hour), "a"),
+		usageEvent(r.UUID, "api_calls", 3, day.Add(time.Hour+time.Minute), "b"),
+		usageEvent(r.UUID, "storage_gb", 1.5, day.Add(2*time.Hour), "c"),
+	}}
+	resp, err := ts.recordUsage(ctx, batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Recorded != 3 || resp.Duplicates != 0 {
+		t.Errorf("first batch recorded %d with %d duplicates, want 3 and 0", resp.Recorded, resp.Duplicates)
+	}
+
+	// Resending the batch records nothing new
+	resp, err = ts.recordUsage(ctx, batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Recorded != 0 || resp.Duplicates != 3 {
+		t.Errorf("resent batch recorded %d with %d duplicates, want 0 and 3", resp.Recorded, resp.Duplicates)
+	}
+
+	// One bad event rejects the whole batch
+	_, err = ts.recordUsage(ctx, &UsageBatchRequest{Events: []UsageEventRequest{
+		usageEvent(r.UUID, "api_calls", 7, day.Add(time.Hour), "d"),
+		usageEvent("unknown-uuid", "api_calls", 1, day.Add(time.Hour), "e"),
+	}})
+	invalid, ok := err.(*InvalidUsageError)
+	if !ok || len(invalid.Events) != 1 || invalid.Events[0].Index != 1 {
+		t.Fatalf("batch with an unknown resource error = %v, want the second event rejected", err)
+	}
+
+	hourly, err := ts.usage(ctx, r.UUID, models.UsageHourly, day, day.Add(24*time.Hour), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hourly.Totals["api_calls"] != 5 || hourly.Totals["storage_gb"] != 1.5 {
+		t.Errorf("hourly totals %v, want 5 api_calls and 1.5 storage_gb", hourly.Totals)
+	}
+	if len(hourly.Periods) != 2 || hourly.Periods[0].EventCount != 2 {
+		t.Errorf("hourly periods %+v, want one for each meter", hourly.Periods)
+	}
+
+	daily, err := ts.usage(ctx, r.UUID, models.UsageDaily, day.Add(time.Hour), day.Add(24*time.Hour), "api_calls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !daily.From.Equal(day) || len(daily.Periods) != 1 || daily.Periods[0].Quantity != 5 {
+		t.Errorf("daily usage of api_calls from %v: %+v, want 5 from the start of the day", daily.From, daily.Periods)
+	}
+
+	_, err = ts.usage(ctx, "unknown-uuid", models.UsageDaily, day, day.Add(24*time.Hour), "")
+	if _, ok := err.(*NotFoundError); !ok {
+		t.Errorf("usage of an unknown resource: %v, want not found", err)
+	}
+}
+
+func TestValidateUsageEvent(t *testing.T) {
+	now := time.Now()
+	negative := -1.0
+
+	tests := []struct {
+		name   string
+		change func(e *UsageEventRequest)
+		want   string
+	}{
+		{"valid", func(e *UsageEventRequest) {}, ""},
+		{"no resource", func(e *UsageEventRequest) { e.ResourceUUID = "" }, "resource_uuid is required"},
+		{"upper case meter", func(e *UsageEventRequest) { e.Meter = "API_CALLS" }, "meter must be 1 to 64 lowercase letters, digits, '_', '.' or '-'"},
+		{"no quantity", func(e *UsageEventRequest) { e.Quantity = nil }, "quantity is required"},
+		{"negative quantity", func(e *UsageEventRequest) { e.Quantity = &negative }, "quantity must be a number of at least 0"},
+		{"no timestamp", func(e *UsageEventRequest) { e.Timestamp = time.Time{} }, "timestamp is required"},
+		{"slightly ahead", func(e *UsageEventRequest) { e.Timestamp = now.Add(time.Minute) }, ""},
+		{"in the future", func(e *UsageEventRequest) { e.Timestamp = now.Add(time.Hour) }, "timestamp is in the future"},
+		{"no idempotency key", func(e *UsageEventRequest) { e.IdempotencyKey = "" }, "idempotency_key is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := usageEvent("uuid", "api_calls", 1, now, "key")
+			tt.change(&event)
+			if got := validateUsageEvent(&event, now); got != tt.want {
+				t.Errorf("validateUsageEvent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsageRange(t *testing.T) {
+	to := time.Date(2024, 6, 15, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		granularity models.UsageGranularity
+		from        time.Time
+		wantFrom    time.Time
+		wantErr     bool
+	}{
+		{"hourly", models.UsageHourly, to.Add(-90 * time.Minute), time.Date(2024, 6, 15, 11, 0, 0, 0, time.UTC), false},
+		{"daily", models.UsageDaily, to.AddDate(0, 0, -2), time.Date(2024, 6, 13, 0, 0, 0, 0, time.UTC), false},
+		{"hourly too long", models.UsageHourly, to.AddDate(0, 0, -32), time.Time{}, true},
+		{"from after to", models.UsageDaily, to.Add(24 * time.Hour), time.Time{}, true},
+		{"unknown granularity", "week", to.AddDate(0, 0, -7), time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, _, err := usageRange(tt.granularity, tt.from, to)
+			if tt.wantErr {
+				if _, ok := err.(*InvalidUsageError); !ok {
+					t.Errorf("usageRange() error = %v, want an InvalidUsageError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !from.Equal(tt.wantFrom) {
+				t.Errorf("from = %v, want %v", from, tt.wantFrom)
+			}
+		})
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sample_app/internal/store"
+	"sample_app/models"
+	"time"
 )
 
 // These are some of the types of notifications DigitalOcean may send.
@@ -12,11 +15,6 @@ const (
 	Reactivated          = "resources.reactivated"
 	DeprovisioningFailed = "resources.deprovisioning.failed"
 	Updated              = "resources.updated"
-
-	InsertActivitySQL = `
-	INSERT INTO activities (account_id, resource_uuid, type, title, body)
-	VALUES ($1, $2, $3, $4, $5)
-	`
 )
 
 type Notification interface {
@@ -114,65 +112,101 @@ type PlanState struct {
 
 // Determine the type of a notification, and pass it to the relevant handler.
 // Handlers would provide logic to respond to each type of notification. In our example,
-// they simply record the notification as an Activity.
-func (s *server) parseNotification(ctx context.Context, n Notification) []error {
+// they simply record the notification as an Activity. Warnings describe parts
+// of the notification that were skipped without failing it.
+func (s *server) parseNotification(ctx context.Context, n Notification) ([]string, []error) {
+	var warnings []string
 	var errs []error
 	s.e.Logger.Info("Got notification of type " + n.GetType())
 	switch n.GetType() {
 	case Suspended:
-		errs = s.suspensionNotification(ctx, n.(*SuspensionNotification))
+		warnings, errs = s.suspensionNotification(ctx, n.(*SuspensionNotification))
 	case Reactivated:
-		errs = s.reactivationNotification(ctx, n.(*ReactivatedNotification))
+		warnings, errs = s.reactivationNotification(ctx, n.(*ReactivatedNotification))
 	case DeprovisioningFailed:
 		errs = s.deprovisionFailedNotification(ctx, n.(*DeprovisioningFailedNotification))
 	case Updated:
-		err := s.updateNotification(ctx, n.(*UpdatedNotification))
+		warning, err := s.updateNotification(ctx, n.(*UpdatedNotification))
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
 		if err != nil {
 			errs = append(errs, err)
 		}
 	default:
 		errs = append(errs, errors.New("unrecognized notification type"))
 	}
-	return errs
+	return warnings, errs
 }
 
 // Suspension notifications are used to communicate that a given account/user has
-// been suspended for some reason (e.g. overdue billing)
-func (s *server) suspensionNotification(ctx context.Context, n *SuspensionNotification) []error {
-	errs := []error{}
-	for _, uuid := range n.Payload.ResourceUUIDs {
-		// Any logic needed to handle suspended users in your application would go here
-		err := s.writeNotification(ctx, n, uuid)
-		if err != nil {
-			errs = append(errs, err)
-		}
-	}
-
-	return errs
+// been suspended for some reason (e.g. overdue billing). Suspended accounts can
+// no longer sign in until they are reactivated.
+func (s *server) suspensionNotification(ctx context.Context, n *SuspensionNotification) ([]string, []error) {
+	return s.setStatus(ctx, n, n.Payload.ResourceUUIDs, models.Suspended)
 }
 
 // Reactivation notifications are used to communicate that a previously-suspended account/user
 // is back in good standing.
-func (s *server) reactivationNotification(ctx context.Context, n *ReactivatedNotification) []error {
-	errs := []error{}
-	for _, uuid := range n.Payload.ResourceUUIDs {
-		// Any logic needed to handle reactivating users in your application would go here
-		err := s.writeNotification(ctx, n, uuid)
-		if err != nil {
-			errs = append(errs, err)
+func (s *server) reactivationNotification(ctx context.Context, n *ReactivatedNotification) ([]string, []error) {
+	return s.setStatus(ctx, n, n.Payload.ResourceUUIDs, models.Active)
+}
+
+// Set the status of every given account and record the notification against
+// each, all in one transaction. Resources we have no live account for, because
+// they are unknown, deprovisioned or purged, are skipped and returned as
+// warnings. If any other account cannot be updated, none are.
+func (s *server) setStatus(ctx context.Context, n Notification, uuids []string, status models.Status) ([]string, []error) {
+	var updated []string
+	var warnings []string
+	err := s.db.InTx(ctx, func(tx store.Store) error {
+		updated = nil
+		warnings = nil
+		for _, uuid := range uuids {
+			err := tx.UpdateStatus(ctx, uuid, status)
+			if errors.Is(err, store.ErrNotFound) {
+				s.e.Logger.Warn("Skipping status update of " + uuid + ": no live account")
+				warnings = append(warnings, uuid+": no live account, skipped")
+				continue
+			}
+			if err != nil {
+				s.e.Logger.Error("Unable to update status of " + uuid + ": " + err.Error())
+				return fmt.Errorf("%s: %w", uuid, err)
+			}
+
+			err = s.writeNotification(ctx, tx, n, uuid)
+			if err != nil {
+				return fmt.Errorf("%s: %w", uuid, err)
+			}
+			updated = append(updated, uuid)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, []error{err}
 	}
 
-	return errs
+	for _, uuid := range updated {
+		s.entitlementCache.invalidate(uuid)
+	}
+	return warnings, nil
 }
 
 // Deprovisioning Failed notifications are used to inform you that a deprovisioning request
-// for a given user failed.
+// for a given user failed. Each resource is marked as needing attention and our
+// own deprovisioning is retried in the background until it succeeds or an
+// operator resolves it. The failure and the notification are recorded together
+// for each resource.
 func (s *server) deprovisionFailedNotification(ctx context.Context, n *DeprovisioningFailedNotification) []error {
 	errs := []error{}
 	for _, uuid := range n.Payload.ResourceUUIDs {
-		// Logic to handle failed deprovisions would go here
-		err := s.writeNotification(ctx, n, uuid)
+		err := s.db.InTx(ctx, func(tx store.Store) error {
+			err := s.reportDeprovisionFailure(ctx, tx, uuid)
+			if err != nil {
+				return err
+			}
+			return s.writeNotification(ctx, tx, n, uuid)
+		})
 		if err != nil {
 			errs = append(errs, err)
 		}
@@ -182,34 +216,98 @@ func (s *server) deprovisionFailedNotification(ctx context.Context, n *Deprovisi
 }
 
 // Update notifications are sent when a user's information or plan changes.
-func (s *server) updateNotification(ctx context.Context, n *UpdatedNotification) error {
-	// Logic to update a user's plan or state would go here
-	err := s.writeNotification(ctx, n, n.Payload.Resource.UUID)
+// The account is brought in line with DigitalOcean's view of the resource, so
+// it stays correct even if we missed a plan change request. Notifications can
+// arrive out of order, so ones older than the last applied change are ignored.
+// A plan change also gets the account a new license key. A resource we have
+// no account for is skipped and returned as a warning.
+func (s *server) updateNotification(ctx context.Context, n *UpdatedNotification) (string, error) {
+	resource := n.Payload.Resource
+	if resource.UpdatedAt.Seconds == 0 {
+		return "", errors.New("updated notification has no resource updated_at")
+	}
+
+	update := store.AccountUpdate{
+		Name:      resource.Name,
+		PlanSlug:  n.Payload.Plan.Slug,
+		UpdatedAt: time.Unix(int64(resource.UpdatedAt.Seconds), 0),
+	}
+	if status, ok := resourceStatus(resource.State); ok {
+		update.Status = &status
+	} else {
+		s.e.Logger.Warn("Unknown resource state " + resource.State + ", leaving status of " + resource.UUID + " as it is")
+	}
+
+	var warning string
+	err := s.db.InTx(ctx, func(tx store.Store) error {
+		warning = ""
+		account, err := tx.GetAccount(ctx, resource.UUID)
+		if errors.Is(err, store.ErrNotFound) {
+			s.e.Logger.Warn("Skipping update of " + resource.UUID + ": no account")
+			warning = resource.UUID + ": no account, skipped"
+			return nil
+		}
+		if err != nil {
+			s.e.Logger.Error("Unable to apply update to " + resource.UUID + ": " + err.Error())
+			return err
+		}
+
+		applied, err := tx.ApplyAccountUpdate(ctx, resource.UUID, update)
+		if err != nil {
+			s.e.Logger.Error("Unable to apply update to " + resource.UUID + ": " + err.Error())
+			return err
+		}
+		if !applied {
+			s.e.Logger.Info("Ignoring out of order update to " + resource.UUID)
+		} else if update.PlanSlug != "" && update.PlanSlug != account.PlanSlug {
+			// The license key names the old plan
+			account.PlanSlug = update.PlanSlug
+			err = s.replaceLicenseKey(ctx, tx, account)
+			if err != nil {
+				return err
+			}
+		}
+
+		return s.writeNotification(ctx, tx, n, resource.UUID)
+	})
 	if err != nil {
-		return err
+		return "", err
+	}
+	if warning != "" {
+		return warning, nil
 	}
 
-	return nil
+	s.entitlementCache.invalidate(resource.UUID)
+	return "", nil
 }
 
-// We write notifications to our Activities table for this example.
-func (s *server) writeNotification(ctx context.Context, n Notification, uuid string) error {
-	var id int
+// Map the state DigitalOcean reports for a resource to an account status
+func resourceStatus(state string) (models.Status, bool) {
+	switch state {
+	case "active":
+		return models.Active, true
+	case "suspended":
+		return models.Suspended, true
+	}
+	return 0, false
+}
 
+// We write notifications to our Activities table for this example.
+func (s *server) writeNotification(ctx context.Context, db store.Store, n Notification, uuid string) error {
 	s.e.Logger.Info("Writing notification")
-	err := s.db.QueryRow(ctx, GetAccountSQL, uuid).Scan(&id)
+	account, err := db.GetAccount(ctx, uuid)
 	if err != nil {
 		s.e.Logger.Error("Error finding account id: " + err.Error())
 		return err
 	}
 
-	_, err = s.db.Exec(ctx, InsertActivitySQL,
-		id,
-		uuid,
-		"DigitalOcean",
-		n.GetType(),
-		n.GetPayload(),
-	)
+	err = db.CreateActivity(ctx, &models.Activity{
+		AccountId:    account.Id,
+		ResourceUUID: uuid,
+		Type:         "DigitalOcean",
+		Title:        n.GetType(),
+		Body:         n.GetPayload(),
+	})
 	if err != nil {
 		s.e.Logger.Error("Error writing notification: " + err.Error())
 		return err
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sample_app/internal/dosim"
+	"sample_app/models"
+	"strings"
+	"testing"
+)
+
+// Status notifications skip resources we have no live account for instead of
+// failing the whole batch
+func TestSuspensionSkipsUnknownResources(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	r := testResource("0b7c2d4e-5f6a-4b1c-8d9e-2a3b4c5d6e7f")
+	ts.provision(t, r)
+
+	res, err := ts.sim.NotifyResources(ctx, dosim.Suspended, []string{"unknown-uuid", r.UUID})
+	expectStatus(t, "suspend", res, err, http.StatusOK)
+	if status := ts.account(t, r.UUID).Status; status != models.Suspended {
+		t.Errorf("status %v, want suspended", status)
+	}
+}
+
+// An update for a resource we have no account for is skipped with a warning
+func TestUpdateSkipsUnknownResource(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+
+	res, err := ts.sim.NotifyUpdated(ctx, testResource("6d5e4f3a-2b1c-4d0e-9f8a-7b6c5d4e3f2a"), "active", "Basic")
+	expectStatus(t, "update", res, err, http.StatusOK)
+	if !strings.Contains(res.Body, "6d5e4f3a-2b1c-4d0e-9f8a-7b6c5d4e3f2a: no account, skipped") {
+		t.Errorf("body %s, want a warning about the resource", res.Body)
+	}
+}
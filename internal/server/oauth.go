@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"sample_app/internal/store"
+	"sample_app/models"
+	"time"
+)
+
+// How long an authorization code is assumed to be valid for when DigitalOcean
+// does not say
+const defaultAuthCodeLifetime = 10 * time.Minute
+
+// Returned when acting on DigitalOcean's behalf for a resource whose
+// authorization code could not be exchanged, so we have no tokens for it
+type NoGrantError struct{}
+
+func (e *NoGrantError) Error() string {
+	return "DigitalOcean never authorized this resource. It has to be provisioned again before its config can be changed."
+}
+
+// Queue the authorization code from a provisioning request to be exchanged for
+// tokens. Must run in the same transaction as the account is saved in.
+func (s *server) queueAuthCode(ctx context.Context, tx store.Store, oauth OauthGrant, uuid string) error {
+	expiresAt := time.Unix(int64(oauth.Expires_at), 0)
+	if oauth.Expires_at == 0 {
+		expiresAt = time.Now().Add(defaultAuthCodeLifetime)
+	}
+
+	return tx.SaveOAuthGrant(ctx, &models.OAuthGrant{
+		ResourceUUID: uuid,
+		Code:         oauth.Code,
+		ExpiresAt:    expiresAt,
+		// Only picked up by the background job if the first attempt does not get to it
+		NextAttemptAt: time.Now().Add(s.config.oauthExchangeBackoff),
+	})
+}
+
+// Exchange every queued authorization code whose next attempt is due
+func (s *server) exchangeDueAuthCodes(ctx context.Context) {
+	grants, err := s.db.ListDueOAuthGrants(ctx, time.Now())
+	if err != nil {
+		s.e.Logger.Error("Unable to list authorization codes: " + err.Error())
+		return
+	}
+
+	for _, grant := range grants {
+		if ctx.Err() != nil {
+			return
+		}
+		err = s.exchangeAuthCode(ctx, grant.ResourceUUID)
+		if err != nil {
+			s.e.Logger.Error("Unable to exchange authorization code for " + grant.ResourceUUID + ": " + err.Error())
+		}
+	}
+}
+
+// Make one attempt at trading a resource's queued authorization code for an
+// access token and refresh token. Failed attempts are retried with backoff
+// until the code expires. If that happens, or DigitalOcean rejects the code
+// outright, the account is marked as failed and an alert raised.
+func (s *server) exchangeAuthCode(ctx context.Context, uuid string) error {
+	var failed error
+	err := s.db.InTx(ctx, func(tx store.Store) error {
+		grant, err := tx.LockOAuthGrant(ctx, uuid)
+		if err == store.ErrNotFound {
+			// Someone else exchanged it while we waited for the lock
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		token, err := s.api.ExchangeAuthCode(ctx, grant.Code)
+		if err == nil {
+			_, err = s.saveToken(ctx, tx, token, uuid)
+			if err != nil {
+				return err
+			}
+			return s.finishAuthCode(ctx, tx, uuid, models.OAuthActive)
+		}
+
+		s.e.Logger.Info("Error while trading auth code: " + err.Error())
+		now := time.Now()
+		grant.Attempts++
+		grant.LastError = err.Error()
+		if !retryableAPIError(err) || !now.Before(grant.ExpiresAt) {
+			failed = err
+			return s.failAuthCode(ctx, tx, grant)
+		}
+
+		grant.NextAttemptAt = now.Add(backoffDelay(s.config.oauthExchangeBackoff, grant.Attempts-1, maxRetryDelay))
+		if grant.NextAttemptAt.After(grant.ExpiresAt) {
+			grant.NextAttemptAt = grant.ExpiresAt
+		}
+		return tx.UpdateOAuthGrant(ctx, grant)
+	})
+
+	if err == nil && failed != nil {
+		s.alert(ctx, "Unable to exchange the authorization code for resource "+uuid+
+			", so we have no tokens for it until DigitalOcean provisions it again: "+failed.Error())
+	}
+	return err
+}
+
+// Record that the resource's authorization code was exchanged, or never will be
+func (s *server) finishAuthCode(ctx context.Context, tx store.Store, uuid string, state models.OAuthState) error {
+	err := tx.UpdateOAuthState(ctx, uuid, state)
+	if err != nil {
+		return err
+	}
+
+	return tx.DeleteOAuthGrant(ctx, uuid)
+}
+
+// Give up on a resource's authorization code, and note why on the account
+func (s *server) failAuthCode(ctx context.Context, tx store.Store, grant *models.OAuthGrant) error {
+	account, err := tx.GetAccount(ctx, grant.ResourceUUID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.CreateActivity(ctx, &models.Activity{
+		AccountId:    account.Id,
+		ResourceUUID: grant.ResourceUUID,
+		Type:         "OAuth",
+		Title:        "Authorization code exchange failed",
+		Body:         grant.LastError,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.finishAuthCode(ctx, tx, grant.ResourceUUID, models.OAuthFailed)
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sample_app/internal/digitalocean"
+	"sample_app/internal/dosim"
+	"sample_app/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Sits in front of the fake DigitalOcean API and answers token requests with
+// an error status while one is set
+type tokenOutage struct {
+	mu     sync.Mutex
+	status int
+	api    http.Handler
+}
+
+func (o *tokenOutage) set(status int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.status = status
+}
+
+func (o *tokenOutage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	status := o.status
+	o.mu.Unlock()
+
+	if status == 0 || r.URL.Path != "/v2/add-ons/oauth/token" {
+		o.api.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"id": "outage", "message": "simulated outage"})
+}
+
+// Route the server's calls to DigitalOcean through an outage it can switch on,
+// and collect the alerts it raises
+func (ts *testServer) withTokenOutage(t *testing.T) (*tokenOutage, chan string) {
+	t.Helper()
+	outage := &tokenOutage{api: ts.api}
+	apiServer := httptest.NewServer(outage)
+	t.Cleanup(apiServer.Close)
+	ts.server.api = digitalocean.NewClient(apiServer.URL, "sim", nil)
+
+	alerts := make(chan string, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		alerts <- string(body)
+	}))
+	t.Cleanup(webhook.Close)
+	ts.config.alertWebhookURL = webhook.URL
+
+	return outage, alerts
+}
+
+// Provision r without exchanging its authorization code. The handler's own
+// attempt still runs in the background.
+func (ts *testServer) provisionOnly(t *testing.T, r dosim.Resource) {
+	t.Helper()
+	res, err := ts.sim.Provision(context.Background(), r)
+	expectStatus(t, "provision", res, err, http.StatusOK)
+}
+
+func (ts *testServer) oauthGrant(t *testing.T, uuid string) *models.OAuthGrant {
+	t.Helper()
+	grants, err := ts.db.ListOAuthGrants(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range grants {
+		if grants[i].ResourceUUID == uuid {
+			return &grants[i]
+		}
+	}
+	return nil
+}
+
+func expectAlert(t *testing.T, alerts chan string) {
+	t.Helper()
+	select {
+	case <-alerts:
+	case <-time.After(5 * time.Second):
+		t.Error("no alert raised")
+	}
+}
+
+func TestAuthCodeRetried(t *testing.T) {
+	ts := newTestServer(t)
+	ts.config.oauthExchangeBackoff = 0
+	ctx := context.Background()
+	outage, _ := ts.withTokenOutage(t)
+	r := testResource("c4d5e6f7-0819-4a2b-9c3d-4e5f60718293")
+
+	outage.set(http.StatusServiceUnavailable)
+	ts.provisionOnly(t, r)
+	err := ts.exchangeAuthCode(ctx, r.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grant := ts.oauthGrant(t, r.UUID)
+	if grant == nil || grant.Attempts == 0 || grant.LastError == "" {
+		t.Fatalf("grant during an outage: %+v, want it kept with the failed attempt", grant)
+	}
+	if state := ts.account(t, r.UUID).OAuthState; state != models.OAuthPending {
+		t.Errorf("OAuth state during an outage is %q, want pending", state)
+	}
+
+	outage.set(0)
+	ts.exchangeDueAuthCodes(ctx)
+	if state := ts.account(t, r.UUID).OAuthState; state != models.OAuthActive {
+		t.Errorf("OAuth state after the outage is %q, want active", state)
+	}
+	if grant := ts.oauthGrant(t, r.UUID); grant != nil {
+		t.Errorf("grant %+v kept after the exchange", grant)
+	}
+	_, err = ts.db.GetToken(ctx, r.UUID)
+	if err != nil {
+		t.Errorf("no token after the exchange: %v", err)
+	}
+}
+
+func TestAuthCodeGivenUp(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		expire bool
+	}{
+		{"rejected", http.StatusBadRequest, false},
+		{"expired", http.StatusServiceUnavailable, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			ctx := context.Background()
+			outage, alerts := ts.withTokenOutage(t)
+			r := testResource("d5e6f708-192a-4b3c-8d4e-5f6071829304")
+
+			outage.set(tt.status)
+			ts.provisionOnly(t, r)
+			if tt.expire {
+				err := ts.exchangeAuthCode(ctx, r.UUID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if grant := ts.oauthGrant(t, r.UUID); grant != nil {
+					grant.ExpiresAt = time.Now().Add(-time.Second)
+					err = ts.db.SaveOAuthGrant(ctx, grant)
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			err := ts.exchangeAuthCode(ctx, r.UUID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectAlert(t, alerts)
+
+			if state := ts.account(t, r.UUID).OAuthState; state != models.OAuthFailed {
+				t.Errorf("OAuth state is %q, want failed", state)
+			}
+			if grant := ts.oauthGrant(t, r.UUID); grant != nil {
+				t.Errorf("grant %+v kept after giving up", grant)
+			}
+			activities, err := ts.db.ListActivities(ctx, r.UUID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := false
+			for _, a := range activities {
+				found = found || a.Title == "Authorization code exchange failed"
+			}
+			if !found {
+				t.Error("failure not recorded in the account's activity")
+			}
+
+			_, err = ts.editConfig(ctx, r.UUID, &ConfigEditRequest{Unset: []string{"API_URL"}})
+			if _, ok := err.(*NoGrantError); !ok {
+				t.Errorf("config edit without a grant: %v, want NoGrantError", err)
+			}
+		})
+	}
+}
@@ -2,33 +2,53 @@ package server
 
 import (
 	"context"
+	"sample_app/internal/store"
 )
 
 type PlanChangeRequest struct {
 	PlanSlug string `json:"plan_slug"`
 }
 
-const (
-	UpdatePlanSQL = `
-	UPDATE accounts
-	SET plan_slug=$2
-	WHERE resource_uuid=$1;
-	`
-)
-
 // If a user chooses to change their plan, DigitalOcean will send a Plan Change request
-// with details of the new plan they are using
+// with details of the new plan they are using. The plan must be one the
+// account's app offers. License keys name the plan they were issued for, so
+// the account gets a new one, which is pushed to DigitalOcean in the background.
+// Changes our policies do not allow are refused.
 func (s *server) planChange(ctx context.Context, req *PlanChangeRequest, uuid string) error {
-	commandTag, err := s.db.Exec(ctx, UpdatePlanSQL,
-		uuid,
-		req.PlanSlug,
-	)
+	err := s.db.InTx(ctx, func(tx store.Store) error {
+		account, err := tx.GetAccount(ctx, uuid)
+		if err == store.ErrNotFound || (err == nil && account.Deprovisioned()) {
+			return &NotFoundError{}
+		} else if err != nil {
+			return err
+		}
+
+		err = s.checkPlan(account.AppSlug, req.PlanSlug)
+		if err != nil {
+			return err
+		}
+		if account.PlanSlug == req.PlanSlug {
+			return nil
+		}
+		err = s.checkPlanChangePolicy(account, req.PlanSlug)
+		if err != nil {
+			return err
+		}
+
+		err = tx.UpdatePlan(ctx, uuid, req.PlanSlug)
+		if err != nil {
+			return err
+		}
+		account.PlanSlug = req.PlanSlug
 
+		// The license key names the old plan
+		return s.replaceLicenseKey(ctx, tx, account)
+	})
 	if err != nil {
 		return err
-	} else if commandTag.RowsAffected() == 0 {
-		return &NotFoundError{}
 	}
 
+	// Product services should see the new plan straight away
+	s.entitlementCache.invalidate(uuid)
 	return nil
 }
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"sample_app/internal/policy"
+	"sample_app/internal/store"
+	"sample_app/models"
+	"strconv"
+)
+
+// Check a provisioning request against our policies. Call it from inside the
+// provisioning transaction, after the team is saved: saving it locks the
+// team's row, so the team's resources are counted one request at a time.
+func (s *server) checkProvisioningPolicy(ctx context.Context, tx store.Store, req *ProvisioningRequest) error {
+	plan, err := s.catalog.Current().Plan(req.AppSlug, req.PlanSlug)
+	if err != nil {
+		return err
+	}
+
+	// A resource provisioned again may stay on its plan
+	currentPlanSlug := ""
+	existing, err := tx.GetAccount(ctx, req.ResourceUUID)
+	if err == nil && !existing.Deprovisioned() && existing.AppSlug == req.AppSlug {
+		currentPlanSlug = existing.PlanSlug
+	} else if err != nil && err != store.ErrNotFound {
+		return err
+	}
+
+	teamResources := 0
+	if req.TeamID != "" {
+		accounts, err := tx.ListTeamAccounts(ctx, req.TeamID)
+		if err != nil {
+			return err
+		}
+		for _, account := range accounts {
+			if !account.Deprovisioned() && account.ResourceUUID != req.ResourceUUID {
+				teamResources++
+			}
+		}
+	}
+
+	err = s.policies.Current().CheckProvisioning(&policy.Provisioning{
+		AppSlug:  req.AppSlug,
+		PlanSlug: req.PlanSlug,
+		PlanName: plan.Name,
+		Email:    req.Email,
+		TeamID:   req.TeamID,
+
+		CurrentPlanSlug: currentPlanSlug,
+		Metadata: map[string]string{
+			"language":         req.Metadata.Language,
+			"email_preference": strconv.FormatBool(req.Metadata.EmailPreference),
+		},
+		TeamResources: teamResources,
+	})
+	if err != nil {
+		s.e.Logger.Info("Refused provisioning of " + req.ResourceUUID + ": " + err.Error())
+	}
+	return err
+}
+
+// Check a change of account to another plan against our policies
+func (s *server) checkPlanChangePolicy(account *models.Account, planSlug string) error {
+	plan, err := s.catalog.Current().Plan(account.AppSlug, planSlug)
+	if err != nil {
+		return err
+	}
+
+	err = s.policies.Current().CheckPlanChange(&policy.PlanChange{
+		AppSlug:  account.AppSlug,
+		PlanSlug: planSlug,
+		PlanName: plan.Name,
+		TeamID:   account.TeamId,
+
+		CurrentPlanSlug: account.PlanSlug,
+	})
+	if err != nil {
+		s.e.Logger.Info("Refused plan change of " + account.ResourceUUID + ": " + err.Error())
+	}
+	return err
+}
+
+// Load the policies again, keeping the current ones if the file is invalid
+func (s *server) reloadPolicy() (*policy.Policy, error) {
+	p, err := s.policies.Reload()
+	if err != nil {
+		s.e.Logger.Error("Unable to reload policies: " + err.Error())
+		return nil, err
+	}
+
+	s.e.Logger.Info("Loaded policies version " + strconv.Itoa(p.Version))
+	return p, nil
+}
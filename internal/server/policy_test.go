@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sample_app/internal/policy"
+	"testing"
+)
+
+// Replace the server's policies with ones read from data
+func (ts *testServer) setPolicies(t *testing.T, data string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.json")
+	err := os.WriteFile(path, []byte(data), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.policies, err = policy.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Resources already on a closed plan keep it, but nothing new can join it
+func TestClosedPlan(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	onBasic := testResource("3e2d1c0b-9a8f-4e7d-8c6b-5a4f3e2d1c0b")
+	onPro := testResource("7f6e5d4c-3b2a-4918-8f7e-6d5c4b3a2f1e")
+	onPro.PlanSlug = "pro"
+	ts.provision(t, onBasic)
+	ts.provision(t, onPro)
+
+	ts.setPolicies(t, `{"version": 1, "closed_plans": {"sample_app": ["basic"]}}`)
+
+	res, err := ts.sim.Provision(ctx, onBasic)
+	expectStatus(t, "provision again on the closed plan", res, err, http.StatusOK)
+
+	res, err = ts.sim.ChangePlan(ctx, onBasic.UUID, "basic")
+	expectStatus(t, "change to the plan it is on", res, err, http.StatusNoContent)
+
+	res, err = ts.sim.ChangePlan(ctx, onPro.UUID, "basic")
+	expectStatus(t, "change to the closed plan", res, err, http.StatusUnprocessableEntity)
+
+	res, err = ts.sim.Provision(ctx, testResource("1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d"))
+	expectStatus(t, "provision on the closed plan", res, err, http.StatusUnprocessableEntity)
+}
@@ -2,9 +2,8 @@ package server
 
 import (
 	"context"
+	"sample_app/internal/store"
 	"sample_app/models"
-
-	"github.com/jackc/pgx/v4"
 )
 
 type ProvisioningRequest struct {
@@ -63,83 +62,105 @@ type ProvisioningResponse struct {
 	Message string `json:"message"`
 }
 
-type ProvisioningConfig struct {
-	LicenseKey string `json:"LICENSE_KEY"`
-}
-
-type ConfigUpdate struct {
-	Config ProvisioningConfig `json:"config"`
-}
-
-const (
-	GetAccountSQL = `
-	SELECT id FROM accounts WHERE resource_uuid=$1;
-	`
-
-	InsertAccountSQL = `
-	INSERT INTO accounts (name, email, app_slug, plan_slug, resource_uuid, language, email_preference, source, status, license_key) 
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
-	`
-
-	UpdateAccountSQL = `
-	UPDATE accounts
-	SET name=$2, email=$3, app_slug=$4, plan_slug=$5, language=$6, email_preference=$7, status=$8, license_key=$9
-	WHERE id=$1;
-	`
-)
+// Config vars by name, rendered from the templates of the resource's plan
+type ProvisioningConfig map[string]string
 
 // When a user adds your add-on to their account, DigitalOcean will send you a
 // provisioning request with user information for you to create an account in your application
 func (s *server) provisionAccount(ctx context.Context, req *ProvisioningRequest) (*ProvisioningResponse, error) {
-	licenseKey := newLicenseKey()
-	var id int
-
-	// Check if this account UUID has previously provisioned an account
-	err := s.db.QueryRow(ctx, GetAccountSQL, req.ResourceUUID).Scan(&id)
-	if err == pgx.ErrNoRows {
-		// If not, create a new account for them
-		_, err = s.db.Exec(ctx, InsertAccountSQL,
-			req.Name,
-			req.Email,
-			req.AppSlug,
-			req.PlanSlug,
-			req.ResourceUUID,
-			req.Metadata.Language,
-			req.Metadata.EmailPreference,
-			"DigitalOcean",
-			models.Active,
-			licenseKey,
-		)
-	} else if err == nil {
-		// If so, update the existing account
-		_, err = s.db.Exec(ctx, UpdateAccountSQL,
-			id,
-			req.Name,
-			req.Email,
-			req.AppSlug,
-			req.PlanSlug,
-			req.Metadata.Language,
-			req.Metadata.EmailPreference,
-			models.Active,
-			licenseKey,
-		)
-	} else {
-		s.e.Logger.Error("Unable to query for account presence: " + err.Error())
+	err := s.checkPlan(req.AppSlug, req.PlanSlug)
+	if err != nil {
 		return nil, err
 	}
 
+	licenseKey, expiresAt, err := s.newLicenseKey(req.ResourceUUID, req.AppSlug, req.PlanSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	account := &models.Account{
+		Name:            req.Name,
+		Email:           req.Email,
+		AppSlug:         req.AppSlug,
+		PlanSlug:        req.PlanSlug,
+		ResourceUUID:    req.ResourceUUID,
+		Language:        req.Metadata.Language,
+		EmailPreference: req.Metadata.EmailPreference,
+		Source:          "DigitalOcean",
+		Status:          models.Active,
+		LicenseKey:      licenseKey,
+		OAuthState:      models.OAuthPending,
+		TeamId:          req.TeamID,
+	}
+
+	var config ProvisioningConfig
+	err = s.db.InTx(ctx, func(tx store.Store) error {
+		// Link the account to the team provisioning it, so the team's
+		// resources can be seen together
+		if req.TeamID != "" {
+			err := tx.SaveTeam(ctx, &models.Team{Id: req.TeamID})
+			if err != nil {
+				return err
+			}
+		}
+
+		// Refuse requests our policies do not allow
+		err := s.checkProvisioningPolicy(ctx, tx, req)
+		if err != nil {
+			return err
+		}
+
+		// Check if this account UUID has previously provisioned an account
+		existing, err := tx.GetAccount(ctx, req.ResourceUUID)
+		if err == store.ErrNotFound {
+			// If not, create a new account for them
+			err = tx.CreateAccount(ctx, account)
+		} else if err == nil {
+			// If so, update the existing account
+			account.Id = existing.Id
+			if account.TeamId == "" {
+				account.TeamId = existing.TeamId
+			}
+			err = tx.UpdateAccount(ctx, account)
+		} else {
+			s.e.Logger.Error("Unable to query for account presence: " + err.Error())
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		// Keys from before the resource was last deprovisioned stop working
+		err = s.recordLicenseKey(ctx, tx, req.ResourceUUID, licenseKey, expiresAt, 0)
+		if err != nil {
+			return err
+		}
+
+		// Start from scratch, so a resource provisioned again gets new secrets
+		vars, err := s.renderConfigVars(account, nil, nil)
+		if err != nil {
+			return err
+		}
+		err = tx.SetConfigVars(ctx, req.ResourceUUID, vars)
+		if err != nil {
+			return err
+		}
+		config = configVarMap(vars)
+
+		// Queue the authorization code to be exchanged for tokens
+		return s.queueAuthCode(ctx, tx, req.OauthGrant, req.ResourceUUID)
+	})
 	if err != nil {
 		s.e.Logger.Error("Unable to provision account: " + err.Error())
 		return nil, err
 	}
+	s.entitlementCache.invalidate(req.ResourceUUID)
 
 	// Any user config information should be contained in the provisioning response.
-	// Our example uses license keys as sample config information.
+	// Our example renders it from templates in the plan catalog.
 	resp := &ProvisioningResponse{
-		Id: req.ResourceUUID,
-		Config: ProvisioningConfig{
-			LicenseKey: licenseKey,
-		},
+		Id:      req.ResourceUUID,
+		Config:  config,
 		Message: "Account provisioning succeeded!",
 	}
 	return resp, nil
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// How often idle buckets are forgotten
+const rateLimitSweepInterval = time.Minute
+
+// Gives each key, such as a client IP, its own token bucket. Buckets hold a
+// minute's worth of requests, so one that has been idle for a minute is full
+// again and can be forgotten.
+type rateLimiter struct {
+	perMinute int
+
+	mu        sync.Mutex
+	buckets   map[string]*rateBucket
+	lastSweep time.Time
+}
+
+type rateBucket struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// A limiter allowing perMinute requests a minute for each key. It allows
+// everything when perMinute is 0 or less.
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{
+		perMinute: perMinute,
+		buckets:   map[string]*rateBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// Take a request from key's bucket. If it is empty, reports false and how long
+// until the next request would be allowed.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	if l.perMinute <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		for k, bucket := range l.buckets {
+			if now.Sub(bucket.lastUsed) >= time.Minute {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &rateBucket{limiter: rate.NewLimiter(rate.Every(time.Minute/time.Duration(l.perMinute)), l.perMinute)}
+		l.buckets[key] = bucket
+	}
+	bucket.lastUsed = now
+
+	reservation := bucket.limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"sample_app/models"
+	"sync"
+)
+
+// Makes sure only one goroutine refreshes a given resource's token at a time.
+// Anyone asking for a refresh while one is in flight waits for it and shares
+// its result instead of spending the same refresh token a second time.
+type refreshGroup struct {
+	mu    sync.Mutex
+	calls map[string]*refreshCall
+}
+
+type refreshCall struct {
+	done  chan struct{}
+	token *models.Token
+	err   error
+}
+
+func newRefreshGroup() *refreshGroup {
+	return &refreshGroup{
+		calls: map[string]*refreshCall{},
+	}
+}
+
+// Run fn for uuid, unless a call for uuid is already running, in which case
+// wait for that one and return its result
+func (g *refreshGroup) do(uuid string, fn func() (*models.Token, error)) (*models.Token, error) {
+	g.mu.Lock()
+	if call, ok := g.calls[uuid]; ok {
+		g.mu.Unlock()
+		<-call.done
+		return call.token, call.err
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	g.calls[uuid] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, uuid)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.token, call.err = fn()
+	return call.token, call.err
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Refreshes access tokens in the background before they expire, so requests
+// that need a token rarely have to wait on DigitalOcean for one.
+type tokenRefresher struct {
+	s *server
+
+	mu       sync.Mutex
+	lastRun  *RefreshRun
+	failures map[string]*RefreshFailure
+}
+
+// Summary of a single pass over the tokens table
+type RefreshRun struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Refreshed  int       `json:"refreshed"`
+	Failed     int       `json:"failed"`
+
+	// Set if the tokens to refresh could not be listed at all
+	Error string `json:"error,omitempty"`
+}
+
+// A resource whose token could not be refreshed. Cleared once a refresh succeeds.
+type RefreshFailure struct {
+	ResourceUUID  string    `json:"resource_uuid"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error"`
+	LastAttemptAt time.Time `json:"last_attempt_at"`
+}
+
+type RefreshStatus struct {
+	LastRun  *RefreshRun      `json:"last_run"`
+	Failures []RefreshFailure `json:"failures"`
+}
+
+func newTokenRefresher(s *server) *tokenRefresher {
+	return &tokenRefresher{
+		s:        s,
+		failures: map[string]*RefreshFailure{},
+	}
+}
+
+// Refresh tokens every configured interval until ctx is cancelled
+func (r *tokenRefresher) run(ctx context.Context) {
+	runEvery(ctx, r.s.config.tokenRefreshInterval, r.s.config.tokenRefreshJitter, r.refreshExpiring)
+}
+
+// Refresh every token that expires within the configured lead time
+func (r *tokenRefresher) refreshExpiring(ctx context.Context) {
+	run := &RefreshRun{StartedAt: time.Now()}
+	defer func() {
+		run.FinishedAt = time.Now()
+		r.mu.Lock()
+		r.lastRun = run
+		r.mu.Unlock()
+	}()
+
+	tokens, err := r.s.db.ListTokensExpiringBefore(ctx, time.Now().Add(r.s.config.tokenRefreshLeadTime))
+	if err != nil {
+		r.s.e.Logger.Error("Unable to list expiring tokens: " + err.Error())
+		run.Error = err.Error()
+		return
+	}
+
+	concurrency := r.s.config.tokenRefreshConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	for i := range tokens {
+		token := tokens[i]
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			// Spread refreshes out so they do not all hit DigitalOcean at once
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(randomDuration(r.s.config.tokenRefreshJitter)):
+			}
+
+			_, err := r.s.refreshToken(ctx, &token, token.ResourceUUID)
+			r.record(token.ResourceUUID, err)
+
+			mu.Lock()
+			if err != nil {
+				run.Failed++
+			} else {
+				run.Refreshed++
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(tokens) > 0 {
+		r.s.e.Logger.Infof("Refreshed %d tokens, %d failed", run.Refreshed, run.Failed)
+	}
+}
+
+// Keep track of which resources are failing to refresh
+func (r *tokenRefresher) record(uuid string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err == nil {
+		delete(r.failures, uuid)
+		return
+	}
+
+	r.s.e.Logger.Error("Unable to refresh token for " + uuid + ": " + err.Error())
+	failure, ok := r.failures[uuid]
+	if !ok {
+		failure = &RefreshFailure{ResourceUUID: uuid}
+		r.failures[uuid] = failure
+	}
+	failure.Attempts++
+	failure.LastError = err.Error()
+	failure.LastAttemptAt = time.Now()
+}
+
+// The last pass and every resource currently failing to refresh
+func (r *tokenRefresher) status() *RefreshStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := &RefreshStatus{
+		Failures: []RefreshFailure{},
+	}
+	if r.lastRun != nil {
+		run := *r.lastRun
+		status.LastRun = &run
+	}
+	for _, failure := range r.failures {
+		status.Failures = append(status.Failures, *failure)
+	}
+	sort.Slice(status.Failures, func(i, j int) bool {
+		return status.Failures[i].ResourceUUID < status.Failures[j].ResourceUUID
+	})
+
+	return status
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"sample_app/internal/store"
+	"sample_app/models"
+	"strconv"
+	"time"
+)
+
+// Returned when acting on a deprovision failure that has already been dealt with
+type ClosedFailureError struct {
+	Status models.RemediationStatus
+}
+
+func (e *ClosedFailureError) Error() string {
+	return "Deprovision failure is already " + string(e.Status)
+}
+
+// What operators see of a deprovision failure
+type DeprovisionFailureResponse struct {
+	ResourceUUID  string                   `json:"resource_uuid"`
+	Status        models.RemediationStatus `json:"status"`
+	Attempts      int                      `json:"attempts"`
+	LastError     string                   `json:"last_error,omitempty"`
+	NextAttemptAt *time.Time               `json:"next_attempt_at,omitempty"`
+	ReportedAt    time.Time                `json:"reported_at"`
+	ResolvedAt    *time.Time               `json:"resolved_at,omitempty"`
+	Resolution    string                   `json:"resolution,omitempty"`
+}
+
+type ResolveRequest struct {
+	Resolution string `json:"resolution"`
+}
+
+func newDeprovisionFailureResponse(f *models.DeprovisionFailure) *DeprovisionFailureResponse {
+	resp := &DeprovisionFailureResponse{
+		ResourceUUID: f.ResourceUUID,
+		Status:       f.Status,
+		Attempts:     f.Attempts,
+		LastError:    f.LastError,
+		ReportedAt:   f.ReportedAt,
+		ResolvedAt:   f.ResolvedAt,
+		Resolution:   f.Resolution,
+	}
+	if f.Status == models.RemediationPending {
+		next := f.NextAttemptAt
+		resp.NextAttemptAt = &next
+	}
+	return resp
+}
+
+// Mark a resource DigitalOcean failed to deprovision as needing attention, and
+// schedule a retry of our own deprovisioning, using db
+func (s *server) reportDeprovisionFailure(ctx context.Context, db store.Store, uuid string) error {
+	failure, err := db.ReportDeprovisionFailure(ctx, uuid, time.Now().Add(backoffDelay(s.config.deprovisionRetryBackoff, 0, maxRetryDelay)))
+	if err != nil {
+		s.e.Logger.Error("Unable to record deprovision failure for " + uuid + ": " + err.Error())
+		return err
+	}
+
+	s.e.Logger.Warn("Deprovisioning failed for " + uuid + ", status " + string(failure.Status))
+	return nil
+}
+
+// Retry every deprovision failure that is due
+func (s *server) retryDeprovisionFailures(ctx context.Context) {
+	failures, err := s.db.ListDueDeprovisionFailures(ctx, time.Now())
+	if err != nil {
+		s.e.Logger.Error("Unable to list deprovision failures: " + err.Error())
+		return
+	}
+
+	for i := range failures {
+		if ctx.Err() != nil {
+			return
+		}
+		_ = s.retryDeprovision(ctx, &failures[i])
+	}
+}
+
+// Run our deprovisioning for the failed resource again and record the outcome.
+// Once the configured number of attempts have failed, the failure is left for
+// an operator.
+func (s *server) retryDeprovision(ctx context.Context, failure *models.DeprovisionFailure) error {
+	failure.Attempts++
+	deprovisioned, err := s.deprovisionRequest(ctx, failure.ResourceUUID)
+
+	now := time.Now()
+	if _, ok := err.(*NotFoundError); ok || (err == nil && !deprovisioned) {
+		failure.Status = models.RemediationSucceeded
+		failure.ResolvedAt = &now
+		failure.Resolution = "Resource was already deprovisioned"
+	} else if err == nil {
+		failure.Status = models.RemediationSucceeded
+		failure.ResolvedAt = &now
+		failure.Resolution = "Deprovisioned on attempt " + strconv.Itoa(failure.Attempts)
+	} else {
+		s.e.Logger.Error("Retry of deprovisioning " + failure.ResourceUUID + " failed: " + err.Error())
+		failure.LastError = err.Error()
+		if failure.Attempts >= s.config.deprovisionRetryAttempts {
+			failure.Status = models.RemediationExhausted
+		} else {
+			failure.NextAttemptAt = now.Add(backoffDelay(s.config.deprovisionRetryBackoff, failure.Attempts, maxRetryDelay))
+		}
+	}
+
+	err = s.db.UpdateDeprovisionFailure(ctx, failure)
+	if err != nil {
+		s.e.Logger.Error("Unable to record deprovision retry for " + failure.ResourceUUID + ": " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// Fetch a failure that has not been dealt with yet
+func (s *server) outstandingDeprovisionFailure(ctx context.Context, uuid string) (*models.DeprovisionFailure, error) {
+	failure, err := s.db.GetDeprovisionFailure(ctx, uuid)
+	if err == store.ErrNotFound {
+		return nil, &NotFoundError{}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !failure.Outstanding() {
+		return nil, &ClosedFailureError{Status: failure.Status}
+	}
+	return failure, nil
+}
+
+// Retry a failure straight away, whether or not a retry is due
+func (s *server) retryDeprovisionNow(ctx context.Context, uuid string) (*models.DeprovisionFailure, error) {
+	failure, err := s.outstandingDeprovisionFailure(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.retryDeprovision(ctx, failure)
+	if err != nil {
+		return nil, err
+	}
+	return failure, nil
+}
+
+// Close a failure an operator has dealt with, stopping any further retries
+func (s *server) resolveDeprovisionFailure(ctx context.Context, uuid string, resolution string) (*models.DeprovisionFailure, error) {
+	failure, err := s.outstandingDeprovisionFailure(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	if resolution == "" {
+		resolution = "Resolved by an operator"
+	}
+	now := time.Now()
+	failure.Status = models.RemediationResolved
+	failure.ResolvedAt = &now
+	failure.Resolution = resolution
+
+	err = s.db.UpdateDeprovisionFailure(ctx, failure)
+	if err != nil {
+		return nil, err
+	}
+	return failure, nil
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sample_app/internal/dosim"
+	"sample_app/models"
+	"testing"
+)
+
+func TestRetryDeprovision(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// Whether our own deprovisioning already ran before the retry
+		deprovisioned  bool
+		wantResolution string
+	}{
+		{"still provisioned", false, "Deprovisioned on attempt 1"},
+		{"already deprovisioned", true, "Resource was already deprovisioned"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			ctx := context.Background()
+			r := testResource("5c4b3a29-1807-4f6e-9d5c-4b3a29180706")
+			ts.provision(t, r)
+
+			if tt.deprovisioned {
+				res, err := ts.sim.Deprovision(ctx, r.UUID)
+				expectStatus(t, "deprovision", res, err, http.StatusOK)
+			}
+			res, err := ts.sim.NotifyResources(ctx, dosim.DeprovisioningFailed, []string{r.UUID})
+			expectStatus(t, "deprovisioning failed", res, err, http.StatusOK)
+
+			failure, err := ts.db.GetDeprovisionFailure(ctx, r.UUID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ts.retryDeprovision(ctx, failure)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			failure, err = ts.db.GetDeprovisionFailure(ctx, r.UUID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if failure.Status != models.RemediationSucceeded || failure.Resolution != tt.wantResolution {
+				t.Errorf("failure is %s, %q, want succeeded, %q", failure.Status, failure.Resolution, tt.wantResolution)
+			}
+			if !ts.account(t, r.UUID).Deprovisioned() {
+				t.Error("account is not deprovisioned")
+			}
+		})
+	}
+}
@@ -3,8 +3,15 @@ package server
 import (
 	"context"
 	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sample_app/internal/catalog"
+	"sample_app/internal/digitalocean"
+	"sample_app/internal/license"
+	"sample_app/internal/policy"
+	"sample_app/internal/store"
+	"time"
 
-	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
@@ -12,50 +19,227 @@ import (
 
 type server struct {
 	e      *echo.Echo
-	db     *pgxpool.Pool
+	db     store.Store
+	api    *digitalocean.Client
 	config *serverConfig
+
+	// The apps and plans we offer
+	catalog *catalog.File
+
+	// What provisioning requests and plan changes must meet
+	policies *policy.File
+
+	// Signs license keys. Nil when no signing keys are configured.
+	licenses *license.Keyring
+
+	// For calls to anything other than DigitalOcean
+	httpClient *http.Client
+
+	refresher *tokenRefresher
+	refreshes *refreshGroup
+
+	entitlementCache *entitlementCache
+
+	// Limit license verifications by client IP and by license key
+	verifyIPLimiter  *rateLimiter
+	verifyKeyLimiter *rateLimiter
 }
 
 // Start the server for our example application.
-func StartServer(ctx context.Context, db *pgxpool.Pool) {
-	e := echo.New()
-
+func StartServer(ctx context.Context, db store.Store) {
 	config := setupServer()
 
+	s, err := newServer(db, config)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	s.runWorkers(ctx)
+	s.e.Logger.Fatal(s.e.Start(config.serverAddr))
+}
+
+// Set up the server and its routes, without starting it
+func newServer(db store.Store, config *serverConfig) (*server, error) {
+	e := echo.New()
+
 	// DigitalOcean will call your app with basic auth headers, using slug and password set up on app creation.
-	e.Use(middleware.BasicAuth(func(username, password string, c echo.Context) (bool, error) {
+	digitalOceanAuth := middleware.BasicAuth(func(username, password string, c echo.Context) (bool, error) {
 		// Uses constant time comparison to prevent timing attacks
 		if subtle.ConstantTimeCompare([]byte(username), []byte(config.appSlug)) == 1 &&
 			subtle.ConstantTimeCompare([]byte(password), []byte(config.appPassword)) == 1 {
 			return true, nil
 		}
 		return false, nil
-	}))
+	})
+
+	// Operators call the /admin endpoints with the admin API key as a bearer token.
+	adminAuth := middleware.KeyAuth(func(key string, c echo.Context) (bool, error) {
+		if config.adminAPIKey == "" {
+			return false, nil
+		}
+		return subtle.ConstantTimeCompare([]byte(key), []byte(config.adminAPIKey)) == 1, nil
+	})
+
+	// Product services call the /entitlements and /usage endpoints with their own API key as a bearer token.
+	serviceAuth := middleware.KeyAuth(func(key string, c echo.Context) (bool, error) {
+		if config.serviceAPIKey == "" {
+			return false, nil
+		}
+		return subtle.ConstantTimeCompare([]byte(key), []byte(config.serviceAPIKey)) == 1, nil
+	})
 	e.Logger.SetLevel(log.INFO)
 
+	// Client IPs are used to rate limit public endpoints, so only believe
+	// forwarding headers when we are behind a proxy that sets them
+	if config.trustProxyHeaders {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
+
+	plans, err := catalog.Open(config.catalogPath)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load plan catalog: %w", err)
+	}
+
+	policies, err := policy.Open(config.policyPath)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load policies: %w", err)
+	}
+
+	var licenses *license.Keyring
+	if config.licenseSigningKeys == "" {
+		e.Logger.Warn("LICENSE_SIGNING_KEYS is not set, license keys will not be signed")
+	} else {
+		licenses, err = license.ParseKeyring(config.licenseSigningKeys)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid LICENSE_SIGNING_KEYS: %w", err)
+		}
+	}
+
+	httpClient := &http.Client{Timeout: 30 * time.Second}
 	s := &server{
 		e:      e,
 		db:     db,
+		api:    digitalocean.NewClient(config.digitaloceanAPI, config.clientSecret, httpClient),
 		config: config,
+
+		catalog:  plans,
+		policies: policies,
+		licenses: licenses,
+
+		httpClient: httpClient,
+
+		refreshes: newRefreshGroup(),
+
+		entitlementCache: newEntitlementCache(config.entitlementsCacheTTL),
+
+		verifyIPLimiter:  newRateLimiter(config.licenseVerifyIPRate),
+		verifyKeyLimiter: newRateLimiter(config.licenseVerifyKeyRate),
 	}
+	s.refresher = newTokenRefresher(s)
+
+	// Public endpoints
+	e.GET("/license/keys", s.licenseKeysHandler)
+
+	e.POST("/license/verify", s.verifyLicenseHandler)
+
+	// Front-end session endpoints, authenticated by the session cookie
+	e.POST("/session", s.createSessionHandler)
+
+	e.GET("/session", s.sessionHandler)
+
+	e.POST("/session/switch", s.switchSessionHandler)
+
+	e.DELETE("/session", s.deleteSessionHandler)
 
 	// DigitalOcean endpoints
+	do := e.Group("/digitalocean", digitalOceanAuth)
 
-	e.POST("/digitalocean/resources", s.provisionHandler)
+	do.POST("/resources", s.provisionHandler)
 
-	e.DELETE("/digitalocean/resources/:resource_uuid", s.deprovisionHandler)
+	do.DELETE("/resources/:resource_uuid", s.deprovisionHandler)
 
-	e.PUT("/digitalocean/resources/:resource_uuid", s.planChangeHandler)
+	do.PUT("/resources/:resource_uuid", s.planChangeHandler)
 
-	e.POST("/digitalocean/notifications", s.notificationHandler)
+	do.POST("/notifications", s.notificationHandler)
 
-	e.POST("/digitalocean/sso", s.ssoHandler)
+	do.POST("/sso", s.ssoHandler)
 
 	// Vendor endpoints: for use by this example's front-end
+	vendor := e.Group("", digitalOceanAuth)
+
+	vendor.POST("/config/:uuid", s.changeConfig)
+
+	vendor.GET("/config/:uuid", s.configStatusHandler)
+
+	vendor.GET("/license-keys/:uuid", s.licenseKeysListHandler)
+
+	vendor.POST("/license-keys/:uuid/:id/revoke", s.revokeLicenseKeyHandler)
+
+	vendor.GET("/teams/:team_id", s.teamHandler)
+
+	vendor.GET("/teams/:team_id/usage", s.teamUsageHandler)
+
+	vendor.GET("/catalog", s.catalogHandler)
+
+	// Product service endpoints
+	services := e.Group("/entitlements", serviceAuth)
+
+	services.GET("", s.licenseKeyEntitlementsHandler)
+
+	services.GET("/:resource_uuid", s.entitlementsHandler)
+
+	usage := e.Group("/usage", serviceAuth)
+
+	usage.POST("", s.recordUsageHandler)
 
-	e.POST("/config/:uuid", s.changeConfig)
+	usage.GET("/:resource_uuid", s.usageHandler)
 
-	e.POST("/authorize/sso", s.authorizeHandler)
+	// Operator endpoints
+	admin := e.Group("/admin", adminAuth)
+
+	admin.GET("/tokens/refresh", s.tokenRefreshStatusHandler)
+
+	admin.GET("/tokens/:resource_uuid/history", s.tokenHistoryHandler)
+
+	admin.GET("/deprovision-failures", s.listDeprovisionFailuresHandler)
+
+	admin.POST("/deprovision-failures/:resource_uuid/retry", s.retryDeprovisionHandler)
+
+	admin.POST("/deprovision-failures/:resource_uuid/resolve", s.resolveDeprovisionFailureHandler)
+
+	admin.POST("/catalog/reload", s.reloadCatalogHandler)
+
+	admin.GET("/policy", s.policyHandler)
+
+	admin.POST("/policy/reload", s.reloadPolicyHandler)
+
+	admin.GET("/entitlements/:resource_uuid/overrides", s.listEntitlementOverridesHandler)
+
+	admin.PUT("/entitlements/:resource_uuid/overrides/:kind/:name", s.setEntitlementOverrideHandler)
+
+	admin.DELETE("/entitlements/:resource_uuid/overrides/:kind/:name", s.deleteEntitlementOverrideHandler)
+
+	admin.GET("/license/verifications/:resource_uuid", s.licenseVerificationsHandler)
+
+	admin.GET("/config/:resource_uuid", s.adminConfigStatusHandler)
+
+	admin.POST("/config/:resource_uuid", s.adminEditConfigHandler)
+
+	return s, nil
+}
 
-	e.Logger.Fatal(e.Start(config.serverAddr))
+// Start the background workers, which run until ctx is done
+func (s *server) runWorkers(ctx context.Context) {
+	config := s.config
+	go s.refresher.run(ctx)
+	go runEvery(ctx, config.deprovisionRetryInterval, 0, s.retryDeprovisionFailures)
+	go runEvery(ctx, config.configPushInterval, 0, s.dispatchConfigPushes)
+	go runEvery(ctx, config.oauthExchangeInterval, 0, s.exchangeDueAuthCodes)
+	go runEvery(ctx, config.licenseKeyRenewalInterval, 0, s.renewLicenseKeys)
+	go runEvery(ctx, config.deprovisionPurgeInterval, 0, s.purgeDeprovisioned)
+	go runEvery(ctx, config.deprovisionPurgeInterval, 0, s.purgeLicenseVerifications)
+	go runEvery(ctx, config.deprovisionPurgeInterval, 0, s.purgeSessions)
+	go s.reloadOnHangup(ctx)
 }
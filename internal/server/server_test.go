@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sample_app/internal/dosim"
+	"sample_app/internal/license"
+	"sample_app/internal/store"
+	"sample_app/models"
+	"testing"
+	"time"
+)
+
+// A server backed by a MemoryStore, talking to a fake DigitalOcean API, and a
+// simulator to send it DigitalOcean's requests. Background workers are not
+// started, so tests run them by hand.
+type testServer struct {
+	*server
+	db  *store.MemoryStore
+	api *dosim.API
+	sim *dosim.Simulator
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	api := dosim.NewAPI("sim", time.Hour)
+	apiServer := httptest.NewServer(api)
+	t.Cleanup(apiServer.Close)
+
+	t.Setenv("CLIENT_SECRET", "sim")
+	t.Setenv("DIGITALOCEAN_API_URL", apiServer.URL)
+	t.Setenv("CATALOG_FILE", "../../catalog.json")
+	t.Setenv("POLICY_FILE", "../../policy.json")
+
+	signingKey, err := license.GenerateKey("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LICENSE_SIGNING_KEYS", signingKey)
+
+	db := store.NewMemoryStore()
+	s, err := newServer(db, setupServer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.e.Logger.SetOutput(io.Discard)
+
+	addon := httptest.NewServer(s.e)
+	t.Cleanup(addon.Close)
+
+	return &testServer{
+		server: s,
+		db:     db,
+		api:    api,
+		sim: &dosim.Simulator{
+			AddonURL:    addon.URL,
+			AppSlug:     "sample_app",
+			AppPassword: "password",
+			AppSalt:     "salt",
+		},
+	}
+}
+
+func testResource(uuid string) dosim.Resource {
+	return dosim.Resource{
+		UUID:     uuid,
+		Name:     "test-resource",
+		AppSlug:  "sample_app",
+		PlanSlug: "basic",
+		Email:    "someone@example.com",
+		TeamID:   "test-team",
+		Language: "en",
+	}
+}
+
+// Provision r and exchange its authorization code, as the handler's own
+// exchange runs in the background
+func (ts *testServer) provision(t *testing.T, r dosim.Resource) *models.Account {
+	t.Helper()
+	ctx := context.Background()
+
+	res, err := ts.sim.Provision(ctx, r)
+	expectStatus(t, "provision", res, err, http.StatusOK)
+
+	err = ts.exchangeAuthCode(ctx, r.UUID)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	return ts.account(t, r.UUID)
+}
+
+func (ts *testServer) account(t *testing.T, uuid string) *models.Account {
+	t.Helper()
+	account, err := ts.db.GetAccount(context.Background(), uuid)
+	if err != nil {
+		t.Fatalf("GetAccount(%s): %v", uuid, err)
+	}
+	return account
+}
+
+func expectStatus(t *testing.T, step string, res *dosim.Response, err error, want int) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", step, err)
+	}
+	if res.StatusCode != want {
+		t.Fatalf("%s: got %s, want %d", step, res, want)
+	}
+}
+
+func TestResourceLifecycle(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	r := testResource("6a1e7f0e-3c5b-4b8e-9d2a-0f6c1b2d3e4f")
+
+	account := ts.provision(t, r)
+	if account.Status != models.Active || account.OAuthState != models.OAuthActive {
+		t.Fatalf("after provisioning: status %v, OAuth state %q", account.Status, account.OAuthState)
+	}
+	if account.TeamId != r.TeamID {
+		t.Errorf("TeamId = %q, want %q", account.TeamId, r.TeamID)
+	}
+	_, err := ts.db.GetToken(ctx, r.UUID)
+	if err != nil {
+		t.Fatalf("no token after the exchange: %v", err)
+	}
+
+	// Rotating the license key pushes the new config to DigitalOcean
+	res, err := ts.sim.TriggerConfigUpdate(ctx, r.UUID)
+	expectStatus(t, "config update", res, err, http.StatusOK)
+	rotated := ts.account(t, r.UUID)
+	if rotated.LicenseKey == account.LicenseKey {
+		t.Error("license key was not rotated")
+	}
+	pushed := ts.api.Config(r.UUID)
+	if pushed["LICENSE_KEY"] != rotated.LicenseKey {
+		t.Errorf("pushed LICENSE_KEY = %q, want %q", pushed["LICENSE_KEY"], rotated.LicenseKey)
+	}
+
+	res, err = ts.sim.NotifyResources(ctx, dosim.Suspended, []string{r.UUID})
+	expectStatus(t, "suspend", res, err, http.StatusOK)
+	if status := ts.account(t, r.UUID).Status; status != models.Suspended {
+		t.Fatalf("after suspension: status %v", status)
+	}
+
+	res, err = ts.sim.SSO(ctx, r.UUID, r.Email, "user")
+	expectStatus(t, "sso while suspended", res, err, http.StatusForbidden)
+
+	res, err = ts.sim.NotifyResources(ctx, dosim.Reactivated, []string{r.UUID})
+	expectStatus(t, "reactivate", res, err, http.StatusOK)
+	res, err = ts.sim.SSO(ctx, r.UUID, r.Email, "user")
+	expectStatus(t, "sso after reactivation", res, err, http.StatusTemporaryRedirect)
+
+	res, err = ts.sim.Deprovision(ctx, r.UUID)
+	expectStatus(t, "deprovision", res, err, http.StatusOK)
+	if !ts.account(t, r.UUID).Deprovisioned() {
+		t.Error("account is not marked deprovisioned")
+	}
+	_, err = ts.db.GetToken(ctx, r.UUID)
+	if err != store.ErrNotFound {
+		t.Errorf("GetToken after deprovisioning: %v, want ErrNotFound", err)
+	}
+
+	res, err = ts.sim.SSO(ctx, r.UUID, r.Email, "user")
+	expectStatus(t, "sso after deprovisioning", res, err, http.StatusNotFound)
+}
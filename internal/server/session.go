@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sample_app/internal/store"
+	"sample_app/models"
+	"time"
+)
+
+// How long the front-end has to exchange the code an SSO request redirects with
+const ssoCodeLifetime = time.Minute
+
+// Name of the cookie holding the session token
+const sessionCookieName = "sample_app_session"
+
+// Returned when a request has no session, or its session has ended
+type UnauthorizedError struct{}
+
+func (e *UnauthorizedError) Error() string {
+	return "Not signed in, or the session has ended"
+}
+
+// Create a single-use code for the front-end to exchange for a session
+// signed in to account
+func (s *server) issueSSOCode(ctx context.Context, account *models.Account) (string, error) {
+	code, err := newSessionSecret()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.db.SaveSSOCode(ctx, &models.SSOCode{
+		CodeHash:     hashSessionSecret(code),
+		ResourceUUID: account.ResourceUUID,
+		TeamId:       account.TeamId,
+		ExpiresAt:    time.Now().Add(ssoCodeLifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Exchange an SSO code for a new session. Each code can only be exchanged
+// once, even if the exchange fails. Returns the session's token, which only
+// ever goes in the session cookie.
+func (s *server) startSession(ctx context.Context, code string) (string, *models.Session, *models.Account, error) {
+	ssoCode, err := s.db.ConsumeSSOCode(ctx, hashSessionSecret(code))
+	if err == store.ErrNotFound || (err == nil && time.Now().After(ssoCode.ExpiresAt)) {
+		return "", nil, nil, &UnauthorizedError{}
+	} else if err != nil {
+		return "", nil, nil, err
+	}
+
+	// The account may have been suspended since it signed in
+	account, err := s.checkActive(ctx, ssoCode.ResourceUUID)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	token, err := newSessionSecret()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	session := &models.Session{
+		TokenHash:    hashSessionSecret(token),
+		ResourceUUID: ssoCode.ResourceUUID,
+		TeamId:       ssoCode.TeamId,
+		ExpiresAt:    time.Now().Add(s.config.sessionMaxAge),
+	}
+	err = s.db.CreateSession(ctx, session)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return token, session, account, nil
+}
+
+// Look up the live session a token belongs to, along with the account it is
+// signed in to, and record that it was used. Sessions for accounts that were
+// suspended or deprovisioned since are refused like at sign in.
+func (s *server) currentSession(ctx context.Context, token string) (*models.Session, *models.Account, error) {
+	if token == "" {
+		return nil, nil, &UnauthorizedError{}
+	}
+	session, err := s.db.GetSession(ctx, hashSessionSecret(token))
+	if err == store.ErrNotFound {
+		return nil, nil, &UnauthorizedError{}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if session.RevokedAt != nil || now.After(session.ExpiresAt) || now.Sub(session.LastSeenAt) > s.config.sessionIdleTimeout {
+		return nil, nil, &UnauthorizedError{}
+	}
+
+	account, err := s.checkActive(ctx, session.ResourceUUID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.db.TouchSession(ctx, session.TokenHash, now)
+	if err == store.ErrNotFound {
+		return nil, nil, &UnauthorizedError{}
+	} else if err != nil {
+		return nil, nil, err
+	}
+	session.LastSeenAt = now
+	return session, account, nil
+}
+
+// Move a session to another of its team's resources. Resources of other
+// teams count as missing.
+func (s *server) switchSession(ctx context.Context, session *models.Session, uuid string) (*models.Account, error) {
+	account, err := s.checkActive(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	if session.TeamId == "" || account.TeamId != session.TeamId {
+		return nil, &NotFoundError{}
+	}
+
+	err = s.db.SwitchSession(ctx, session.TokenHash, uuid)
+	if err == store.ErrNotFound {
+		return nil, &UnauthorizedError{}
+	} else if err != nil {
+		return nil, err
+	}
+	session.ResourceUUID = uuid
+	return account, nil
+}
+
+// Revoke the session a token belongs to. Ending a session that already ended
+// does nothing.
+func (s *server) endSession(ctx context.Context, token string) error {
+	if token == "" {
+		return nil
+	}
+	err := s.db.RevokeSession(ctx, hashSessionSecret(token), time.Now())
+	if err == store.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// Remove expired SSO codes and sessions that have ended
+func (s *server) purgeSessions(ctx context.Context) {
+	now := time.Now()
+	purged, err := s.db.PurgeSessions(ctx, now, now.Add(-s.config.sessionIdleTimeout))
+	if err != nil {
+		s.e.Logger.Error("Unable to purge sessions: " + err.Error())
+		return
+	}
+	if purged > 0 {
+		s.e.Logger.Infof("Purged %d ended sessions", purged)
+	}
+}
+
+// A random value for an SSO code or session token
+func newSessionSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SSO codes and session tokens are stored by hash, so a copy of the database
+// cannot be used to sign in
+func hashSessionSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sample_app/internal/dosim"
+	"sample_app/internal/store"
+	"strings"
+	"testing"
+)
+
+// Send a front-end request to the server, with the session cookie if token is
+// not empty
+func (ts *testServer) frontEnd(t *testing.T, method string, path string, body string, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	}
+	rec := httptest.NewRecorder()
+	ts.e.ServeHTTP(rec, req)
+	return rec
+}
+
+// Sign in to a resource through SSO and return the code it redirects with
+func (ts *testServer) ssoCode(t *testing.T, uuid string) string {
+	t.Helper()
+	res, err := ts.sim.SSO(context.Background(), uuid, "someone@example.com", "user")
+	expectStatus(t, "sso", res, err, http.StatusTemporaryRedirect)
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("code")
+}
+
+// The session token a response set, or "" if it cleared the cookie
+func sessionCookieValue(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == sessionCookieName {
+			return cookie.Value
+		}
+	}
+	t.Fatal("no session cookie set")
+	return ""
+}
+
+func signedInTo(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200: %s", rec.Code, rec.Body)
+	}
+	resp := &AuthorizeResponse{}
+	err := json.Unmarshal(rec.Body.Bytes(), resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.ResourceUUID
+}
+
+func TestSession(t *testing.T) {
+	ts := newTestServer(t)
+	r := testResource("3c2b1a09-f8e7-4d6c-9b5a-4c3b2a1f0e9d")
+	teammate := testResource("7d6c5b4a-3928-4170-a6f5-e4d3c2b1a097")
+	outsider := testResource("0a9b8c7d-6e5f-4a3b-9c2d-1e0f9a8b7c6d")
+	outsider.TeamID = "other-team"
+	ts.provision(t, r)
+	ts.provision(t, teammate)
+	ts.provision(t, outsider)
+
+	code := ts.ssoCode(t, r.UUID)
+	rec := ts.frontEnd(t, http.MethodPost, "/session", `{"code": "`+code+`"}`, "")
+	if uuid := signedInTo(t, rec); uuid != r.UUID {
+		t.Fatalf("signed in to %s, want %s", uuid, r.UUID)
+	}
+	token := sessionCookieValue(t, rec)
+
+	// Codes are single use
+	rec = ts.frontEnd(t, http.MethodPost, "/session", `{"code": "`+code+`"}`, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("reused code got %d, want 401", rec.Code)
+	}
+
+	rec = ts.frontEnd(t, http.MethodGet, "/session", "", token)
+	if uuid := signedInTo(t, rec); uuid != r.UUID {
+		t.Errorf("session is signed in to %s, want %s", uuid, r.UUID)
+	}
+
+	rec = ts.frontEnd(t, http.MethodPost, "/session/switch", `{"resource_uuid": "`+teammate.UUID+`"}`, token)
+	if uuid := signedInTo(t, rec); uuid != teammate.UUID {
+		t.Errorf("switched to %s, want the teammate %s", uuid, teammate.UUID)
+	}
+	rec = ts.frontEnd(t, http.MethodPost, "/session/switch", `{"resource_uuid": "`+outsider.UUID+`"}`, token)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("switch to another team's resource got %d, want 404", rec.Code)
+	}
+
+	rec = ts.frontEnd(t, http.MethodDelete, "/session", "", token)
+	if rec.Code != http.StatusNoContent || sessionCookieValue(t, rec) != "" {
+		t.Errorf("log out got %d, want 204 clearing the cookie", rec.Code)
+	}
+	rec = ts.frontEnd(t, http.MethodGet, "/session", "", token)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("ended session got %d, want 401", rec.Code)
+	}
+
+	ts.purgeSessions(context.Background())
+	_, err := ts.db.GetSession(context.Background(), hashSessionSecret(token))
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("ended session after purging: %v, want it gone", err)
+	}
+}
+
+func TestSessionEnds(t *testing.T) {
+	ts := newTestServer(t)
+	r := testResource("6b5a4938-2716-4f5e-b4d3-c2b1a0f9e8d7")
+	ts.provision(t, r)
+
+	signIn := func() string {
+		t.Helper()
+		rec := ts.frontEnd(t, http.MethodPost, "/session", `{"code": "`+ts.ssoCode(t, r.UUID)+`"}`, "")
+		signedInTo(t, rec)
+		return sessionCookieValue(t, rec)
+	}
+
+	// Sessions left unused for too long end
+	token := signIn()
+	idleTimeout := ts.config.sessionIdleTimeout
+	ts.config.sessionIdleTimeout = -1
+	rec := ts.frontEnd(t, http.MethodGet, "/session", "", token)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("idle session got %d, want 401", rec.Code)
+	}
+	ts.config.sessionIdleTimeout = idleTimeout
+
+	// Sessions started before a suspension are refused
+	token = signIn()
+	_, err := ts.db.GetSession(context.Background(), hashSessionSecret(token))
+	if err != nil {
+		t.Fatalf("session not stored by hash: %v", err)
+	}
+	res, err := ts.sim.NotifyResources(context.Background(), dosim.Suspended, []string{r.UUID})
+	expectStatus(t, "suspend", res, err, http.StatusOK)
+	rec = ts.frontEnd(t, http.MethodGet, "/session", "", token)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("session of a suspended account got %d, want 403", rec.Code)
+	}
+
+	rec = ts.frontEnd(t, http.MethodGet, "/session", "", "made-up")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("unknown session got %d, want 401", rec.Code)
+	}
+}
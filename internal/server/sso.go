@@ -1,10 +1,13 @@
 package server
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"sample_app/internal/store"
+	"sample_app/models"
 	"strconv"
 	"time"
 )
@@ -57,3 +60,26 @@ func validToken(token string, timestamp string, uuid string, salt string) (bool,
 
 	return hmac.Equal(hash.Sum(nil), []byte(decodedToken)), nil
 }
+
+// Returned when DigitalOcean has suspended the account someone tries to sign in to
+type SuspendedError struct{}
+
+func (e *SuspendedError) Error() string {
+	return "This account has been suspended by DigitalOcean. Resolve any outstanding billing issues with DigitalOcean to restore access."
+}
+
+// Check that an account exists and has not been suspended, and return it.
+// Deprovisioned accounts count as missing.
+func (s *server) checkActive(ctx context.Context, uuid string) (*models.Account, error) {
+	account, err := s.db.GetAccount(ctx, uuid)
+	if err == store.ErrNotFound || (err == nil && account.Deprovisioned()) {
+		return nil, &NotFoundError{}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if account.Status == models.Suspended {
+		return nil, &SuspendedError{}
+	}
+	return account, nil
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"sample_app/internal/store"
+	"sample_app/models"
+	"sort"
+	"time"
+)
+
+// A team's live resources and the plans they are on
+type TeamResponse struct {
+	TeamID    string    `json:"team_id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Oldest first
+	Resources []TeamResource `json:"resources"`
+
+	// How many of the resources are on each plan, sorted by app and plan
+	Plans []TeamPlan `json:"plans"`
+}
+
+type TeamResource struct {
+	ResourceUUID string    `json:"resource_uuid"`
+	Name         string    `json:"name"`
+	AppSlug      string    `json:"app_slug"`
+	PlanSlug     string    `json:"plan_slug"`
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type TeamPlan struct {
+	AppSlug   string `json:"app_slug"`
+	PlanSlug  string `json:"plan_slug"`
+	Resources int    `json:"resources"`
+}
+
+// The usage of a team's resources over a period, added together
+type TeamUsageResponse struct {
+	TeamID      string                  `json:"team_id"`
+	Granularity models.UsageGranularity `json:"granularity"`
+	From        time.Time               `json:"from"`
+	To          time.Time               `json:"to"`
+
+	// Total quantity over the whole period, by meter
+	Totals map[string]float64 `json:"totals"`
+
+	// Periods with any usage by any of the resources, oldest first
+	Periods []UsagePeriod `json:"periods"`
+
+	// Totals of each resource with any usage, in the order of the team's resources
+	Resources []TeamResourceUsage `json:"resources"`
+}
+
+type TeamResourceUsage struct {
+	ResourceUUID string             `json:"resource_uuid"`
+	Totals       map[string]float64 `json:"totals"`
+}
+
+// Look up a team and its live resources
+func (s *server) team(ctx context.Context, id string) (*TeamResponse, error) {
+	team, accounts, err := s.teamAccounts(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &TeamResponse{
+		TeamID:    team.Id,
+		CreatedAt: team.CreatedAt,
+		Resources: []TeamResource{},
+		Plans:     []TeamPlan{},
+	}
+	plans := map[TeamPlan]int{}
+	for _, account := range accounts {
+		if account.Deprovisioned() {
+			continue
+		}
+		resp.Resources = append(resp.Resources, TeamResource{
+			ResourceUUID: account.ResourceUUID,
+			Name:         account.Name,
+			AppSlug:      account.AppSlug,
+			PlanSlug:     account.PlanSlug,
+			Status:       statusName(account.Status),
+			CreatedAt:    account.CreatedAt,
+		})
+		plans[TeamPlan{AppSlug: account.AppSlug, PlanSlug: account.PlanSlug}]++
+	}
+	for plan, count := range plans {
+		plan.Resources = count
+		resp.Plans = append(resp.Plans, plan)
+	}
+	sort.Slice(resp.Plans, func(i, j int) bool {
+		if resp.Plans[i].AppSlug != resp.Plans[j].AppSlug {
+			return resp.Plans[i].AppSlug < resp.Plans[j].AppSlug
+		}
+		return resp.Plans[i].PlanSlug < resp.Plans[j].PlanSlug
+	})
+	return resp, nil
+}
+
+// Add up the usage of a team's resources by hour or day over [from, to).
+// Resources that were deprovisioned count until they are purged, like their
+// own usage does.
+func (s *server) teamUsage(ctx context.Context, id string, granularity models.UsageGranularity, from time.Time, to time.Time, meter string) (*TeamUsageResponse, error) {
+	from, to, err := usageRange(granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	_, accounts, err := s.teamAccounts(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &TeamUsageResponse{
+		TeamID:      id,
+		Granularity: granularity,
+		From:        from,
+		To:          to,
+		Totals:      map[string]float64{},
+		Periods:     []UsagePeriod{},
+		Resources:   []TeamResourceUsage{},
+	}
+	type periodKey struct {
+		meter       string
+		periodStart time.Time
+	}
+	periods := map[periodKey]*UsagePeriod{}
+	for _, account := range accounts {
+		rollups, err := s.db.ListUsageRollups(ctx, account.ResourceUUID, granularity, from, to, meter)
+		if err != nil {
+			return nil, err
+		}
+		if len(rollups) == 0 {
+			continue
+		}
+
+		totals := map[string]float64{}
+		for _, rollup := range rollups {
+			totals[rollup.Meter] += rollup.Quantity
+			resp.Totals[rollup.Meter] += rollup.Quantity
+
+			key := periodKey{meter: rollup.Meter, periodStart: rollup.PeriodStart}
+			period, ok := periods[key]
+			if !ok {
+				period = &UsagePeriod{Meter: rollup.Meter, PeriodStart: rollup.PeriodStart}
+				periods[key] = period
+			}
+			period.Quantity += rollup.Quantity
+			period.EventCount += rollup.EventCount
+		}
+		resp.Resources = append(resp.Resources, TeamResourceUsage{ResourceUUID: account.ResourceUUID, Totals: totals})
+	}
+
+	for _, period := range periods {
+		resp.Periods = append(resp.Periods, *period)
+	}
+	sort.Slice(resp.Periods, func(i, j int) bool {
+		if !resp.Periods[i].PeriodStart.Equal(resp.Periods[j].PeriodStart) {
+			return resp.Periods[i].PeriodStart.Before(resp.Periods[j].PeriodStart)
+		}
+		return resp.Periods[i].Meter < resp.Periods[j].Meter
+	})
+	return resp, nil
+}
+
+// Fetch a team and every account linked to it
+func (s *server) teamAccounts(ctx context.Context, id string) (*models.Team, []models.Account, error) {
+	team, err := s.db.GetTeam(ctx, id)
+	if err == store.ErrNotFound {
+		return nil, nil, &NotFoundError{}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	accounts, err := s.db.ListTeamAccounts(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return team, accounts, nil
+}
@@ -1,115 +1,28 @@
 package server
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
-	"net/http"
+	"sample_app/internal/digitalocean"
+	"sample_app/internal/store"
+	"sample_app/models"
 	"time"
 )
 
-type Token struct {
-	// Used to access the DigitalOcean API scoped to a single resource. Normally expires
-	// every 8 hours, but may expire early in certain circumstances.
-	AccessToken string `json:"access_token"`
-
-	// Valid for the lifetime of the resource and can be exchanged for a new access_token
-	// as many times as needed using a valid OAuth client_secret.
-	RefreshToken string `json:"refresh_token"`
-
-	// The number of seconds the access_token is valid for. The refresh_token is used to
-	// acquire a new access_token.
-	ExpiresIn int64 `json:"expires_in"`
-
-	// Time this token will expire
-	ExpiresAt time.Time
-
-	// The token type is used in the Authorization header of requests to the DigitalOcean API
-	TokenType string `json:"token_type"`
-}
-
-type AuthCodeRequest struct {
-	// The authorization code provided during the provisioning request
-	Code string `json:"code"`
-
-	// Type of code
-	GrantType string `json:"grant_type"`
-
-	// The preshared secret that is associated with your Add-On
-	Secret string `json:"client_secret"`
-}
-
-type RefreshRequest struct {
-	// Type of code
-	GrantType string `json:"grant_type"`
-
-	// The authorization code provided during the provisioning request
-	RefreshToken string `json:"refresh_token"`
-
-	// The preshared secret that is associated with your Add-On
-	ClientSecret string `json:"client_secret"`
-}
-
-const (
-	digitaloceanTokenAPI = "https://api.digitalocean.com:443/v2/add-ons/oauth/token"
-
-	InsertTokenSQL = `
-	INSERT INTO tokens (resource_uuid, access_token, refresh_token, expires_at)
-	VALUES ($1, $2, $3, $4);
-	`
-	GetTokenSQL = `
-	SELECT access_token, refresh_token, expires_at FROM tokens WHERE resource_uuid=$1;
-	`
-
-	UpdateTokenSQL = `
-	UPDATE tokens
-	SET access_token=$2, refresh_token=$3, expires_at=$4
-	WHERE id=$1;
-	`
-)
-
-// Exchange the auth code issued on provisioning for an access token and refresh token for later use
-func (s *server) tradeAuthCode(ctx context.Context, oauth OauthGrant, uuid string) error {
-	exchangeReq := AuthCodeRequest{
-		Code:      oauth.Code,
-		GrantType: "authorization_code",
-		Secret:    s.config.clientSecret,
-	}
-
-	jsonBody, err := json.Marshal(exchangeReq)
-	if err != nil {
-		return err
-	}
-
-	token, err := makeTokenRequest(jsonBody)
-	if err != nil {
-		return err
-	}
-
-	err = s.saveToken(ctx, token, uuid)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // Save a given access and refresh token for a given user for later use
-func (s *server) saveToken(ctx context.Context, token *Token, uuid string) error {
-	_, err := s.db.Exec(ctx, InsertTokenSQL,
-		uuid,
-		token.AccessToken,
-		token.RefreshToken,
-		time.Unix(time.Now().Unix()+token.ExpiresIn, 0),
-	)
-
+func (s *server) saveToken(ctx context.Context, db store.Store, token *digitalocean.Token, uuid string) (*models.Token, error) {
+	saved := &models.Token{
+		ResourceUUID: uuid,
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		ExpiresAt:    token.ExpiresAt,
+		IssuedAt:     time.Now(),
+	}
+	err := db.SaveToken(ctx, saved)
 	if err != nil {
 		s.e.Logger.Error("Unable to save tokens: " + err.Error())
-		return err
+		return nil, err
 	}
-	return nil
+	return saved, nil
 }
 
 // Get a valid access token for a user. Refreshes token if necessary.
@@ -133,70 +46,68 @@ func (s *server) getAccessToken(ctx context.Context, uuid string) (string, error
 }
 
 // Get tokens for a given account
-func (s *server) readTokens(ctx context.Context, uuid string) (*Token, error) {
-	token := Token{}
-	err := s.db.QueryRow(ctx, GetTokenSQL, uuid).Scan(&(token.AccessToken), &(token.RefreshToken), &(token.ExpiresAt))
+func (s *server) readTokens(ctx context.Context, uuid string) (*models.Token, error) {
+	token, err := s.db.GetToken(ctx, uuid)
 	if err != nil {
 		s.e.Logger.Error("Unable to fetch tokens: " + err.Error())
 		return nil, err
 	}
-	return &token, nil
+	return token, nil
 }
 
 // Trade a refresh token for a new access token, and get a new refresh token. Save both.
-func (s *server) refreshToken(ctx context.Context, token *Token, uuid string) (*Token, error) {
-	refreshReq := RefreshRequest{
-		GrantType:    "refresh_token",
-		RefreshToken: token.RefreshToken,
-		ClientSecret: s.config.clientSecret,
-	}
-
-	jsonBody, err := json.Marshal(refreshReq)
-	if err != nil {
-		return nil, err
-	}
-
-	token, err = makeTokenRequest(jsonBody)
-	if err != nil {
-		return nil, err
-	}
-
-	err = s.saveToken(ctx, token, uuid)
-	if err != nil {
-		return nil, err
-	}
-
-	return token, nil
+//
+// DigitalOcean rotates refresh tokens, so spending one twice can cost us the
+// grant. Concurrent refreshes of a resource in this process are coalesced into
+// one, and the token row stays locked while it is refreshed so other instances
+// wait for it. If the stored token was already refreshed by the time we hold
+// the lock, that token is returned instead of refreshing again.
+func (s *server) refreshToken(ctx context.Context, token *models.Token, uuid string) (*models.Token, error) {
+	return s.refreshes.do(uuid, func() (*models.Token, error) {
+		var saved *models.Token
+		err := s.db.InTx(ctx, func(tx store.Store) error {
+			current, err := tx.LockToken(ctx, uuid)
+			if err != nil {
+				return err
+			}
+			if current.RefreshToken != token.RefreshToken {
+				saved = current
+				return nil
+			}
+
+			refreshed, err := s.api.RefreshToken(ctx, current.RefreshToken)
+			if err != nil {
+				return err
+			}
+
+			saved, err = s.saveToken(ctx, tx, refreshed, uuid)
+			return err
+		})
+		return saved, err
+	})
 }
 
-// Send in a given request in order to get a token response back.
-// Used for both initial auth code trade-in and for token refreshes.
-func makeTokenRequest(jsonBody []byte) (*Token, error) {
-	bodyReader := bytes.NewReader(jsonBody)
-
-	req, err := http.NewRequest(http.MethodPost, digitaloceanTokenAPI, bodyReader)
-	if err != nil {
-		fmt.Printf("error creating HTTP request: %s\n", err)
-		return nil, err
-	}
+// When a token was issued and when it expires
+type TokenGrant struct {
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Current   bool      `json:"current"`
+}
 
-	res, err := http.DefaultClient.Do(req)
+// The current token of a resource followed by the tokens it replaced, newest first
+func (s *server) tokenHistory(ctx context.Context, uuid string) ([]TokenGrant, error) {
+	current, err := s.db.GetToken(ctx, uuid)
 	if err != nil {
-		fmt.Printf("client: error making http request: %s\n", err)
 		return nil, err
 	}
-
-	resBody, err := ioutil.ReadAll(res.Body)
+	history, err := s.db.ListTokenHistory(ctx, uuid)
 	if err != nil {
-		fmt.Printf("client: could not read response body: %s\n", err)
 		return nil, err
 	}
 
-	resp := &Token{}
-	err = json.Unmarshal(resBody, resp)
-	if err != nil {
-		return nil, err
+	grants := []TokenGrant{{IssuedAt: current.IssuedAt, ExpiresAt: current.ExpiresAt, Current: true}}
+	for _, token := range history {
+		grants = append(grants, TokenGrant{IssuedAt: token.IssuedAt, ExpiresAt: token.ExpiresAt})
 	}
-
-	return resp, nil
+	return grants, nil
 }
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// DigitalOcean rotates refresh tokens, so concurrent requests needing a fresh
+// access token must share a single refresh. A second refresh would spend the
+// rotated-out refresh token and fail.
+func TestConcurrentRefreshesShareOne(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	r := testResource("9d8c7b6a-5e4f-4a3b-8c2d-1e0f9a8b7c6d")
+	ts.provision(t, r)
+
+	token, err := ts.db.GetToken(ctx, r.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token.ExpiresAt = time.Now().Add(-time.Minute)
+	err = ts.db.SaveToken(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := ts.db.ListTokenHistory(ctx, r.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const callers = 10
+	accessTokens := make([]string, callers)
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			accessTokens[i], errs[i] = ts.getAccessToken(ctx, r.UUID)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range errs {
+		if errs[i] != nil {
+			t.Fatalf("caller %d: %v", i, errs[i])
+		}
+		if accessTokens[i] == token.AccessToken {
+			t.Fatalf("caller %d got the expired access token", i)
+		}
+		if accessTokens[i] != accessTokens[0] {
+			t.Fatalf("callers got different access tokens: %q and %q", accessTokens[0], accessTokens[i])
+		}
+	}
+
+	refreshed, err := ts.db.ListTokenHistory(ctx, r.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refreshed) != len(history)+1 {
+		t.Errorf("token was refreshed %d times, want once", len(refreshed)-len(history))
+	}
+}
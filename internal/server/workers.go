@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sample_app/internal/digitalocean"
+	"time"
+)
+
+// Longest any background retry waits, however many attempts have failed
+const maxRetryDelay = time.Hour
+
+// Call fn straight away and then every interval until ctx is cancelled. Each
+// wait is randomly lengthened by up to jitter so instances started together
+// drift apart.
+func runEvery(ctx context.Context, interval time.Duration, jitter time.Duration, fn func(context.Context)) {
+	for {
+		fn(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval + randomDuration(jitter)):
+		}
+	}
+}
+
+// A random duration in [0, max)
+func randomDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// How long to wait before retrying after the given number of failed attempts.
+// Starts at base and doubles each time, up to max.
+func backoffDelay(base time.Duration, attempts int, max time.Duration) time.Duration {
+	delay := base
+	for i := 0; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// Whether a call to DigitalOcean that failed with err may succeed if made
+// again. Anything but DigitalOcean rejecting the request outright is worth
+// retrying.
+func retryableAPIError(err error) bool {
+	apiErr, ok := err.(*digitalocean.Error)
+	if !ok {
+		return true
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return apiErr.StatusCode >= 500
+}
@@ -0,0 +1,354 @@
+package store
+
+import (
+	"context"
+	"sample_app/internal/secrets"
+	"sample_app/models"
+	"time"
+)
+
+// Wraps a Store so OAuth tokens and authorization codes are encrypted before
+// they are written and decrypted after they are read. Everything else passes
+// straight through. Values written without encryption stay readable.
+type encryptedStore struct {
+	Store
+	keyring *secrets.Keyring
+}
+
+// Encrypt tokens saved to s with the keyring's primary key
+func NewEncryptedStore(s Store, keyring *secrets.Keyring) Store {
+	return &encryptedStore{
+		Store:   s,
+		keyring: keyring,
+	}
+}
+
+func (s *encryptedStore) InTx(ctx context.Context, fn func(Store) error) error {
+	return s.Store.InTx(ctx, func(tx Store) error {
+		return fn(&encryptedStore{Store: tx, keyring: s.keyring})
+	})
+}
+
+func (s *encryptedStore) SaveToken(ctx context.Context, token *models.Token) error {
+	encrypted, err := s.encrypt(token)
+	if err != nil {
+		return err
+	}
+
+	err = s.Store.SaveToken(ctx, encrypted)
+	if err != nil {
+		return err
+	}
+	token.IssuedAt = encrypted.IssuedAt
+	token.KeyID = encrypted.KeyID
+	token.DataKey = encrypted.DataKey
+	return nil
+}
+
+func (s *encryptedStore) GetToken(ctx context.Context, uuid string) (*models.Token, error) {
+	token, err := s.Store.GetToken(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	return s.decrypt(token)
+}
+
+func (s *encryptedStore) LockToken(ctx context.Context, uuid string) (*models.Token, error) {
+	token, err := s.Store.LockToken(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	return s.decrypt(token)
+}
+
+func (s *encryptedStore) ListTokens(ctx context.Context) ([]models.Token, error) {
+	tokens, err := s.Store.ListTokens(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.decryptAll(tokens)
+}
+
+func (s *encryptedStore) ListTokensExpiringBefore(ctx context.Context, before time.Time) ([]models.Token, error) {
+	tokens, err := s.Store.ListTokensExpiringBefore(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+	return s.decryptAll(tokens)
+}
+
+func (s *encryptedStore) ListTokenHistory(ctx context.Context, uuid string) ([]models.Token, error) {
+	tokens, err := s.Store.ListTokenHistory(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	return s.decryptAll(tokens)
+}
+
+// Re-encrypts the token with the primary key
+func (s *encryptedStore) RewriteToken(ctx context.Context, token *models.Token) error {
+	encrypted, err := s.encrypt(token)
+	if err != nil {
+		return err
+	}
+
+	err = s.Store.RewriteToken(ctx, encrypted)
+	if err != nil {
+		return err
+	}
+	token.KeyID = encrypted.KeyID
+	token.DataKey = encrypted.DataKey
+	return nil
+}
+
+func (s *encryptedStore) SaveOAuthGrant(ctx context.Context, grant *models.OAuthGrant) error {
+	encrypted, err := s.encryptGrant(grant)
+	if err != nil {
+		return err
+	}
+
+	err = s.Store.SaveOAuthGrant(ctx, encrypted)
+	if err != nil {
+		return err
+	}
+	grant.CreatedAt = encrypted.CreatedAt
+	grant.KeyID = encrypted.KeyID
+	grant.DataKey = encrypted.DataKey
+	return nil
+}
+
+func (s *encryptedStore) LockOAuthGrant(ctx context.Context, uuid string) (*models.OAuthGrant, error) {
+	grant, err := s.Store.LockOAuthGrant(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	return grant, s.decryptGrant(grant)
+}
+
+func (s *encryptedStore) ListDueOAuthGrants(ctx context.Context, now time.Time) ([]models.OAuthGrant, error) {
+	grants, err := s.Store.ListDueOAuthGrants(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	return grants, s.decryptGrants(grants)
+}
+
+func (s *encryptedStore) ListOAuthGrants(ctx context.Context) ([]models.OAuthGrant, error) {
+	grants, err := s.Store.ListOAuthGrants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return grants, s.decryptGrants(grants)
+}
+
+// Re-encrypts the grant's code with the primary key
+func (s *encryptedStore) RewriteOAuthGrant(ctx context.Context, grant *models.OAuthGrant) error {
+	encrypted, err := s.encryptGrant(grant)
+	if err != nil {
+		return err
+	}
+
+	err = s.Store.RewriteOAuthGrant(ctx, encrypted)
+	if err != nil {
+		return err
+	}
+	grant.KeyID = encrypted.KeyID
+	grant.DataKey = encrypted.DataKey
+	return nil
+}
+
+// Encrypt every current and historical token, and every authorization code
+// still to be exchanged, that is in plaintext or under an old key with the
+// keyring's primary key. Returns how many rows were rewritten. Safe to run
+// while the server is live: each resource's token and grant is locked while it
+// is rewritten, so a refresh or exchange either waits for the rewrite or is
+// seen by it.
+func ReencryptTokens(ctx context.Context, s Store, keyring *secrets.Keyring) (int, error) {
+	// Only the resource UUIDs are needed, so nothing is decrypted yet
+	current, err := s.ListTokens(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	encrypted := &encryptedStore{Store: s, keyring: keyring}
+	rewritten := 0
+	for _, token := range current {
+		uuid := token.ResourceUUID
+		count := 0
+		err = encrypted.InTx(ctx, func(tx Store) error {
+			count = 0
+			locked, err := tx.LockToken(ctx, uuid)
+			if err == ErrNotFound {
+				// Deleted since it was listed
+				return nil
+			} else if err != nil {
+				return err
+			}
+			history, err := tx.ListTokenHistory(ctx, uuid)
+			if err != nil {
+				return err
+			}
+
+			tokens := append([]models.Token{*locked}, history...)
+			for i := range tokens {
+				if tokens[i].KeyID == keyring.PrimaryID() {
+					continue
+				}
+				err = tx.RewriteToken(ctx, &tokens[i])
+				if err != nil {
+					return err
+				}
+				count++
+			}
+			return nil
+		})
+		if err != nil {
+			return rewritten, err
+		}
+		rewritten += count
+	}
+
+	grants, err := s.ListOAuthGrants(ctx)
+	if err != nil {
+		return rewritten, err
+	}
+	for _, grant := range grants {
+		if grant.KeyID == keyring.PrimaryID() {
+			continue
+		}
+
+		uuid := grant.ResourceUUID
+		count := 0
+		err = encrypted.InTx(ctx, func(tx Store) error {
+			count = 0
+			locked, err := tx.LockOAuthGrant(ctx, uuid)
+			if err == ErrNotFound {
+				// Exchanged or expired since it was listed
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if locked.KeyID == keyring.PrimaryID() {
+				return nil
+			}
+
+			err = tx.RewriteOAuthGrant(ctx, locked)
+			if err != nil {
+				return err
+			}
+			count++
+			return nil
+		})
+		if err != nil {
+			return rewritten, err
+		}
+		rewritten += count
+	}
+
+	return rewritten, nil
+}
+
+// Return an encrypted copy of token under a fresh data key
+func (s *encryptedStore) encrypt(token *models.Token) (*models.Token, error) {
+	dataKey, err := s.keyring.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := *token
+	encrypted.KeyID = dataKey.KeyID
+	encrypted.DataKey = dataKey.Wrapped
+	encrypted.AccessToken, err = dataKey.Encrypt(token.AccessToken, tokenContext(token, "access_token"))
+	if err != nil {
+		return nil, err
+	}
+	encrypted.RefreshToken, err = dataKey.Encrypt(token.RefreshToken, tokenContext(token, "refresh_token"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &encrypted, nil
+}
+
+// Decrypt token in place. Plaintext rows are returned as they are.
+func (s *encryptedStore) decrypt(token *models.Token) (*models.Token, error) {
+	if token.KeyID == "" {
+		return token, nil
+	}
+
+	dataKey, err := s.keyring.OpenDataKey(token.KeyID, token.DataKey)
+	if err != nil {
+		return nil, err
+	}
+	token.AccessToken, err = dataKey.Decrypt(token.AccessToken, tokenContext(token, "access_token"))
+	if err != nil {
+		return nil, err
+	}
+	token.RefreshToken, err = dataKey.Decrypt(token.RefreshToken, tokenContext(token, "refresh_token"))
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (s *encryptedStore) decryptAll(tokens []models.Token) ([]models.Token, error) {
+	for i := range tokens {
+		_, err := s.decrypt(&tokens[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tokens, nil
+}
+
+// Return a copy of grant with its code encrypted under a fresh data key
+func (s *encryptedStore) encryptGrant(grant *models.OAuthGrant) (*models.OAuthGrant, error) {
+	dataKey, err := s.keyring.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := *grant
+	encrypted.KeyID = dataKey.KeyID
+	encrypted.DataKey = dataKey.Wrapped
+	encrypted.Code, err = dataKey.Encrypt(grant.Code, grantContext(grant))
+	if err != nil {
+		return nil, err
+	}
+
+	return &encrypted, nil
+}
+
+// Decrypt grant's code in place. Plaintext rows are left as they are.
+func (s *encryptedStore) decryptGrant(grant *models.OAuthGrant) error {
+	if grant.KeyID == "" {
+		return nil
+	}
+
+	dataKey, err := s.keyring.OpenDataKey(grant.KeyID, grant.DataKey)
+	if err != nil {
+		return err
+	}
+	grant.Code, err = dataKey.Decrypt(grant.Code, grantContext(grant))
+	return err
+}
+
+func (s *encryptedStore) decryptGrants(grants []models.OAuthGrant) error {
+	for i := range grants {
+		err := s.decryptGrant(&grants[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ties a ciphertext to the resource and column it belongs to
+func tokenContext(token *models.Token, column string) string {
+	return "tokens." + column + ":" + token.ResourceUUID
+}
+
+func grantContext(grant *models.OAuthGrant) string {
+	return "oauth_grants.code:" + grant.ResourceUUID
+}
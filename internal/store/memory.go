@@ -0,0 +1,530 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store that keeps everything in process memory. Useful for running the server
+// and its handlers without a database. Transactions are serialized against each
+// other and against reads and writes made outside them, and a failed
+// transaction restores the state from when it began.
+type MemoryStore struct {
+	*memoryState
+
+	// Set on the store a transaction is given, which already holds txMu
+	inTx bool
+}
+
+// What a MemoryStore shares with the stores its transactions are given
+type memoryState struct {
+	// Held for the duration of a transaction, and of each read and write
+	// outside one, so others never see a transaction's writes before it
+	// finishes and rolling it back can only undo its own writes
+	txMu sync.Mutex
+
+	// Guards data
+	mu   sync.Mutex
+	data *memoryData
+}
+
+// Everything the MemoryStore holds, kept together so it can be snapshotted
+type memoryData struct {
+	nextAccountId  int
+	nextTokenId    int
+	nextActivityId int
+
+	// Keyed by resource UUID
+	accounts map[string]models.Account
+	tokens   map[string]models.Token
+
+	// Keyed by team ID
+	teams map[string]models.Team
+
+	// When the last change DigitalOcean made to each account was made
+	remoteUpdatedAt map[string]time.Time
+
+	deprovisionFailures map[string]models.DeprovisionFailure
+
+	oauthGrants map[string]models.OAuthGrant
+
+	// Keyed by resource UUID, then by kind and name
+	entitlementOverrides map[string]map[overrideKey]models.EntitlementOverride
+
+	// Recorded usage, oldest first, and the idempotency keys seen for each resource
+	usageEvents    []models.UsageEvent
+	usageEventKeys map[string]map[string]bool
+
+	// Keyed by resource UUID
+	usageRollups map[string]map[rollupKey]models.UsageRollup
+
+	// Keyed by resource UUID, then by name
+	configVars map[string]map[string]models.ConfigVar
+
+	// Oldest first
+	configPushes     []models.ConfigPush
+	nextConfigPushId int
+
+	// Replaced tokens, oldest first
+	tokenHistory []models.Token
+
+	activities []models.Activity
+
+	// Oldest first
+	licenseKeys      []models.LicenseKey
+	nextLicenseKeyId int
+
+	// Oldest first
+	licenseVerifications      []models.LicenseVerification
+	nextLicenseVerificationId int
+
+	// Keyed by code hash
+	ssoCodes map[string]models.SSOCode
+
+	// Keyed by token hash
+	sessions map[string]models.Session
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{memoryState: &memoryState{
+		data: &memoryData{
+			nextAccountId:  1,
+			nextTokenId:    1,
+			nextActivityId: 1,
+
+			nextConfigPushId: 1,
+
+			nextLicenseKeyId:          1,
+			nextLicenseVerificationId: 1,
+
+			accounts: map[string]models.Account{},
+			tokens:   map[string]models.Token{},
+
+			teams: map[string]models.Team{},
+
+			remoteUpdatedAt: map[string]time.Time{},
+
+			deprovisionFailures: map[string]models.DeprovisionFailure{},
+
+			oauthGrants: map[string]models.OAuthGrant{},
+
+			entitlementOverrides: map[string]map[overrideKey]models.EntitlementOverride{},
+
+			configVars: map[string]map[string]models.ConfigVar{},
+
+			usageEventKeys: map[string]map[string]bool{},
+			usageRollups:   map[string]map[rollupKey]models.UsageRollup{},
+
+			ssoCodes: map[string]models.SSOCode{},
+			sessions: map[string]models.Session{},
+		},
+	}}
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := *d
+	c.accounts = make(map[string]models.Account, len(d.accounts))
+	for k, v := range d.accounts {
+		c.accounts[k] = v
+	}
+	c.tokens = make(map[string]models.Token, len(d.tokens))
+	for k, v := range d.tokens {
+		c.tokens[k] = v
+	}
+	c.teams = make(map[string]models.Team, len(d.teams))
+	for k, v := range d.teams {
+		c.teams[k] = v
+	}
+	c.remoteUpdatedAt = make(map[string]time.Time, len(d.remoteUpdatedAt))
+	for k, v := range d.remoteUpdatedAt {
+		c.remoteUpdatedAt[k] = v
+	}
+	c.deprovisionFailures = make(map[string]models.DeprovisionFailure, len(d.deprovisionFailures))
+	for k, v := range d.deprovisionFailures {
+		c.deprovisionFailures[k] = v
+	}
+	c.oauthGrants = make(map[string]models.OAuthGrant, len(d.oauthGrants))
+	for k, v := range d.oauthGrants {
+		c.oauthGrants[k] = v
+	}
+	c.entitlementOverrides = make(map[string]map[overrideKey]models.EntitlementOverride, len(d.entitlementOverrides))
+	for uuid, overrides := range d.entitlementOverrides {
+		c.entitlementOverrides[uuid] = make(map[overrideKey]models.EntitlementOverride, len(overrides))
+		for k, v := range overrides {
+			c.entitlementOverrides[uuid][k] = v
+		}
+	}
+	c.usageEvents = append([]models.UsageEvent(nil), d.usageEvents...)
+	c.usageEventKeys = make(map[string]map[string]bool, len(d.usageEventKeys))
+	for uuid, keys := range d.usageEventKeys {
+		c.usageEventKeys[uuid] = make(map[string]bool, len(keys))
+		for k, v := range keys {
+			c.usageEventKeys[uuid][k] = v
+		}
+	}
+	c.usageRollups = make(map[string]map[rollupKey]models.UsageRollup, len(d.usageRollups))
+	for uuid, rollups := range d.usageRollups {
+		c.usageRollups[uuid] = make(map[rollupKey]models.UsageRollup, len(rollups))
+		for k, v := range rollups {
+			c.usageRollups[uuid][k] = v
+		}
+	}
+	c.configVars = make(map[string]map[string]models.ConfigVar, len(d.configVars))
+	for uuid, vars := range d.configVars {
+		c.configVars[uuid] = make(map[string]models.ConfigVar, len(vars))
+		for k, v := range vars {
+			c.configVars[uuid][k] = v
+		}
+	}
+	c.configPushes = append([]models.ConfigPush(nil), d.configPushes...)
+	c.tokenHistory = append([]models.Token(nil), d.tokenHistory...)
+	c.activities = append([]models.Activity(nil), d.activities...)
+	c.licenseKeys = append([]models.LicenseKey(nil), d.licenseKeys...)
+	c.licenseVerifications = append([]models.LicenseVerification(nil), d.licenseVerifications...)
+	c.ssoCodes = make(map[string]models.SSOCode, len(d.ssoCodes))
+	for k, v := range d.ssoCodes {
+		c.ssoCodes[k] = v
+	}
+	c.sessions = make(map[string]models.Session, len(d.sessions))
+	for k, v := range d.sessions {
+		c.sessions[k] = v
+	}
+	return &c
+}
+
+// A MemoryStore already inside a transaction
+type memoryTx struct {
+	*MemoryStore
+}
+
+func (s *memoryTx) InTx(ctx context.Context, fn func(Store) error) error {
+	return fn(s)
+}
+
+func (s *MemoryStore) InTx(ctx context.Context, fn func(Store) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	snapshot := s.data.clone()
+	s.mu.Unlock()
+
+	err := fn(&memoryTx{&MemoryStore{memoryState: s.memoryState, inTx: true}})
+	if err != nil {
+		s.mu.Lock()
+		s.data = snapshot
+		s.mu.Unlock()
+	}
+
+	return err
+}
+
+// Lock data for a read or a write, first waiting for any transaction to finish
+// unless this is part of it. Reads wait too, so they never see the writes of a
+// transaction that has not finished.
+func (s *MemoryStore) lock() {
+	if !s.inTx {
+		s.txMu.Lock()
+	}
+	s.mu.Lock()
+}
+
+func (s *MemoryStore) unlock() {
+	s.mu.Unlock()
+	if !s.inTx {
+		s.txMu.Unlock()
+	}
+}
+
+func (s *MemoryStore) GetAccount(ctx context.Context, uuid string) (*models.Account, error) {
+	s.lock()
+	defer s.unlock()
+
+	account, ok := s.data.accounts[uuid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &account, nil
+}
+
+func (s *MemoryStore) GetAccountByLicenseKey(ctx context.Context, licenseKey string) (*models.Account, error) {
+	s.lock()
+	defer s.unlock()
+
+	if licenseKey == "" {
+		return nil, ErrNotFound
+	}
+	for _, account := range s.data.accounts {
+		if account.LicenseKey == licenseKey {
+			return &account, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) CreateAccount(ctx context.Context, account *models.Account) error {
+	s.lock()
+	defer s.unlock()
+
+	if _, ok := s.data.accounts[account.ResourceUUID]; ok {
+		return ErrConflict
+	}
+
+	now := time.Now()
+	account.Id = s.data.nextAccountId
+	account.CreatedAt = now
+	account.ModifiedAt = now
+	s.data.nextAccountId++
+	s.data.accounts[account.ResourceUUID] = *account
+	return nil
+}
+
+func (s *MemoryStore) UpdateAccount(ctx context.Context, account *models.Account) error {
+	s.lock()
+	defer s.unlock()
+
+	for uuid, existing := range s.data.accounts {
+		if existing.Id != account.Id {
+			continue
+		}
+
+		existing.Name = account.Name
+		existing.Email = account.Email
+		existing.AppSlug = account.AppSlug
+		existing.PlanSlug = account.PlanSlug
+		existing.Language = account.Language
+		existing.EmailPreference = account.EmailPreference
+		existing.Status = account.Status
+		existing.LicenseKey = account.LicenseKey
+		existing.OAuthState = account.OAuthState
+		existing.TeamId = account.TeamId
+		existing.DeprovisionedAt = nil
+		existing.ModifiedAt = time.Now()
+		s.data.accounts[uuid] = existing
+
+		account.ModifiedAt = existing.ModifiedAt
+		account.DeprovisionedAt = nil
+		return nil
+	}
+
+	return ErrNotFound
+}
+
+func (s *MemoryStore) UpdatePlan(ctx context.Context, uuid string, planSlug string) error {
+	return s.updateAccount(uuid, func(a *models.Account) {
+		a.PlanSlug = planSlug
+	})
+}
+
+func (s *MemoryStore) ApplyAccountUpdate(ctx context.Context, uuid string, update AccountUpdate) (bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	account, ok := s.data.accounts[uuid]
+	if !ok {
+		return false, ErrNotFound
+	}
+	if account.Deprovisioned() {
+		return false, nil
+	}
+	if last, ok := s.data.remoteUpdatedAt[uuid]; ok && !last.Before(update.UpdatedAt) {
+		return false, nil
+	}
+
+	if update.Name != "" {
+		account.Name = update.Name
+	}
+	if update.PlanSlug != "" {
+		account.PlanSlug = update.PlanSlug
+	}
+	if update.Status != nil {
+		account.Status = *update.Status
+	}
+	account.ModifiedAt = time.Now()
+	s.data.accounts[uuid] = account
+	s.data.remoteUpdatedAt[uuid] = update.UpdatedAt
+	return true, nil
+}
+
+func (s *MemoryStore) UpdateStatus(ctx context.Context, uuid string, status models.Status) error {
+	return s.updateAccount(uuid, func(a *models.Account) {
+		a.Status = status
+	})
+}
+
+func (s *MemoryStore) UpdateOAuthState(ctx context.Context, uuid string, state models.OAuthState) error {
+	return s.updateAccount(uuid, func(a *models.Account) {
+		a.OAuthState = state
+	})
+}
+
+func (s *MemoryStore) UpdateLicenseKey(ctx context.Context, uuid string, licenseKey string) error {
+	return s.updateAccount(uuid, func(a *models.Account) {
+		a.LicenseKey = licenseKey
+	})
+}
+
+func (s *MemoryStore) DeprovisionAccount(ctx context.Context, uuid string, at time.Time) error {
+	s.lock()
+	defer s.unlock()
+
+	account, ok := s.data.accounts[uuid]
+	if !ok || account.Deprovisioned() {
+		return ErrNotFound
+	}
+	account.DeprovisionedAt = &at
+	account.LicenseKey = ""
+	account.ModifiedAt = time.Now()
+	s.data.accounts[uuid] = account
+
+	for i := range s.data.licenseKeys {
+		key := &s.data.licenseKeys[i]
+		if key.ResourceUUID == uuid && key.RevokedAt == nil {
+			key.RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) PurgeDeprovisionedAccounts(ctx context.Context, before time.Time) ([]string, error) {
+	s.lock()
+	defer s.unlock()
+
+	purged := map[string]bool{}
+	for uuid, account := range s.data.accounts {
+		if account.Deprovisioned() && account.DeprovisionedAt.Before(before) {
+			purged[uuid] = true
+		}
+	}
+
+	uuids := []string{}
+	for uuid := range purged {
+		uuids = append(uuids, uuid)
+		delete(s.data.accounts, uuid)
+		delete(s.data.remoteUpdatedAt, uuid)
+		delete(s.data.tokens, uuid)
+		delete(s.data.oauthGrants, uuid)
+		delete(s.data.deprovisionFailures, uuid)
+		delete(s.data.entitlementOverrides, uuid)
+		delete(s.data.usageEventKeys, uuid)
+		delete(s.data.usageRollups, uuid)
+		delete(s.data.configVars, uuid)
+	}
+	sort.Strings(uuids)
+
+	// Teams go once the last of their accounts does
+	teamIds := map[string]bool{}
+	for _, account := range s.data.accounts {
+		teamIds[account.TeamId] = true
+	}
+	for id := range s.data.teams {
+		if !teamIds[id] {
+			delete(s.data.teams, id)
+		}
+	}
+
+	tokenHistory := []models.Token{}
+	for _, token := range s.data.tokenHistory {
+		if !purged[token.ResourceUUID] {
+			tokenHistory = append(tokenHistory, token)
+		}
+	}
+	s.data.tokenHistory = tokenHistory
+
+	configPushes := []models.ConfigPush{}
+	for _, push := range s.data.configPushes {
+		if !purged[push.ResourceUUID] {
+			configPushes = append(configPushes, push)
+		}
+	}
+	s.data.configPushes = configPushes
+
+	usageEvents := []models.UsageEvent{}
+	for _, event := range s.data.usageEvents {
+		if !purged[event.ResourceUUID] {
+			usageEvents = append(usageEvents, event)
+		}
+	}
+	s.data.usageEvents = usageEvents
+
+	activities := []models.Activity{}
+	for _, activity := range s.data.activities {
+		if !purged[activity.ResourceUUID] {
+			activities = append(activities, activity)
+		}
+	}
+	s.data.activities = activities
+
+	licenseKeys := []models.LicenseKey{}
+	for _, key := range s.data.licenseKeys {
+		if !purged[key.ResourceUUID] {
+			licenseKeys = append(licenseKeys, key)
+		}
+	}
+	s.data.licenseKeys = licenseKeys
+
+	licenseVerifications := []models.LicenseVerification{}
+	for _, verification := range s.data.licenseVerifications {
+		if !purged[verification.ResourceUUID] {
+			licenseVerifications = append(licenseVerifications, verification)
+		}
+	}
+	s.data.licenseVerifications = licenseVerifications
+
+	for hash, code := range s.data.ssoCodes {
+		if purged[code.ResourceUUID] {
+			delete(s.data.ssoCodes, hash)
+		}
+	}
+	for hash, session := range s.data.sessions {
+		if purged[session.ResourceUUID] {
+			delete(s.data.sessions, hash)
+		}
+	}
+
+	return uuids, nil
+}
+
+// Apply fn to the live account with the given resource UUID and bump its modified time
+func (s *MemoryStore) updateAccount(uuid string, fn func(*models.Account)) error {
+	s.lock()
+	defer s.unlock()
+
+	account, ok := s.data.accounts[uuid]
+	if !ok || account.Deprovisioned() {
+		return ErrNotFound
+	}
+	fn(&account)
+	account.ModifiedAt = time.Now()
+	s.data.accounts[uuid] = account
+	return nil
+}
+
+func (s *MemoryStore) CreateActivity(ctx context.Context, activity *models.Activity) error {
+	s.lock()
+	defer s.unlock()
+
+	now := time.Now()
+	activity.Id = s.data.nextActivityId
+	activity.CreatedAt = now
+	activity.ModifiedAt = now
+	s.data.nextActivityId++
+	s.data.activities = append(s.data.activities, *activity)
+	return nil
+}
+
+func (s *MemoryStore) ListActivities(ctx context.Context, uuid string) ([]models.Activity, error) {
+	s.lock()
+	defer s.unlock()
+
+	activities := []models.Activity{}
+	for _, activity := range s.data.activities {
+		if activity.ResourceUUID == uuid {
+			activities = append(activities, activity)
+		}
+	}
+	return activities, nil
+}
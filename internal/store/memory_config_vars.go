@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"sort"
+	"time"
+)
+
+func (s *MemoryStore) ListConfigVars(ctx context.Context, uuid string) ([]models.ConfigVar, error) {
+	s.lock()
+	defer s.unlock()
+
+	vars := []models.ConfigVar{}
+	for _, v := range s.data.configVars[uuid] {
+		vars = append(vars, v)
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Name < vars[j].Name
+	})
+	return vars, nil
+}
+
+func (s *MemoryStore) SetConfigVars(ctx context.Context, uuid string, vars []models.ConfigVar) error {
+	s.lock()
+	defer s.unlock()
+
+	existing := s.data.configVars[uuid]
+	now := time.Now()
+	replaced := make(map[string]models.ConfigVar, len(vars))
+	for i := range vars {
+		v := &vars[i]
+		old, ok := existing[v.Name]
+		if ok && old.Value == v.Value && old.Pinned == v.Pinned {
+			v.UpdatedAt = old.UpdatedAt
+		} else {
+			v.UpdatedAt = now
+		}
+		replaced[v.Name] = *v
+	}
+	s.data.configVars[uuid] = replaced
+	return nil
+}
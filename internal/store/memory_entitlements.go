@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"sort"
+	"time"
+)
+
+// Identifies an override within a resource
+type overrideKey struct {
+	kind models.OverrideKind
+	name string
+}
+
+func (s *MemoryStore) SetEntitlementOverride(ctx context.Context, override *models.EntitlementOverride) error {
+	s.lock()
+	defer s.unlock()
+
+	overrides, ok := s.data.entitlementOverrides[override.ResourceUUID]
+	if !ok {
+		overrides = map[overrideKey]models.EntitlementOverride{}
+		s.data.entitlementOverrides[override.ResourceUUID] = overrides
+	}
+
+	override.CreatedAt = time.Now()
+	overrides[overrideKey{override.Kind, override.Name}] = *override
+	return nil
+}
+
+func (s *MemoryStore) ListEntitlementOverrides(ctx context.Context, uuid string) ([]models.EntitlementOverride, error) {
+	s.lock()
+	defer s.unlock()
+
+	overrides := []models.EntitlementOverride{}
+	for _, override := range s.data.entitlementOverrides[uuid] {
+		overrides = append(overrides, override)
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		if overrides[i].Kind != overrides[j].Kind {
+			return overrides[i].Kind < overrides[j].Kind
+		}
+		return overrides[i].Name < overrides[j].Name
+	})
+	return overrides, nil
+}
+
+func (s *MemoryStore) DeleteEntitlementOverride(ctx context.Context, uuid string, kind models.OverrideKind, name string) error {
+	s.lock()
+	defer s.unlock()
+
+	key := overrideKey{kind, name}
+	if _, ok := s.data.entitlementOverrides[uuid][key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.data.entitlementOverrides[uuid], key)
+	return nil
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"sort"
+	"time"
+)
+
+func (s *MemoryStore) IssueLicenseKey(ctx context.Context, key *models.LicenseKey, graceUntil time.Time) error {
+	s.lock()
+	defer s.unlock()
+
+	for _, existing := range s.data.licenseKeys {
+		if existing.KeyHash == key.KeyHash {
+			return ErrConflict
+		}
+	}
+
+	now := time.Now()
+	for i := range s.data.licenseKeys {
+		existing := &s.data.licenseKeys[i]
+		if existing.ResourceUUID != key.ResourceUUID || existing.RevokedAt != nil {
+			continue
+		}
+		if existing.ReplacedAt == nil {
+			existing.ReplacedAt = &now
+		}
+		if existing.ExpiresAt == nil || existing.ExpiresAt.After(graceUntil) {
+			until := graceUntil
+			existing.ExpiresAt = &until
+		}
+	}
+
+	key.Id = s.data.nextLicenseKeyId
+	s.data.nextLicenseKeyId++
+	key.IssuedAt = now
+	key.ReplacedAt = nil
+	key.RevokedAt = nil
+	key.LastUsedAt = nil
+	s.data.licenseKeys = append(s.data.licenseKeys, *key)
+	return nil
+}
+
+func (s *MemoryStore) GetLicenseKey(ctx context.Context, keyHash string) (*models.LicenseKey, error) {
+	s.lock()
+	defer s.unlock()
+
+	for _, key := range s.data.licenseKeys {
+		if key.KeyHash == keyHash {
+			return &key, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) ListLicenseKeys(ctx context.Context, uuid string) ([]models.LicenseKey, error) {
+	s.lock()
+	defer s.unlock()
+
+	keys := []models.LicenseKey{}
+	for i := len(s.data.licenseKeys) - 1; i >= 0; i-- {
+		if s.data.licenseKeys[i].ResourceUUID == uuid {
+			keys = append(keys, s.data.licenseKeys[i])
+		}
+	}
+	return keys, nil
+}
+
+func (s *MemoryStore) ListExpiringLicenseKeys(ctx context.Context, before time.Time) ([]models.LicenseKey, error) {
+	s.lock()
+	defer s.unlock()
+
+	keys := []models.LicenseKey{}
+	for _, key := range s.data.licenseKeys {
+		if key.ReplacedAt != nil || key.RevokedAt != nil || key.ExpiresAt == nil || !key.ExpiresAt.Before(before) {
+			continue
+		}
+		account, ok := s.data.accounts[key.ResourceUUID]
+		if ok && !account.Deprovisioned() {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ExpiresAt.Before(*keys[j].ExpiresAt)
+	})
+	return keys, nil
+}
+
+func (s *MemoryStore) RevokeLicenseKey(ctx context.Context, uuid string, id int, at time.Time) error {
+	s.lock()
+	defer s.unlock()
+
+	for i := range s.data.licenseKeys {
+		key := &s.data.licenseKeys[i]
+		if key.Id == id && key.ResourceUUID == uuid && key.RevokedAt == nil {
+			key.RevokedAt = &at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryStore) TouchLicenseKey(ctx context.Context, id int, at time.Time) error {
+	s.lock()
+	defer s.unlock()
+
+	for i := range s.data.licenseKeys {
+		if s.data.licenseKeys[i].Id == id {
+			s.data.licenseKeys[i].LastUsedAt = &at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryStore) RecordLicenseVerification(ctx context.Context, verification *models.LicenseVerification) error {
+	s.lock()
+	defer s.unlock()
+
+	verification.Id = s.data.nextLicenseVerificationId
+	s.data.nextLicenseVerificationId++
+	verification.CreatedAt = time.Now()
+	s.data.licenseVerifications = append(s.data.licenseVerifications, *verification)
+	return nil
+}
+
+func (s *MemoryStore) ListLicenseVerifications(ctx context.Context, uuid string, limit int) ([]models.LicenseVerification, error) {
+	s.lock()
+	defer s.unlock()
+
+	verifications := []models.LicenseVerification{}
+	for i := len(s.data.licenseVerifications) - 1; i >= 0 && len(verifications) < limit; i-- {
+		if s.data.licenseVerifications[i].ResourceUUID == uuid {
+			verifications = append(verifications, s.data.licenseVerifications[i])
+		}
+	}
+	return verifications, nil
+}
+
+func (s *MemoryStore) PurgeLicenseVerifications(ctx context.Context, before time.Time) (int64, error) {
+	s.lock()
+	defer s.unlock()
+
+	kept := []models.LicenseVerification{}
+	for _, verification := range s.data.licenseVerifications {
+		if !verification.CreatedAt.Before(before) {
+			kept = append(kept, verification)
+		}
+	}
+	purged := int64(len(s.data.licenseVerifications) - len(kept))
+	s.data.licenseVerifications = kept
+	return purged, nil
+}
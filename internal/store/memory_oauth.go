@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"sort"
+	"time"
+)
+
+func (s *MemoryStore) SaveOAuthGrant(ctx context.Context, grant *models.OAuthGrant) error {
+	s.lock()
+	defer s.unlock()
+
+	grant.CreatedAt = time.Now()
+	s.data.oauthGrants[grant.ResourceUUID] = *grant
+	return nil
+}
+
+// InTx already runs one transaction at a time, so there is nothing more to lock
+func (s *MemoryStore) LockOAuthGrant(ctx context.Context, uuid string) (*models.OAuthGrant, error) {
+	s.lock()
+	defer s.unlock()
+
+	grant, ok := s.data.oauthGrants[uuid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &grant, nil
+}
+
+func (s *MemoryStore) ListDueOAuthGrants(ctx context.Context, now time.Time) ([]models.OAuthGrant, error) {
+	s.lock()
+	defer s.unlock()
+
+	grants := []models.OAuthGrant{}
+	for _, grant := range s.data.oauthGrants {
+		if !grant.NextAttemptAt.After(now) {
+			grants = append(grants, grant)
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		return grants[i].NextAttemptAt.Before(grants[j].NextAttemptAt)
+	})
+	return grants, nil
+}
+
+func (s *MemoryStore) ListOAuthGrants(ctx context.Context) ([]models.OAuthGrant, error) {
+	s.lock()
+	defer s.unlock()
+
+	grants := []models.OAuthGrant{}
+	for _, grant := range s.data.oauthGrants {
+		grants = append(grants, grant)
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		return grants[i].ResourceUUID < grants[j].ResourceUUID
+	})
+	return grants, nil
+}
+
+func (s *MemoryStore) UpdateOAuthGrant(ctx context.Context, grant *models.OAuthGrant) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.data.oauthGrants[grant.ResourceUUID]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.Attempts = grant.Attempts
+	existing.LastError = grant.LastError
+	existing.NextAttemptAt = grant.NextAttemptAt
+	s.data.oauthGrants[grant.ResourceUUID] = existing
+	return nil
+}
+
+func (s *MemoryStore) DeleteOAuthGrant(ctx context.Context, uuid string) error {
+	s.lock()
+	defer s.unlock()
+
+	delete(s.data.oauthGrants, uuid)
+	return nil
+}
+
+func (s *MemoryStore) RewriteOAuthGrant(ctx context.Context, grant *models.OAuthGrant) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.data.oauthGrants[grant.ResourceUUID]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.Code = grant.Code
+	existing.KeyID = grant.KeyID
+	existing.DataKey = grant.DataKey
+	s.data.oauthGrants[grant.ResourceUUID] = existing
+	return nil
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"time"
+)
+
+func (s *MemoryStore) EnqueueConfigPush(ctx context.Context, push *models.ConfigPush) error {
+	s.lock()
+	defer s.unlock()
+
+	for i := range s.data.configPushes {
+		existing := &s.data.configPushes[i]
+		if existing.ResourceUUID == push.ResourceUUID && existing.Status == models.PushPending {
+			existing.Status = models.PushSuperseded
+		}
+	}
+
+	push.Id = s.data.nextConfigPushId
+	s.data.nextConfigPushId++
+	push.Status = models.PushPending
+	push.CreatedAt = time.Now()
+	s.data.configPushes = append(s.data.configPushes, copyConfigPush(*push))
+	return nil
+}
+
+func (s *MemoryStore) GetLatestConfigPush(ctx context.Context, uuid string) (*models.ConfigPush, error) {
+	s.lock()
+	defer s.unlock()
+
+	for i := len(s.data.configPushes) - 1; i >= 0; i-- {
+		if s.data.configPushes[i].ResourceUUID == uuid {
+			push := copyConfigPush(s.data.configPushes[i])
+			return &push, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// InTx already runs one transaction at a time, so there is nothing more to lock
+func (s *MemoryStore) LockLatestConfigPush(ctx context.Context, uuid string) (*models.ConfigPush, error) {
+	return s.GetLatestConfigPush(ctx, uuid)
+}
+
+func (s *MemoryStore) ListDueConfigPushes(ctx context.Context, now time.Time) ([]models.ConfigPush, error) {
+	s.lock()
+	defer s.unlock()
+
+	pushes := []models.ConfigPush{}
+	for _, push := range s.data.configPushes {
+		if push.Status == models.PushPending && !push.NextAttemptAt.After(now) {
+			pushes = append(pushes, copyConfigPush(push))
+		}
+	}
+	return pushes, nil
+}
+
+func (s *MemoryStore) UpdateConfigPush(ctx context.Context, push *models.ConfigPush) error {
+	s.lock()
+	defer s.unlock()
+
+	for i := range s.data.configPushes {
+		existing := &s.data.configPushes[i]
+		if existing.Id == push.Id {
+			existing.Status = push.Status
+			existing.Attempts = push.Attempts
+			existing.LastError = push.LastError
+			existing.NextAttemptAt = push.NextAttemptAt
+			existing.DeliveredAt = push.DeliveredAt
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// Pushes share nothing with the caller, so neither side can change the other's config
+func copyConfigPush(push models.ConfigPush) models.ConfigPush {
+	config := make(map[string]string, len(push.Config))
+	for k, v := range push.Config {
+		config[k] = v
+	}
+	push.Config = config
+	return push
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"sort"
+	"time"
+)
+
+func (s *MemoryStore) ReportDeprovisionFailure(ctx context.Context, uuid string, retryAt time.Time) (*models.DeprovisionFailure, error) {
+	s.lock()
+	defer s.unlock()
+
+	failure, ok := s.data.deprovisionFailures[uuid]
+	if !ok || !failure.Outstanding() {
+		failure = models.DeprovisionFailure{
+			ResourceUUID:  uuid,
+			Status:        models.RemediationPending,
+			NextAttemptAt: retryAt,
+			ReportedAt:    time.Now(),
+		}
+		s.data.deprovisionFailures[uuid] = failure
+	}
+	return &failure, nil
+}
+
+func (s *MemoryStore) GetDeprovisionFailure(ctx context.Context, uuid string) (*models.DeprovisionFailure, error) {
+	s.lock()
+	defer s.unlock()
+
+	failure, ok := s.data.deprovisionFailures[uuid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &failure, nil
+}
+
+func (s *MemoryStore) ListDeprovisionFailures(ctx context.Context, all bool) ([]models.DeprovisionFailure, error) {
+	failures := s.listDeprovisionFailures(func(f models.DeprovisionFailure) bool {
+		return all || f.Outstanding()
+	})
+	sort.Slice(failures, func(i, j int) bool {
+		if !failures[i].ReportedAt.Equal(failures[j].ReportedAt) {
+			return failures[i].ReportedAt.Before(failures[j].ReportedAt)
+		}
+		return failures[i].ResourceUUID < failures[j].ResourceUUID
+	})
+	return failures, nil
+}
+
+func (s *MemoryStore) ListDueDeprovisionFailures(ctx context.Context, now time.Time) ([]models.DeprovisionFailure, error) {
+	failures := s.listDeprovisionFailures(func(f models.DeprovisionFailure) bool {
+		return f.Status == models.RemediationPending && !f.NextAttemptAt.After(now)
+	})
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].NextAttemptAt.Before(failures[j].NextAttemptAt)
+	})
+	return failures, nil
+}
+
+func (s *MemoryStore) UpdateDeprovisionFailure(ctx context.Context, failure *models.DeprovisionFailure) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.data.deprovisionFailures[failure.ResourceUUID]
+	if !ok {
+		return ErrNotFound
+	}
+	updated := *failure
+	updated.ReportedAt = existing.ReportedAt
+	s.data.deprovisionFailures[failure.ResourceUUID] = updated
+	return nil
+}
+
+func (s *MemoryStore) listDeprovisionFailures(keep func(models.DeprovisionFailure) bool) []models.DeprovisionFailure {
+	s.lock()
+	defer s.unlock()
+
+	failures := []models.DeprovisionFailure{}
+	for _, failure := range s.data.deprovisionFailures {
+		if keep(failure) {
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"time"
+)
+
+func (s *MemoryStore) SaveSSOCode(ctx context.Context, code *models.SSOCode) error {
+	s.lock()
+	defer s.unlock()
+
+	if _, ok := s.data.ssoCodes[code.CodeHash]; ok {
+		return ErrConflict
+	}
+
+	code.CreatedAt = time.Now()
+	s.data.ssoCodes[code.CodeHash] = *code
+	return nil
+}
+
+func (s *MemoryStore) ConsumeSSOCode(ctx context.Context, codeHash string) (*models.SSOCode, error) {
+	s.lock()
+	defer s.unlock()
+
+	code, ok := s.data.ssoCodes[codeHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(s.data.ssoCodes, codeHash)
+	return &code, nil
+}
+
+func (s *MemoryStore) CreateSession(ctx context.Context, session *models.Session) error {
+	s.lock()
+	defer s.unlock()
+
+	if _, ok := s.data.sessions[session.TokenHash]; ok {
+		return ErrConflict
+	}
+
+	now := time.Now()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	s.data.sessions[session.TokenHash] = *session
+	return nil
+}
+
+func (s *MemoryStore) GetSession(ctx context.Context, tokenHash string) (*models.Session, error) {
+	s.lock()
+	defer s.unlock()
+
+	session, ok := s.data.sessions[tokenHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+func (s *MemoryStore) TouchSession(ctx context.Context, tokenHash string, at time.Time) error {
+	return s.updateSession(tokenHash, func(session *models.Session) {
+		session.LastSeenAt = at
+	})
+}
+
+func (s *MemoryStore) SwitchSession(ctx context.Context, tokenHash string, uuid string) error {
+	return s.updateSession(tokenHash, func(session *models.Session) {
+		session.ResourceUUID = uuid
+	})
+}
+
+func (s *MemoryStore) RevokeSession(ctx context.Context, tokenHash string, at time.Time) error {
+	return s.updateSession(tokenHash, func(session *models.Session) {
+		session.RevokedAt = &at
+	})
+}
+
+func (s *MemoryStore) PurgeSessions(ctx context.Context, before time.Time, idleBefore time.Time) (int64, error) {
+	s.lock()
+	defer s.unlock()
+
+	for hash, code := range s.data.ssoCodes {
+		if code.ExpiresAt.Before(before) {
+			delete(s.data.ssoCodes, hash)
+		}
+	}
+
+	var purged int64
+	for hash, session := range s.data.sessions {
+		if session.ExpiresAt.Before(before) || session.LastSeenAt.Before(idleBefore) || session.RevokedAt != nil {
+			delete(s.data.sessions, hash)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// Apply fn to the session with the given token hash, unless it was revoked
+func (s *MemoryStore) updateSession(tokenHash string, fn func(*models.Session)) error {
+	s.lock()
+	defer s.unlock()
+
+	session, ok := s.data.sessions[tokenHash]
+	if !ok || session.RevokedAt != nil {
+		return ErrNotFound
+	}
+	fn(&session)
+	s.data.sessions[tokenHash] = session
+	return nil
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"sort"
+	"time"
+)
+
+func (s *MemoryStore) SaveTeam(ctx context.Context, team *models.Team) error {
+	s.lock()
+	defer s.unlock()
+
+	existing, ok := s.data.teams[team.Id]
+	if !ok {
+		existing = models.Team{Id: team.Id, CreatedAt: time.Now()}
+		s.data.teams[team.Id] = existing
+	}
+	team.CreatedAt = existing.CreatedAt
+	return nil
+}
+
+func (s *MemoryStore) GetTeam(ctx context.Context, id string) (*models.Team, error) {
+	s.lock()
+	defer s.unlock()
+
+	team, ok := s.data.teams[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &team, nil
+}
+
+func (s *MemoryStore) ListTeamAccounts(ctx context.Context, id string) ([]models.Account, error) {
+	s.lock()
+	defer s.unlock()
+
+	accounts := []models.Account{}
+	for _, account := range s.data.accounts {
+		if account.TeamId == id && id != "" {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if !accounts[i].CreatedAt.Equal(accounts[j].CreatedAt) {
+			return accounts[i].CreatedAt.Before(accounts[j].CreatedAt)
+		}
+		return accounts[i].Id < accounts[j].Id
+	})
+	return accounts, nil
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sample_app/models"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreRollback(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	err := s.InTx(ctx, func(tx Store) error {
+		err := tx.CreateActivity(ctx, &models.Activity{ResourceUUID: "uuid", Title: "inside"})
+		if err != nil {
+			return err
+		}
+		return errors.New("roll back")
+	})
+	if err == nil {
+		t.Fatal("InTx() did not return the error")
+	}
+
+	activities, err := s.ListActivities(ctx, "uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activities) != 0 {
+		t.Errorf("rolled back transaction left %d activities", len(activities))
+	}
+}
+
+// Rolling a transaction back must not undo writes made outside it while it ran
+func TestMemoryStoreRollbackKeepsOtherWrites(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	inTx := make(chan struct{})
+	written := make(chan error)
+	err := s.InTx(ctx, func(tx Store) error {
+		go func() {
+			<-inTx
+			written <- s.CreateActivity(ctx, &models.Activity{ResourceUUID: "uuid", Title: "outside"})
+		}()
+		close(inTx)
+
+		err := tx.CreateActivity(ctx, &models.Activity{ResourceUUID: "uuid", Title: "inside"})
+		if err != nil {
+			return err
+		}
+		return errors.New("roll back")
+	})
+	if err == nil {
+		t.Fatal("InTx() did not return the error")
+	}
+	err = <-written
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	activities, err := s.ListActivities(ctx, "uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activities) != 1 || activities[0].Title != "outside" {
+		t.Errorf("activities = %+v, want only the one written outside the transaction", activities)
+	}
+}
+
+func TestMemoryStoreDeprovisionRevokesLicenseKeys(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	err := s.CreateAccount(ctx, &models.Account{ResourceUUID: "uuid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []string{"old", "current"} {
+		err = s.IssueLicenseKey(ctx, &models.LicenseKey{ResourceUUID: "uuid", KeyHash: hash}, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	at := time.Now()
+	err = s.DeprovisionAccount(ctx, "uuid", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := s.ListLicenseKeys(ctx, "uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if key.Status(at) != models.LicenseKeyRevoked || !key.RevokedAt.Equal(at) {
+			t.Errorf("key %s is %s, want revoked at deprovisioning", key.KeyHash, key.Status(at))
+		}
+	}
+
+	// There is no live account left to deprovision
+	err = s.DeprovisionAccount(ctx, "uuid", at.Add(time.Hour))
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("second DeprovisionAccount() = %v, want ErrNotFound", err)
+	}
+}
+
+// Reads made outside a transaction while it runs must not see its writes
+func TestMemoryStoreReadsWaitForTransactions(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	read := make(chan int)
+	err := s.InTx(ctx, func(tx Store) error {
+		err := tx.CreateActivity(ctx, &models.Activity{ResourceUUID: "uuid", Title: "inside"})
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			activities, _ := s.ListActivities(ctx, "uuid")
+			read <- len(activities)
+		}()
+		select {
+		case n := <-read:
+			t.Errorf("read %d activities while the transaction ran", n)
+		case <-time.After(50 * time.Millisecond):
+		}
+		return errors.New("roll back")
+	})
+	if err == nil {
+		t.Fatal("InTx() did not return the error")
+	}
+
+	if n := <-read; n != 0 {
+		t.Errorf("read %d activities, want none from the rolled back transaction", n)
+	}
+}
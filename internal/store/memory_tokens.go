@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"sort"
+	"time"
+)
+
+func (s *MemoryStore) SaveToken(ctx context.Context, token *models.Token) error {
+	s.lock()
+	defer s.unlock()
+
+	if token.IssuedAt.IsZero() {
+		token.IssuedAt = time.Now()
+	}
+
+	if replaced, ok := s.data.tokens[token.ResourceUUID]; ok {
+		replaced.Id = s.data.nextTokenId
+		s.data.nextTokenId++
+		s.data.tokenHistory = append(s.data.tokenHistory, replaced)
+		s.trimTokenHistory(token.ResourceUUID)
+	}
+
+	current := *token
+	current.Id = 0
+	s.data.tokens[token.ResourceUUID] = current
+	return nil
+}
+
+// Drop all but the newest TokenHistoryLimit history entries for a resource
+func (s *MemoryStore) trimTokenHistory(uuid string) {
+	count := 0
+	for _, t := range s.data.tokenHistory {
+		if t.ResourceUUID == uuid {
+			count++
+		}
+	}
+
+	kept := []models.Token{}
+	for _, t := range s.data.tokenHistory {
+		if t.ResourceUUID == uuid && count > TokenHistoryLimit {
+			count--
+			continue
+		}
+		kept = append(kept, t)
+	}
+	s.data.tokenHistory = kept
+}
+
+func (s *MemoryStore) GetToken(ctx context.Context, uuid string) (*models.Token, error) {
+	s.lock()
+	defer s.unlock()
+
+	token, ok := s.data.tokens[uuid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &token, nil
+}
+
+// InTx already runs one transaction at a time, so there is nothing more to lock
+func (s *MemoryStore) LockToken(ctx context.Context, uuid string) (*models.Token, error) {
+	return s.GetToken(ctx, uuid)
+}
+
+func (s *MemoryStore) DeleteTokens(ctx context.Context, uuid string) error {
+	s.lock()
+	defer s.unlock()
+
+	delete(s.data.tokens, uuid)
+	kept := []models.Token{}
+	for _, t := range s.data.tokenHistory {
+		if t.ResourceUUID != uuid {
+			kept = append(kept, t)
+		}
+	}
+	s.data.tokenHistory = kept
+	return nil
+}
+
+func (s *MemoryStore) ListTokens(ctx context.Context) ([]models.Token, error) {
+	return s.listTokens(func(models.Token) bool { return true }, func(a, b models.Token) bool {
+		return a.ResourceUUID < b.ResourceUUID
+	})
+}
+
+func (s *MemoryStore) ListTokensExpiringBefore(ctx context.Context, before time.Time) ([]models.Token, error) {
+	return s.listTokens(func(t models.Token) bool { return t.ExpiresAt.Before(before) }, func(a, b models.Token) bool {
+		return a.ExpiresAt.Before(b.ExpiresAt)
+	})
+}
+
+func (s *MemoryStore) ListTokenHistory(ctx context.Context, uuid string) ([]models.Token, error) {
+	s.lock()
+	defer s.unlock()
+
+	history := []models.Token{}
+	for i := len(s.data.tokenHistory) - 1; i >= 0; i-- {
+		if s.data.tokenHistory[i].ResourceUUID == uuid {
+			history = append(history, s.data.tokenHistory[i])
+		}
+	}
+	return history, nil
+}
+
+func (s *MemoryStore) RewriteToken(ctx context.Context, token *models.Token) error {
+	s.lock()
+	defer s.unlock()
+
+	rewrite := func(existing *models.Token) {
+		existing.AccessToken = token.AccessToken
+		existing.RefreshToken = token.RefreshToken
+		existing.KeyID = token.KeyID
+		existing.DataKey = token.DataKey
+	}
+
+	if token.Id == 0 {
+		existing, ok := s.data.tokens[token.ResourceUUID]
+		if !ok || !existing.IssuedAt.Equal(token.IssuedAt) {
+			return ErrNotFound
+		}
+		rewrite(&existing)
+		s.data.tokens[token.ResourceUUID] = existing
+		return nil
+	}
+
+	for i := range s.data.tokenHistory {
+		if s.data.tokenHistory[i].Id == token.Id {
+			rewrite(&s.data.tokenHistory[i])
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// Current tokens matching keep, sorted by less
+func (s *MemoryStore) listTokens(keep func(models.Token) bool, less func(a, b models.Token) bool) ([]models.Token, error) {
+	s.lock()
+	defer s.unlock()
+
+	tokens := []models.Token{}
+	for _, token := range s.data.tokens {
+		if keep(token) {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return less(tokens[i], tokens[j])
+	})
+	return tokens, nil
+}
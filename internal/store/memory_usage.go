@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"sort"
+	"time"
+)
+
+// Identifies a rollup within a resource
+type rollupKey struct {
+	meter       string
+	granularity models.UsageGranularity
+	periodStart time.Time
+}
+
+func (s *MemoryStore) RecordUsageEvent(ctx context.Context, event *models.UsageEvent) (bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	keys, ok := s.data.usageEventKeys[event.ResourceUUID]
+	if !ok {
+		keys = map[string]bool{}
+		s.data.usageEventKeys[event.ResourceUUID] = keys
+	}
+	if keys[event.IdempotencyKey] {
+		return false, nil
+	}
+	keys[event.IdempotencyKey] = true
+	s.data.usageEvents = append(s.data.usageEvents, *event)
+
+	rollups, ok := s.data.usageRollups[event.ResourceUUID]
+	if !ok {
+		rollups = map[rollupKey]models.UsageRollup{}
+		s.data.usageRollups[event.ResourceUUID] = rollups
+	}
+	occurredAt := event.OccurredAt.UTC()
+	periods := map[models.UsageGranularity]time.Time{
+		models.UsageHourly: occurredAt.Truncate(time.Hour),
+		models.UsageDaily:  time.Date(occurredAt.Year(), occurredAt.Month(), occurredAt.Day(), 0, 0, 0, 0, time.UTC),
+	}
+	for granularity, periodStart := range periods {
+		key := rollupKey{event.Meter, granularity, periodStart}
+		rollup, ok := rollups[key]
+		if !ok {
+			rollup = models.UsageRollup{
+				ResourceUUID: event.ResourceUUID,
+				Meter:        event.Meter,
+				Granularity:  granularity,
+				PeriodStart:  periodStart,
+			}
+		}
+		rollup.Quantity += event.Quantity
+		rollup.EventCount++
+		rollups[key] = rollup
+	}
+
+	return true, nil
+}
+
+func (s *MemoryStore) ListUsageRollups(ctx context.Context, uuid string, granularity models.UsageGranularity, from time.Time, to time.Time, meter string) ([]models.UsageRollup, error) {
+	s.lock()
+	defer s.unlock()
+
+	rollups := []models.UsageRollup{}
+	for _, rollup := range s.data.usageRollups[uuid] {
+		if rollup.Granularity != granularity || rollup.PeriodStart.Before(from) || !rollup.PeriodStart.Before(to) {
+			continue
+		}
+		if meter != "" && rollup.Meter != meter {
+			continue
+		}
+		rollups = append(rollups, rollup)
+	}
+	sort.Slice(rollups, func(i, j int) bool {
+		if !rollups[i].PeriodStart.Equal(rollups[j].PeriodStart) {
+			return rollups[i].PeriodStart.Before(rollups[j].PeriodStart)
+		}
+		return rollups[i].Meter < rollups[j].Meter
+	})
+	return rollups, nil
+}
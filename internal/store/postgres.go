@@ -0,0 +1,377 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sample_app/models"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	accountColumns = `
+	id, name, email, COALESCE(app_slug, ''), COALESCE(plan_slug, ''), resource_uuid, language,
+	email_preference, COALESCE(source, ''), COALESCE(source_id, ''), status, license_key,
+	oauth_state, created_at, modified_at, deprovisioned_at, COALESCE(team_id, '')
+	`
+
+	GetAccountSQL = `
+	SELECT ` + accountColumns + ` FROM accounts WHERE resource_uuid=$1;
+	`
+
+	GetAccountByLicenseKeySQL = `
+	SELECT ` + accountColumns + ` FROM accounts WHERE license_key=$1 AND license_key<>'';
+	`
+
+	InsertAccountSQL = `
+	INSERT INTO accounts (name, email, app_slug, plan_slug, resource_uuid, language, email_preference, source, status, license_key,
+		oauth_state, team_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''))
+	RETURNING id, created_at, modified_at;
+	`
+
+	UpdateAccountSQL = `
+	UPDATE accounts
+	SET name=$2, email=$3, app_slug=$4, plan_slug=$5, language=$6, email_preference=$7, status=$8, license_key=$9,
+		oauth_state=$10, team_id=NULLIF($11, ''), deprovisioned_at=NULL
+	WHERE id=$1
+	RETURNING modified_at;
+	`
+
+	UpdatePlanSQL = `
+	UPDATE accounts
+	SET plan_slug=$2
+	WHERE resource_uuid=$1 AND deprovisioned_at IS NULL;
+	`
+
+	// Rows that already have a newer remote_updated_at are left alone
+	ApplyAccountUpdateSQL = `
+	UPDATE accounts
+	SET name=COALESCE(NULLIF($2, ''), name), plan_slug=COALESCE(NULLIF($3, ''), plan_slug),
+		status=COALESCE($4, status), remote_updated_at=$5
+	WHERE resource_uuid=$1 AND deprovisioned_at IS NULL
+		AND (remote_updated_at IS NULL OR remote_updated_at < $5);
+	`
+
+	UpdateStatusSQL = `
+	UPDATE accounts
+	SET status=$2
+	WHERE resource_uuid=$1 AND deprovisioned_at IS NULL;
+	`
+
+	UpdateOAuthStateSQL = `
+	UPDATE accounts
+	SET oauth_state=$2
+	WHERE resource_uuid=$1 AND deprovisioned_at IS NULL;
+	`
+
+	UpdateLicenseKeySQL = `
+	UPDATE accounts
+	SET license_key=$2
+	WHERE resource_uuid=$1 AND deprovisioned_at IS NULL;
+	`
+
+	// The license key is cleared and every key in its history revoked so they
+	// stop working straight away. Both statements see the account as it was
+	// before, so keys are only revoked if the account was live.
+	DeprovisionAccountSQL = `
+	WITH revoked AS (
+		UPDATE license_keys SET revoked_at=$2
+		WHERE resource_uuid=$1 AND revoked_at IS NULL
+			AND EXISTS (SELECT 1 FROM accounts WHERE resource_uuid=$1 AND deprovisioned_at IS NULL)
+	)
+	UPDATE accounts
+	SET deprovisioned_at=$2, license_key=''
+	WHERE resource_uuid=$1 AND deprovisioned_at IS NULL;
+	`
+
+	// Everything keyed by the purged resources goes in the same statement, as
+	// do teams that are left without any accounts
+	PurgeDeprovisionedAccountsSQL = `
+	WITH purged AS (
+		DELETE FROM accounts WHERE deprovisioned_at < $1
+		RETURNING resource_uuid, team_id
+	), teams AS (
+		DELETE FROM teams WHERE id IN (SELECT team_id FROM purged)
+			AND NOT EXISTS (
+				SELECT 1 FROM accounts
+				WHERE accounts.team_id=teams.id AND accounts.resource_uuid NOT IN (SELECT resource_uuid FROM purged)
+			)
+	), activities AS (
+		DELETE FROM activities WHERE resource_uuid IN (SELECT resource_uuid FROM purged)
+	), tokens AS (
+		DELETE FROM tokens WHERE resource_uuid IN (SELECT resource_uuid FROM purged)
+	), token_history AS (
+		DELETE FROM token_history WHERE resource_uuid IN (SELECT resource_uuid FROM purged)
+	), oauth_grants AS (
+		DELETE FROM oauth_grants WHERE resource_uuid IN (SELECT resource_uuid FROM purged)
+	), config_vars AS (
+		DELETE FROM config_vars WHERE resource_uuid IN (SELECT resource_uuid FROM purged)
+	), config_pushes AS (
+		DELETE FROM config_pushes WHERE resource_uuid IN (SELECT resource_uuid FROM purged)
+	), deprovision_failures AS (
+		DELETE FROM deprovision_failures WHERE resource_uuid IN (SELECT resource_uuid FROM purged)
+	), entitlement_overrides AS (
+		DELETE FROM entitlement_overrides WHERE resource_uuid IN (SELECT resource_uuid FROM purged)
+	), usage_events AS (
+		DELETE FROM usage_events WHERE resource_uuid IN (SELECT resource_uuid FROM purged)
+	), usage_event_keys AS (
+		DELETE FROM usage_event_keys WHERE resource_uuid IN (SELECT resource_uuid FROM purged)
+	), usage_rollups AS (
+		DELETE FROM usage_rollups WHERE resource_uuid IN (SELECT resource_uuid FROM purged)
+	), license_keys AS (
+		DELETE FROM license_keys WHERE resource_uuid IN (SELECT resource_uuid FROM purged)
+	), license_verifications AS (
+		DELETE FROM license_verifications WHERE resource_uuid IN (SELECT resource_uuid FROM purged)
+	), sso_codes AS (
+		DELETE FROM sso_codes WHERE resource_uuid IN (SELECT resource_uuid FROM purged)
+	), sessions AS (
+		DELETE FROM sessions WHERE resource_uuid IN (SELECT resource_uuid FROM purged)
+	)
+	SELECT resource_uuid FROM purged ORDER BY resource_uuid;
+	`
+
+	InsertActivitySQL = `
+	INSERT INTO activities (account_id, resource_uuid, type, title, body)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at, modified_at
+	`
+
+	ListActivitiesSQL = `
+	SELECT id, account_id, resource_uuid, type, title, body, created_at, modified_at
+	FROM activities WHERE resource_uuid=$1 ORDER BY id;
+	`
+)
+
+// Implemented by both *pgxpool.Pool and pgx.Tx, so the same queries can run in or out of a transaction
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// Store backed by the Postgres schema in internal/database
+type PostgresStore struct {
+	// Only set outside of a transaction
+	pool *pgxpool.Pool
+
+	db querier
+}
+
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{
+		pool: pool,
+		db:   pool,
+	}
+}
+
+func (s *PostgresStore) InTx(ctx context.Context, fn func(Store) error) error {
+	if s.pool == nil {
+		return fn(s)
+	}
+
+	return s.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		return fn(&PostgresStore{db: tx})
+	})
+}
+
+func (s *PostgresStore) GetAccount(ctx context.Context, uuid string) (*models.Account, error) {
+	return s.queryAccount(ctx, GetAccountSQL, uuid)
+}
+
+func (s *PostgresStore) GetAccountByLicenseKey(ctx context.Context, licenseKey string) (*models.Account, error) {
+	return s.queryAccount(ctx, GetAccountByLicenseKeySQL, licenseKey)
+}
+
+// Run a query for a single account
+func (s *PostgresStore) queryAccount(ctx context.Context, sql string, args ...interface{}) (*models.Account, error) {
+	account, err := scanAccount(s.db.QueryRow(ctx, sql, args...))
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// Scan a row of accountColumns
+func scanAccount(row pgx.Row) (*models.Account, error) {
+	account := &models.Account{}
+	err := row.Scan(
+		&account.Id,
+		&account.Name,
+		&account.Email,
+		&account.AppSlug,
+		&account.PlanSlug,
+		&account.ResourceUUID,
+		&account.Language,
+		&account.EmailPreference,
+		&account.Source,
+		&account.SourceId,
+		&account.Status,
+		&account.LicenseKey,
+		&account.OAuthState,
+		&account.CreatedAt,
+		&account.ModifiedAt,
+		&account.DeprovisionedAt,
+		&account.TeamId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+func (s *PostgresStore) CreateAccount(ctx context.Context, account *models.Account) error {
+	err := s.db.QueryRow(ctx, InsertAccountSQL,
+		account.Name,
+		account.Email,
+		account.AppSlug,
+		account.PlanSlug,
+		account.ResourceUUID,
+		account.Language,
+		account.EmailPreference,
+		account.Source,
+		account.Status,
+		account.LicenseKey,
+		account.OAuthState,
+		account.TeamId,
+	).Scan(&account.Id, &account.CreatedAt, &account.ModifiedAt)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+
+	return err
+}
+
+func (s *PostgresStore) UpdateAccount(ctx context.Context, account *models.Account) error {
+	err := s.db.QueryRow(ctx, UpdateAccountSQL,
+		account.Id,
+		account.Name,
+		account.Email,
+		account.AppSlug,
+		account.PlanSlug,
+		account.Language,
+		account.EmailPreference,
+		account.Status,
+		account.LicenseKey,
+		account.OAuthState,
+		account.TeamId,
+	).Scan(&account.ModifiedAt)
+	if err == pgx.ErrNoRows {
+		return ErrNotFound
+	}
+	if err == nil {
+		account.DeprovisionedAt = nil
+	}
+
+	return err
+}
+
+func (s *PostgresStore) UpdatePlan(ctx context.Context, uuid string, planSlug string) error {
+	return s.execOne(ctx, UpdatePlanSQL, uuid, planSlug)
+}
+
+func (s *PostgresStore) ApplyAccountUpdate(ctx context.Context, uuid string, update AccountUpdate) (bool, error) {
+	tag, err := s.db.Exec(ctx, ApplyAccountUpdateSQL, uuid, update.Name, update.PlanSlug, update.Status, update.UpdatedAt)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() > 0 {
+		return true, nil
+	}
+
+	// Nothing changed, either because the account is missing or the update is stale
+	_, err = s.GetAccount(ctx, uuid)
+	return false, err
+}
+
+func (s *PostgresStore) UpdateStatus(ctx context.Context, uuid string, status models.Status) error {
+	return s.execOne(ctx, UpdateStatusSQL, uuid, status)
+}
+
+func (s *PostgresStore) UpdateOAuthState(ctx context.Context, uuid string, state models.OAuthState) error {
+	return s.execOne(ctx, UpdateOAuthStateSQL, uuid, state)
+}
+
+func (s *PostgresStore) UpdateLicenseKey(ctx context.Context, uuid string, licenseKey string) error {
+	return s.execOne(ctx, UpdateLicenseKeySQL, uuid, licenseKey)
+}
+
+func (s *PostgresStore) DeprovisionAccount(ctx context.Context, uuid string, at time.Time) error {
+	return s.execOne(ctx, DeprovisionAccountSQL, uuid, at)
+}
+
+func (s *PostgresStore) PurgeDeprovisionedAccounts(ctx context.Context, before time.Time) ([]string, error) {
+	rows, err := s.db.Query(ctx, PurgeDeprovisionedAccountsSQL, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	purged := []string{}
+	for rows.Next() {
+		var uuid string
+		err = rows.Scan(&uuid)
+		if err != nil {
+			return nil, err
+		}
+		purged = append(purged, uuid)
+	}
+
+	return purged, rows.Err()
+}
+
+func (s *PostgresStore) CreateActivity(ctx context.Context, activity *models.Activity) error {
+	return s.db.QueryRow(ctx, InsertActivitySQL,
+		activity.AccountId,
+		activity.ResourceUUID,
+		activity.Type,
+		activity.Title,
+		activity.Body,
+	).Scan(&activity.Id, &activity.CreatedAt, &activity.ModifiedAt)
+}
+
+func (s *PostgresStore) ListActivities(ctx context.Context, uuid string) ([]models.Activity, error) {
+	rows, err := s.db.Query(ctx, ListActivitiesSQL, uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activities := []models.Activity{}
+	for rows.Next() {
+		a := models.Activity{}
+		err = rows.Scan(&a.Id, &a.AccountId, &a.ResourceUUID, &a.Type, &a.Title, &a.Body, &a.CreatedAt, &a.ModifiedAt)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, a)
+	}
+
+	return activities, rows.Err()
+}
+
+// Run a statement that is expected to touch at least one row
+func (s *PostgresStore) execOne(ctx context.Context, sql string, args ...interface{}) error {
+	commandTag, err := s.db.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Whether err was caused by a unique constraint
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
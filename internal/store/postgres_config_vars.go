@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+)
+
+const (
+	ListConfigVarsSQL = `
+	SELECT name, value, pinned, updated_at
+	FROM config_vars WHERE resource_uuid=$1
+	ORDER BY name;
+	`
+
+	SetConfigVarsSQL = `
+	WITH removed AS (
+		DELETE FROM config_vars
+		WHERE resource_uuid=$1 AND NOT (name = ANY($2::varchar[]))
+	), saved AS (
+		INSERT INTO config_vars (resource_uuid, name, value, pinned)
+		SELECT $1, v.name, v.value, v.pinned
+		FROM unnest($2::varchar[], $3::varchar[], $4::boolean[]) AS v(name, value, pinned)
+		ON CONFLICT (resource_uuid, name) DO UPDATE
+		SET value=EXCLUDED.value, pinned=EXCLUDED.pinned, updated_at=now()
+		WHERE config_vars.value <> EXCLUDED.value OR config_vars.pinned <> EXCLUDED.pinned
+		RETURNING name, updated_at
+	)
+	SELECT name, updated_at FROM saved
+	UNION ALL
+	SELECT name, updated_at FROM config_vars
+	WHERE resource_uuid=$1 AND name = ANY($2::varchar[]) AND name NOT IN (SELECT name FROM saved);
+	`
+)
+
+func (s *PostgresStore) ListConfigVars(ctx context.Context, uuid string) ([]models.ConfigVar, error) {
+	rows, err := s.db.Query(ctx, ListConfigVarsSQL, uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vars := []models.ConfigVar{}
+	for rows.Next() {
+		v := models.ConfigVar{}
+		err = rows.Scan(&v.Name, &v.Value, &v.Pinned, &v.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		vars = append(vars, v)
+	}
+
+	return vars, rows.Err()
+}
+
+func (s *PostgresStore) SetConfigVars(ctx context.Context, uuid string, vars []models.ConfigVar) error {
+	names := make([]string, 0, len(vars))
+	values := make([]string, 0, len(vars))
+	pinned := make([]bool, 0, len(vars))
+	byName := make(map[string]*models.ConfigVar, len(vars))
+	for i := range vars {
+		names = append(names, vars[i].Name)
+		values = append(values, vars[i].Value)
+		pinned = append(pinned, vars[i].Pinned)
+		byName[vars[i].Name] = &vars[i]
+	}
+
+	rows, err := s.db.Query(ctx, SetConfigVarsSQL, uuid, names, values, pinned)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		v := models.ConfigVar{}
+		err = rows.Scan(&name, &v.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if target, ok := byName[name]; ok {
+			target.UpdatedAt = v.UpdatedAt
+		}
+	}
+
+	return rows.Err()
+}
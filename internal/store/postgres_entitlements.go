@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+)
+
+const (
+	SetEntitlementOverrideSQL = `
+	INSERT INTO entitlement_overrides (resource_uuid, kind, name, enabled, "limit", reason)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT (resource_uuid, kind, name) DO UPDATE
+	SET enabled=EXCLUDED.enabled, "limit"=EXCLUDED."limit", reason=EXCLUDED.reason, created_at=now()
+	RETURNING created_at;
+	`
+
+	ListEntitlementOverridesSQL = `
+	SELECT resource_uuid, kind, name, enabled, "limit", reason, created_at
+	FROM entitlement_overrides WHERE resource_uuid=$1
+	ORDER BY kind, name;
+	`
+
+	DeleteEntitlementOverrideSQL = `
+	DELETE FROM entitlement_overrides
+	WHERE resource_uuid=$1 AND kind=$2 AND name=$3;
+	`
+)
+
+func (s *PostgresStore) SetEntitlementOverride(ctx context.Context, override *models.EntitlementOverride) error {
+	return s.db.QueryRow(ctx, SetEntitlementOverrideSQL,
+		override.ResourceUUID,
+		override.Kind,
+		override.Name,
+		override.Enabled,
+		override.Limit,
+		override.Reason,
+	).Scan(&override.CreatedAt)
+}
+
+func (s *PostgresStore) ListEntitlementOverrides(ctx context.Context, uuid string) ([]models.EntitlementOverride, error) {
+	rows, err := s.db.Query(ctx, ListEntitlementOverridesSQL, uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := []models.EntitlementOverride{}
+	for rows.Next() {
+		o := models.EntitlementOverride{}
+		err = rows.Scan(&o.ResourceUUID, &o.Kind, &o.Name, &o.Enabled, &o.Limit, &o.Reason, &o.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+
+	return overrides, rows.Err()
+}
+
+func (s *PostgresStore) DeleteEntitlementOverride(ctx context.Context, uuid string, kind models.OverrideKind, name string) error {
+	return s.execOne(ctx, DeleteEntitlementOverrideSQL, uuid, kind, name)
+}
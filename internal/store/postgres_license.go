@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	IssueLicenseKeySQL = `
+	WITH replaced AS (
+		UPDATE license_keys
+		SET replaced_at=COALESCE(replaced_at, now()), expires_at=LEAST(expires_at, $4)
+		WHERE resource_uuid=$1 AND revoked_at IS NULL
+	)
+	INSERT INTO license_keys (resource_uuid, key_hash, key_hint, expires_at)
+	VALUES ($1, $2, $3, $5)
+	RETURNING id, issued_at;
+	`
+
+	GetLicenseKeySQL = `
+	SELECT id, resource_uuid, key_hash, key_hint, issued_at, replaced_at, expires_at, revoked_at, last_used_at
+	FROM license_keys WHERE key_hash=$1;
+	`
+
+	ListLicenseKeysSQL = `
+	SELECT id, resource_uuid, key_hash, key_hint, issued_at, replaced_at, expires_at, revoked_at, last_used_at
+	FROM license_keys WHERE resource_uuid=$1
+	ORDER BY id DESC;
+	`
+
+	ListExpiringLicenseKeysSQL = `
+	SELECT k.id, k.resource_uuid, k.key_hash, k.key_hint, k.issued_at, k.replaced_at, k.expires_at, k.revoked_at, k.last_used_at
+	FROM license_keys k JOIN accounts a ON a.resource_uuid=k.resource_uuid
+	WHERE k.replaced_at IS NULL AND k.revoked_at IS NULL AND k.expires_at < $1
+		AND a.deprovisioned_at IS NULL
+	ORDER BY k.expires_at;
+	`
+
+	RevokeLicenseKeySQL = `
+	UPDATE license_keys SET revoked_at=$3
+	WHERE resource_uuid=$1 AND id=$2 AND revoked_at IS NULL;
+	`
+
+	TouchLicenseKeySQL = `
+	UPDATE license_keys SET last_used_at=$2 WHERE id=$1;
+	`
+
+	InsertLicenseVerificationSQL = `
+	INSERT INTO license_verifications (key_hash, resource_uuid, result, remote_ip)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at;
+	`
+
+	ListLicenseVerificationsSQL = `
+	SELECT id, key_hash, resource_uuid, result, remote_ip, created_at
+	FROM license_verifications WHERE resource_uuid=$1
+	ORDER BY id DESC LIMIT $2;
+	`
+
+	PurgeLicenseVerificationsSQL = `
+	DELETE FROM license_verifications WHERE created_at < $1;
+	`
+)
+
+func (s *PostgresStore) IssueLicenseKey(ctx context.Context, key *models.LicenseKey, graceUntil time.Time) error {
+	err := s.db.QueryRow(ctx, IssueLicenseKeySQL,
+		key.ResourceUUID,
+		key.KeyHash,
+		key.Hint,
+		graceUntil,
+		key.ExpiresAt,
+	).Scan(&key.Id, &key.IssuedAt)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *PostgresStore) GetLicenseKey(ctx context.Context, keyHash string) (*models.LicenseKey, error) {
+	key := &models.LicenseKey{}
+	err := scanLicenseKey(s.db.QueryRow(ctx, GetLicenseKeySQL, keyHash), key)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *PostgresStore) ListLicenseKeys(ctx context.Context, uuid string) ([]models.LicenseKey, error) {
+	return s.listLicenseKeys(ctx, ListLicenseKeysSQL, uuid)
+}
+
+func (s *PostgresStore) ListExpiringLicenseKeys(ctx context.Context, before time.Time) ([]models.LicenseKey, error) {
+	return s.listLicenseKeys(ctx, ListExpiringLicenseKeysSQL, before)
+}
+
+func (s *PostgresStore) listLicenseKeys(ctx context.Context, sql string, args ...interface{}) ([]models.LicenseKey, error) {
+	rows, err := s.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.LicenseKey{}
+	for rows.Next() {
+		key := models.LicenseKey{}
+		err = scanLicenseKey(rows, &key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (s *PostgresStore) RevokeLicenseKey(ctx context.Context, uuid string, id int, at time.Time) error {
+	return s.execOne(ctx, RevokeLicenseKeySQL, uuid, id, at)
+}
+
+func (s *PostgresStore) TouchLicenseKey(ctx context.Context, id int, at time.Time) error {
+	return s.execOne(ctx, TouchLicenseKeySQL, id, at)
+}
+
+func scanLicenseKey(row pgx.Row, key *models.LicenseKey) error {
+	return row.Scan(
+		&key.Id,
+		&key.ResourceUUID,
+		&key.KeyHash,
+		&key.Hint,
+		&key.IssuedAt,
+		&key.ReplacedAt,
+		&key.ExpiresAt,
+		&key.RevokedAt,
+		&key.LastUsedAt,
+	)
+}
+
+func (s *PostgresStore) RecordLicenseVerification(ctx context.Context, verification *models.LicenseVerification) error {
+	return s.db.QueryRow(ctx, InsertLicenseVerificationSQL,
+		verification.KeyHash,
+		verification.ResourceUUID,
+		verification.Result,
+		verification.RemoteIP,
+	).Scan(&verification.Id, &verification.CreatedAt)
+}
+
+func (s *PostgresStore) ListLicenseVerifications(ctx context.Context, uuid string, limit int) ([]models.LicenseVerification, error) {
+	rows, err := s.db.Query(ctx, ListLicenseVerificationsSQL, uuid, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	verifications := []models.LicenseVerification{}
+	for rows.Next() {
+		v := models.LicenseVerification{}
+		err = rows.Scan(&v.Id, &v.KeyHash, &v.ResourceUUID, &v.Result, &v.RemoteIP, &v.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		verifications = append(verifications, v)
+	}
+
+	return verifications, rows.Err()
+}
+
+func (s *PostgresStore) PurgeLicenseVerifications(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.db.Exec(ctx, PurgeLicenseVerificationsSQL, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	oauthGrantColumns = `
+	resource_uuid, code, expires_at, attempts, last_error, next_attempt_at, created_at, COALESCE(key_id, ''), data_key
+	`
+
+	SaveOAuthGrantSQL = `
+	INSERT INTO oauth_grants (resource_uuid, code, expires_at, attempts, last_error, next_attempt_at, key_id, data_key)
+	VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8)
+	ON CONFLICT (resource_uuid) DO UPDATE
+	SET code=EXCLUDED.code, expires_at=EXCLUDED.expires_at, attempts=EXCLUDED.attempts,
+		last_error=EXCLUDED.last_error, next_attempt_at=EXCLUDED.next_attempt_at,
+		created_at=now(), key_id=EXCLUDED.key_id, data_key=EXCLUDED.data_key
+	RETURNING created_at;
+	`
+
+	LockOAuthGrantSQL = `
+	SELECT ` + oauthGrantColumns + ` FROM oauth_grants WHERE resource_uuid=$1 FOR UPDATE;
+	`
+
+	ListDueOAuthGrantsSQL = `
+	SELECT ` + oauthGrantColumns + ` FROM oauth_grants WHERE next_attempt_at <= $1 ORDER BY next_attempt_at;
+	`
+
+	ListOAuthGrantsSQL = `
+	SELECT ` + oauthGrantColumns + ` FROM oauth_grants ORDER BY resource_uuid;
+	`
+
+	UpdateOAuthGrantSQL = `
+	UPDATE oauth_grants
+	SET attempts=$2, last_error=$3, next_attempt_at=$4
+	WHERE resource_uuid=$1;
+	`
+
+	DeleteOAuthGrantSQL = `
+	DELETE FROM oauth_grants
+	WHERE resource_uuid=$1
+	`
+
+	RewriteOAuthGrantSQL = `
+	UPDATE oauth_grants
+	SET code=$2, key_id=NULLIF($3, ''), data_key=$4
+	WHERE resource_uuid=$1;
+	`
+)
+
+func (s *PostgresStore) SaveOAuthGrant(ctx context.Context, grant *models.OAuthGrant) error {
+	return s.db.QueryRow(ctx, SaveOAuthGrantSQL,
+		grant.ResourceUUID,
+		grant.Code,
+		grant.ExpiresAt,
+		grant.Attempts,
+		grant.LastError,
+		grant.NextAttemptAt,
+		grant.KeyID,
+		grant.DataKey,
+	).Scan(&grant.CreatedAt)
+}
+
+// The row lock is held by the transaction this store runs in, if any
+func (s *PostgresStore) LockOAuthGrant(ctx context.Context, uuid string) (*models.OAuthGrant, error) {
+	grant := &models.OAuthGrant{}
+	err := scanOAuthGrant(s.db.QueryRow(ctx, LockOAuthGrantSQL, uuid), grant)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return grant, nil
+}
+
+func (s *PostgresStore) ListDueOAuthGrants(ctx context.Context, now time.Time) ([]models.OAuthGrant, error) {
+	return s.listOAuthGrants(ctx, ListDueOAuthGrantsSQL, now)
+}
+
+func (s *PostgresStore) ListOAuthGrants(ctx context.Context) ([]models.OAuthGrant, error) {
+	return s.listOAuthGrants(ctx, ListOAuthGrantsSQL)
+}
+
+func (s *PostgresStore) listOAuthGrants(ctx context.Context, sql string, args ...interface{}) ([]models.OAuthGrant, error) {
+	rows, err := s.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []models.OAuthGrant{}
+	for rows.Next() {
+		grant := models.OAuthGrant{}
+		err = scanOAuthGrant(rows, &grant)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+
+	return grants, rows.Err()
+}
+
+func (s *PostgresStore) UpdateOAuthGrant(ctx context.Context, grant *models.OAuthGrant) error {
+	return s.execOne(ctx, UpdateOAuthGrantSQL,
+		grant.ResourceUUID,
+		grant.Attempts,
+		grant.LastError,
+		grant.NextAttemptAt,
+	)
+}
+
+func (s *PostgresStore) DeleteOAuthGrant(ctx context.Context, uuid string) error {
+	_, err := s.db.Exec(ctx, DeleteOAuthGrantSQL, uuid)
+	return err
+}
+
+func (s *PostgresStore) RewriteOAuthGrant(ctx context.Context, grant *models.OAuthGrant) error {
+	return s.execOne(ctx, RewriteOAuthGrantSQL,
+		grant.ResourceUUID,
+		grant.Code,
+		grant.KeyID,
+		grant.DataKey,
+	)
+}
+
+func scanOAuthGrant(row pgx.Row, grant *models.OAuthGrant) error {
+	return row.Scan(
+		&grant.ResourceUUID,
+		&grant.Code,
+		&grant.ExpiresAt,
+		&grant.Attempts,
+		&grant.LastError,
+		&grant.NextAttemptAt,
+		&grant.CreatedAt,
+		&grant.KeyID,
+		&grant.DataKey,
+	)
+}
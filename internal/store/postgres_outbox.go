@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	configPushColumns = `
+	id, resource_uuid, config, status, attempts, last_error, next_attempt_at, created_at, delivered_at
+	`
+
+	// Pending pushes for the resource are superseded in the same statement
+	EnqueueConfigPushSQL = `
+	WITH superseded AS (
+		UPDATE config_pushes SET status=$5
+		WHERE resource_uuid=$1 AND status=$3
+	)
+	INSERT INTO config_pushes (resource_uuid, config, status, next_attempt_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at;
+	`
+
+	GetLatestConfigPushSQL = `
+	SELECT ` + configPushColumns + ` FROM config_pushes
+	WHERE resource_uuid=$1
+	ORDER BY id DESC LIMIT 1;
+	`
+
+	LockLatestConfigPushSQL = `
+	SELECT ` + configPushColumns + ` FROM config_pushes
+	WHERE resource_uuid=$1
+	ORDER BY id DESC LIMIT 1
+	FOR UPDATE;
+	`
+
+	ListDueConfigPushesSQL = `
+	SELECT ` + configPushColumns + ` FROM config_pushes
+	WHERE status=$1 AND next_attempt_at <= $2
+	ORDER BY id;
+	`
+
+	UpdateConfigPushSQL = `
+	UPDATE config_pushes
+	SET status=$2, attempts=$3, last_error=$4, next_attempt_at=$5, delivered_at=$6
+	WHERE id=$1;
+	`
+)
+
+func (s *PostgresStore) EnqueueConfigPush(ctx context.Context, push *models.ConfigPush) error {
+	push.Status = models.PushPending
+	return s.db.QueryRow(ctx, EnqueueConfigPushSQL,
+		push.ResourceUUID,
+		push.Config,
+		push.Status,
+		push.NextAttemptAt,
+		models.PushSuperseded,
+	).Scan(&push.Id, &push.CreatedAt)
+}
+
+func (s *PostgresStore) GetLatestConfigPush(ctx context.Context, uuid string) (*models.ConfigPush, error) {
+	return s.getConfigPush(ctx, GetLatestConfigPushSQL, uuid)
+}
+
+// The row lock is held by the transaction this store runs in, if any
+func (s *PostgresStore) LockLatestConfigPush(ctx context.Context, uuid string) (*models.ConfigPush, error) {
+	return s.getConfigPush(ctx, LockLatestConfigPushSQL, uuid)
+}
+
+func (s *PostgresStore) getConfigPush(ctx context.Context, sql string, uuid string) (*models.ConfigPush, error) {
+	push := &models.ConfigPush{}
+	err := scanConfigPush(s.db.QueryRow(ctx, sql, uuid), push)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return push, nil
+}
+
+func (s *PostgresStore) ListDueConfigPushes(ctx context.Context, now time.Time) ([]models.ConfigPush, error) {
+	rows, err := s.db.Query(ctx, ListDueConfigPushesSQL, models.PushPending, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pushes := []models.ConfigPush{}
+	for rows.Next() {
+		push := models.ConfigPush{}
+		err = scanConfigPush(rows, &push)
+		if err != nil {
+			return nil, err
+		}
+		pushes = append(pushes, push)
+	}
+
+	return pushes, rows.Err()
+}
+
+func (s *PostgresStore) UpdateConfigPush(ctx context.Context, push *models.ConfigPush) error {
+	return s.execOne(ctx, UpdateConfigPushSQL,
+		push.Id,
+		push.Status,
+		push.Attempts,
+		push.LastError,
+		push.NextAttemptAt,
+		push.DeliveredAt,
+	)
+}
+
+func scanConfigPush(row pgx.Row, push *models.ConfigPush) error {
+	return row.Scan(
+		&push.Id,
+		&push.ResourceUUID,
+		&push.Config,
+		&push.Status,
+		&push.Attempts,
+		&push.LastError,
+		&push.NextAttemptAt,
+		&push.CreatedAt,
+		&push.DeliveredAt,
+	)
+}
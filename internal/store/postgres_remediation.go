@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	deprovisionFailureColumns = `
+	resource_uuid, status, attempts, last_error, next_attempt_at, reported_at, resolved_at, resolution
+	`
+
+	// Only failures that are no longer pending or exhausted are reopened
+	ReportDeprovisionFailureSQL = `
+	INSERT INTO deprovision_failures (resource_uuid, status, next_attempt_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (resource_uuid) DO UPDATE
+	SET status=EXCLUDED.status, attempts=0, last_error='', next_attempt_at=EXCLUDED.next_attempt_at,
+		reported_at=now(), resolved_at=NULL, resolution=''
+	WHERE deprovision_failures.status NOT IN ($2, $4);
+	`
+
+	GetDeprovisionFailureSQL = `
+	SELECT ` + deprovisionFailureColumns + ` FROM deprovision_failures WHERE resource_uuid=$1;
+	`
+
+	ListDeprovisionFailuresSQL = `
+	SELECT ` + deprovisionFailureColumns + ` FROM deprovision_failures
+	WHERE $1 OR status IN ($2, $3)
+	ORDER BY reported_at, resource_uuid;
+	`
+
+	ListDueDeprovisionFailuresSQL = `
+	SELECT ` + deprovisionFailureColumns + ` FROM deprovision_failures
+	WHERE status=$1 AND next_attempt_at <= $2
+	ORDER BY next_attempt_at;
+	`
+
+	UpdateDeprovisionFailureSQL = `
+	UPDATE deprovision_failures
+	SET status=$2, attempts=$3, last_error=$4, next_attempt_at=$5, resolved_at=$6, resolution=$7
+	WHERE resource_uuid=$1;
+	`
+)
+
+func (s *PostgresStore) ReportDeprovisionFailure(ctx context.Context, uuid string, retryAt time.Time) (*models.DeprovisionFailure, error) {
+	_, err := s.db.Exec(ctx, ReportDeprovisionFailureSQL, uuid, models.RemediationPending, retryAt, models.RemediationExhausted)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetDeprovisionFailure(ctx, uuid)
+}
+
+func (s *PostgresStore) GetDeprovisionFailure(ctx context.Context, uuid string) (*models.DeprovisionFailure, error) {
+	failure := &models.DeprovisionFailure{}
+	err := scanDeprovisionFailure(s.db.QueryRow(ctx, GetDeprovisionFailureSQL, uuid), failure)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return failure, nil
+}
+
+func (s *PostgresStore) ListDeprovisionFailures(ctx context.Context, all bool) ([]models.DeprovisionFailure, error) {
+	return s.queryDeprovisionFailures(ctx, ListDeprovisionFailuresSQL, all, models.RemediationPending, models.RemediationExhausted)
+}
+
+func (s *PostgresStore) ListDueDeprovisionFailures(ctx context.Context, now time.Time) ([]models.DeprovisionFailure, error) {
+	return s.queryDeprovisionFailures(ctx, ListDueDeprovisionFailuresSQL, models.RemediationPending, now)
+}
+
+func (s *PostgresStore) UpdateDeprovisionFailure(ctx context.Context, failure *models.DeprovisionFailure) error {
+	return s.execOne(ctx, UpdateDeprovisionFailureSQL,
+		failure.ResourceUUID,
+		failure.Status,
+		failure.Attempts,
+		failure.LastError,
+		failure.NextAttemptAt,
+		failure.ResolvedAt,
+		failure.Resolution,
+	)
+}
+
+func (s *PostgresStore) queryDeprovisionFailures(ctx context.Context, sql string, args ...interface{}) ([]models.DeprovisionFailure, error) {
+	rows, err := s.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := []models.DeprovisionFailure{}
+	for rows.Next() {
+		failure := models.DeprovisionFailure{}
+		err = scanDeprovisionFailure(rows, &failure)
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, failure)
+	}
+
+	return failures, rows.Err()
+}
+
+func scanDeprovisionFailure(row pgx.Row, failure *models.DeprovisionFailure) error {
+	return row.Scan(
+		&failure.ResourceUUID,
+		&failure.Status,
+		&failure.Attempts,
+		&failure.LastError,
+		&failure.NextAttemptAt,
+		&failure.ReportedAt,
+		&failure.ResolvedAt,
+		&failure.Resolution,
+	)
+}
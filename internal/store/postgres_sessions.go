@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	InsertSSOCodeSQL = `
+	INSERT INTO sso_codes (code_hash, resource_uuid, team_id, expires_at)
+	VALUES ($1, $2, NULLIF($3, ''), $4)
+	RETURNING created_at;
+	`
+
+	ConsumeSSOCodeSQL = `
+	DELETE FROM sso_codes WHERE code_hash=$1
+	RETURNING code_hash, resource_uuid, COALESCE(team_id, ''), expires_at, created_at;
+	`
+
+	InsertSessionSQL = `
+	INSERT INTO sessions (token_hash, resource_uuid, team_id, expires_at)
+	VALUES ($1, $2, NULLIF($3, ''), $4)
+	RETURNING created_at, last_seen_at;
+	`
+
+	GetSessionSQL = `
+	SELECT token_hash, resource_uuid, COALESCE(team_id, ''), created_at, last_seen_at, expires_at, revoked_at
+	FROM sessions WHERE token_hash=$1;
+	`
+
+	TouchSessionSQL = `
+	UPDATE sessions
+	SET last_seen_at=$2
+	WHERE token_hash=$1 AND revoked_at IS NULL;
+	`
+
+	SwitchSessionSQL = `
+	UPDATE sessions
+	SET resource_uuid=$2
+	WHERE token_hash=$1 AND revoked_at IS NULL;
+	`
+
+	RevokeSessionSQL = `
+	UPDATE sessions
+	SET revoked_at=$2
+	WHERE token_hash=$1 AND revoked_at IS NULL;
+	`
+
+	// Codes go in the same statement, since they expire much sooner than sessions
+	PurgeSessionsSQL = `
+	WITH sso_codes AS (
+		DELETE FROM sso_codes WHERE expires_at < $1
+	)
+	DELETE FROM sessions
+	WHERE expires_at < $1 OR last_seen_at < $2 OR revoked_at IS NOT NULL;
+	`
+)
+
+func (s *PostgresStore) SaveSSOCode(ctx context.Context, code *models.SSOCode) error {
+	return s.db.QueryRow(ctx, InsertSSOCodeSQL,
+		code.CodeHash,
+		code.ResourceUUID,
+		code.TeamId,
+		code.ExpiresAt,
+	).Scan(&code.CreatedAt)
+}
+
+func (s *PostgresStore) ConsumeSSOCode(ctx context.Context, codeHash string) (*models.SSOCode, error) {
+	code := &models.SSOCode{}
+	err := s.db.QueryRow(ctx, ConsumeSSOCodeSQL, codeHash).Scan(
+		&code.CodeHash,
+		&code.ResourceUUID,
+		&code.TeamId,
+		&code.ExpiresAt,
+		&code.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return code, nil
+}
+
+func (s *PostgresStore) CreateSession(ctx context.Context, session *models.Session) error {
+	err := s.db.QueryRow(ctx, InsertSessionSQL,
+		session.TokenHash,
+		session.ResourceUUID,
+		session.TeamId,
+		session.ExpiresAt,
+	).Scan(&session.CreatedAt, &session.LastSeenAt)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+
+	return err
+}
+
+func (s *PostgresStore) GetSession(ctx context.Context, tokenHash string) (*models.Session, error) {
+	session := &models.Session{}
+	err := s.db.QueryRow(ctx, GetSessionSQL, tokenHash).Scan(
+		&session.TokenHash,
+		&session.ResourceUUID,
+		&session.TeamId,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (s *PostgresStore) TouchSession(ctx context.Context, tokenHash string, at time.Time) error {
+	return s.execOne(ctx, TouchSessionSQL, tokenHash, at)
+}
+
+func (s *PostgresStore) SwitchSession(ctx context.Context, tokenHash string, uuid string) error {
+	return s.execOne(ctx, SwitchSessionSQL, tokenHash, uuid)
+}
+
+func (s *PostgresStore) RevokeSession(ctx context.Context, tokenHash string, at time.Time) error {
+	return s.execOne(ctx, RevokeSessionSQL, tokenHash, at)
+}
+
+func (s *PostgresStore) PurgeSessions(ctx context.Context, before time.Time, idleBefore time.Time) (int64, error) {
+	tag, err := s.db.Exec(ctx, PurgeSessionsSQL, before, idleBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// The no-op update lets an existing team's row be returned
+	SaveTeamSQL = `
+	INSERT INTO teams (id)
+	VALUES ($1)
+	ON CONFLICT (id) DO UPDATE SET id=EXCLUDED.id
+	RETURNING created_at;
+	`
+
+	GetTeamSQL = `
+	SELECT id, created_at FROM teams WHERE id=$1;
+	`
+
+	ListTeamAccountsSQL = `
+	SELECT ` + accountColumns + ` FROM accounts WHERE team_id=$1 ORDER BY created_at, id;
+	`
+)
+
+func (s *PostgresStore) SaveTeam(ctx context.Context, team *models.Team) error {
+	return s.db.QueryRow(ctx, SaveTeamSQL, team.Id).Scan(&team.CreatedAt)
+}
+
+func (s *PostgresStore) GetTeam(ctx context.Context, id string) (*models.Team, error) {
+	team := &models.Team{}
+	err := s.db.QueryRow(ctx, GetTeamSQL, id).Scan(&team.Id, &team.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return team, nil
+}
+
+func (s *PostgresStore) ListTeamAccounts(ctx context.Context, id string) ([]models.Account, error) {
+	rows, err := s.db.Query(ctx, ListTeamAccountsSQL, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []models.Account{}
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, *account)
+	}
+
+	return accounts, rows.Err()
+}
@@ -0,0 +1,213 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// How many replaced tokens are kept for each resource
+const TokenHistoryLimit = 10
+
+const (
+	tokenColumns = `
+	resource_uuid, access_token, refresh_token, expires_at, issued_at, COALESCE(key_id, ''), data_key
+	`
+
+	// The token being replaced, if any, is copied to token_history in the same statement
+	UpsertTokenSQL = `
+	WITH replaced AS (
+		INSERT INTO token_history (resource_uuid, access_token, refresh_token, expires_at, issued_at, key_id, data_key)
+		SELECT resource_uuid, access_token, refresh_token, expires_at, issued_at, key_id, data_key
+		FROM tokens WHERE resource_uuid=$1
+	)
+	INSERT INTO tokens (resource_uuid, access_token, refresh_token, expires_at, issued_at, key_id, data_key)
+	VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+	ON CONFLICT (resource_uuid) DO UPDATE
+	SET access_token=EXCLUDED.access_token, refresh_token=EXCLUDED.refresh_token, expires_at=EXCLUDED.expires_at,
+		issued_at=EXCLUDED.issued_at, key_id=EXCLUDED.key_id, data_key=EXCLUDED.data_key;
+	`
+
+	TrimTokenHistorySQL = `
+	DELETE FROM token_history
+	WHERE resource_uuid=$1 AND id NOT IN (
+		SELECT id FROM token_history WHERE resource_uuid=$1 ORDER BY issued_at DESC, id DESC LIMIT $2
+	);
+	`
+
+	GetTokenSQL = `
+	SELECT ` + tokenColumns + ` FROM tokens WHERE resource_uuid=$1;
+	`
+
+	LockTokenSQL = `
+	SELECT ` + tokenColumns + ` FROM tokens WHERE resource_uuid=$1 FOR UPDATE;
+	`
+
+	ListTokensSQL = `
+	SELECT ` + tokenColumns + ` FROM tokens ORDER BY resource_uuid;
+	`
+
+	ListTokensExpiringBeforeSQL = `
+	SELECT ` + tokenColumns + ` FROM tokens WHERE expires_at < $1 ORDER BY expires_at;
+	`
+
+	ListTokenHistorySQL = `
+	SELECT id, ` + tokenColumns + ` FROM token_history WHERE resource_uuid=$1 ORDER BY issued_at DESC, id DESC;
+	`
+
+	// A token replaced since it was read has a different issued_at, and is left alone
+	RewriteTokenSQL = `
+	UPDATE tokens
+	SET access_token=$2, refresh_token=$3, key_id=NULLIF($4, ''), data_key=$5
+	WHERE resource_uuid=$1 AND issued_at=$6;
+	`
+
+	RewriteTokenHistorySQL = `
+	UPDATE token_history
+	SET access_token=$2, refresh_token=$3, key_id=NULLIF($4, ''), data_key=$5
+	WHERE id=$1;
+	`
+
+	DeleteTokenSQL = `
+	DELETE FROM tokens
+	WHERE resource_uuid=$1
+	`
+
+	DeleteTokenHistorySQL = `
+	DELETE FROM token_history
+	WHERE resource_uuid=$1
+	`
+)
+
+func (s *PostgresStore) SaveToken(ctx context.Context, token *models.Token) error {
+	if token.IssuedAt.IsZero() {
+		token.IssuedAt = time.Now()
+	}
+
+	return s.InTx(ctx, func(tx Store) error {
+		pg := tx.(*PostgresStore)
+		_, err := pg.db.Exec(ctx, UpsertTokenSQL,
+			token.ResourceUUID,
+			token.AccessToken,
+			token.RefreshToken,
+			token.ExpiresAt,
+			token.IssuedAt,
+			token.KeyID,
+			token.DataKey,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = pg.db.Exec(ctx, TrimTokenHistorySQL, token.ResourceUUID, TokenHistoryLimit)
+		return err
+	})
+}
+
+func (s *PostgresStore) GetToken(ctx context.Context, uuid string) (*models.Token, error) {
+	return s.getToken(ctx, GetTokenSQL, uuid)
+}
+
+// The row lock is held by the transaction this store runs in, if any
+func (s *PostgresStore) LockToken(ctx context.Context, uuid string) (*models.Token, error) {
+	return s.getToken(ctx, LockTokenSQL, uuid)
+}
+
+func (s *PostgresStore) getToken(ctx context.Context, sql string, uuid string) (*models.Token, error) {
+	token := &models.Token{}
+	err := scanToken(s.db.QueryRow(ctx, sql, uuid), token)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (s *PostgresStore) DeleteTokens(ctx context.Context, uuid string) error {
+	return s.InTx(ctx, func(tx Store) error {
+		pg := tx.(*PostgresStore)
+		_, err := pg.db.Exec(ctx, DeleteTokenSQL, uuid)
+		if err != nil {
+			return err
+		}
+
+		_, err = pg.db.Exec(ctx, DeleteTokenHistorySQL, uuid)
+		return err
+	})
+}
+
+func (s *PostgresStore) ListTokens(ctx context.Context) ([]models.Token, error) {
+	return s.queryTokens(ctx, false, ListTokensSQL)
+}
+
+func (s *PostgresStore) ListTokensExpiringBefore(ctx context.Context, before time.Time) ([]models.Token, error) {
+	return s.queryTokens(ctx, false, ListTokensExpiringBeforeSQL, before)
+}
+
+func (s *PostgresStore) ListTokenHistory(ctx context.Context, uuid string) ([]models.Token, error) {
+	return s.queryTokens(ctx, true, ListTokenHistorySQL, uuid)
+}
+
+func (s *PostgresStore) RewriteToken(ctx context.Context, token *models.Token) error {
+	if token.Id != 0 {
+		return s.execOne(ctx, RewriteTokenHistorySQL,
+			token.Id,
+			token.AccessToken,
+			token.RefreshToken,
+			token.KeyID,
+			token.DataKey,
+		)
+	}
+
+	return s.execOne(ctx, RewriteTokenSQL,
+		token.ResourceUUID,
+		token.AccessToken,
+		token.RefreshToken,
+		token.KeyID,
+		token.DataKey,
+		token.IssuedAt,
+	)
+}
+
+// Run a query returning token rows. History rows are prefixed by their id.
+func (s *PostgresStore) queryTokens(ctx context.Context, history bool, sql string, args ...interface{}) ([]models.Token, error) {
+	rows, err := s.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.Token{}
+	for rows.Next() {
+		token := models.Token{}
+		if history {
+			err = scanToken(rows, &token, &token.Id)
+		} else {
+			err = scanToken(rows, &token)
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// Scan tokenColumns into token, after any leading columns
+func scanToken(row pgx.Row, token *models.Token, leading ...interface{}) error {
+	dest := append(leading,
+		&token.ResourceUUID,
+		&token.AccessToken,
+		&token.RefreshToken,
+		&token.ExpiresAt,
+		&token.IssuedAt,
+		&token.KeyID,
+		&token.DataKey,
+	)
+	return row.Scan(dest...)
+}
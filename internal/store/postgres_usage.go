@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"sample_app/models"
+	"time"
+)
+
+const (
+	UsagePartitionExistsSQL = `
+	SELECT to_regclass($1) IS NOT NULL;
+	`
+
+	// Keeps instances from creating the same partition at once
+	LockUsagePartitionsSQL = `
+	SELECT pg_advisory_xact_lock(hashtext('usage_events partitions'));
+	`
+
+	// The event and both of its rollups are only written if its key is new
+	RecordUsageEventSQL = `
+	WITH new_key AS (
+		INSERT INTO usage_event_keys (resource_uuid, idempotency_key)
+		VALUES ($1, $5)
+		ON CONFLICT DO NOTHING
+		RETURNING resource_uuid
+	), event AS (
+		INSERT INTO usage_events (resource_uuid, meter, quantity, occurred_at, idempotency_key)
+		SELECT $1, $2, $3::double precision, $4::timestamptz, $5 FROM new_key
+	), rollups AS (
+		INSERT INTO usage_rollups (resource_uuid, meter, granularity, period_start, quantity, event_count)
+		SELECT $1, $2, g.granularity, date_trunc(g.granularity, $4::timestamptz AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', $3::double precision, 1
+		FROM new_key, (VALUES ('hour'), ('day')) AS g(granularity)
+		ON CONFLICT (resource_uuid, granularity, period_start, meter) DO UPDATE
+		SET quantity=usage_rollups.quantity + EXCLUDED.quantity, event_count=usage_rollups.event_count + 1
+	)
+	SELECT count(*) FROM new_key;
+	`
+
+	ListUsageRollupsSQL = `
+	SELECT resource_uuid, meter, granularity, period_start, quantity, event_count
+	FROM usage_rollups
+	WHERE resource_uuid=$1 AND granularity=$2 AND period_start >= $3 AND period_start < $4 AND ($5 = '' OR meter=$5)
+	ORDER BY period_start, meter;
+	`
+)
+
+func (s *PostgresStore) RecordUsageEvent(ctx context.Context, event *models.UsageEvent) (bool, error) {
+	err := s.ensureUsagePartition(ctx, event.OccurredAt)
+	if err != nil {
+		return false, err
+	}
+
+	var recorded int
+	err = s.db.QueryRow(ctx, RecordUsageEventSQL,
+		event.ResourceUUID,
+		event.Meter,
+		event.Quantity,
+		event.OccurredAt,
+		event.IdempotencyKey,
+	).Scan(&recorded)
+	if err != nil {
+		return false, err
+	}
+
+	return recorded > 0, nil
+}
+
+// Create the monthly partition of usage_events that holds events at t, if it
+// does not exist yet
+func (s *PostgresStore) ensureUsagePartition(ctx context.Context, t time.Time) error {
+	start := time.Date(t.UTC().Year(), t.UTC().Month(), 1, 0, 0, 0, 0, time.UTC)
+	name := start.Format("usage_events_2006_01")
+
+	var exists bool
+	err := s.db.QueryRow(ctx, UsagePartitionExistsSQL, name).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = s.db.Exec(ctx, LockUsagePartitionsSQL)
+	if err != nil {
+		return err
+	}
+
+	// Partition bounds cannot be parameters. Both are generated above.
+	_, err = s.db.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+name+` PARTITION OF usage_events
+	FOR VALUES FROM ('`+start.Format(time.RFC3339)+`') TO ('`+start.AddDate(0, 1, 0).Format(time.RFC3339)+`');`)
+	return err
+}
+
+func (s *PostgresStore) ListUsageRollups(ctx context.Context, uuid string, granularity models.UsageGranularity, from time.Time, to time.Time, meter string) ([]models.UsageRollup, error) {
+	rows, err := s.db.Query(ctx, ListUsageRollupsSQL, uuid, granularity, from, to, meter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rollups := []models.UsageRollup{}
+	for rows.Next() {
+		r := models.UsageRollup{}
+		err = rows.Scan(&r.ResourceUUID, &r.Meter, &r.Granularity, &r.PeriodStart, &r.Quantity, &r.EventCount)
+		if err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+
+	return rollups, rows.Err()
+}
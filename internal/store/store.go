@@ -0,0 +1,330 @@
+package store
+
+/**
+ * The store package hides where our accounts, tokens and activities live.
+ * Handlers in internal/server only talk to the Store interface, so the same
+ * code runs against Postgres in production and in memory for local testing.
+ */
+
+import (
+	"context"
+	"errors"
+	"sample_app/models"
+	"time"
+)
+
+var (
+	// Returned by any lookup or update that does not match an existing row
+	ErrNotFound = errors.New("not found")
+
+	// Returned when inserting a row that would duplicate a unique value
+	ErrConflict = errors.New("already exists")
+)
+
+// A change DigitalOcean made to a resource. Empty fields and a nil Status are left as they are.
+type AccountUpdate struct {
+	Name     string
+	PlanSlug string
+	Status   *models.Status
+
+	// When DigitalOcean made the change
+	UpdatedAt time.Time
+}
+
+// Accounts represent the user accounts on your system, also referred to as Resources.
+type AccountStore interface {
+	// Fetch the account for a given resource UUID
+	GetAccount(ctx context.Context, uuid string) (*models.Account, error)
+
+	// Fetch the account a license key was issued to
+	GetAccountByLicenseKey(ctx context.Context, licenseKey string) (*models.Account, error)
+
+	// Insert a new account. The account's Id, CreatedAt and ModifiedAt are filled in.
+	CreateAccount(ctx context.Context, account *models.Account) error
+
+	// Overwrite an existing account, matched by Id. A deprovisioned account
+	// becomes live again.
+	UpdateAccount(ctx context.Context, account *models.Account) error
+
+	// Change the plan of the account with the given resource UUID
+	UpdatePlan(ctx context.Context, uuid string, planSlug string) error
+
+	// Apply a change DigitalOcean made to the account with the given resource
+	// UUID, unless a change made at or after update.UpdatedAt was already
+	// applied. Reports whether the change was applied.
+	ApplyAccountUpdate(ctx context.Context, uuid string, update AccountUpdate) (bool, error)
+
+	// Set the status of the account with the given resource UUID
+	UpdateStatus(ctx context.Context, uuid string, status models.Status) error
+
+	// Record whether we hold a working OAuth grant for the account with the given resource UUID
+	UpdateOAuthState(ctx context.Context, uuid string, state models.OAuthState) error
+
+	// Replace the license key of the account with the given resource UUID
+	UpdateLicenseKey(ctx context.Context, uuid string, licenseKey string) error
+
+	// Mark the live account with the given resource UUID deprovisioned at the
+	// given time, clear its license key and revoke every key it was issued.
+	// Deprovisioned accounts are still returned by GetAccount, but the other
+	// updates above no longer match them, except UpdateAccount, which brings
+	// them back.
+	DeprovisionAccount(ctx context.Context, uuid string, at time.Time) error
+
+	// Permanently remove accounts deprovisioned before the given time, along
+	// with everything else stored for their resources and any teams left
+	// without accounts. Returns the resource UUIDs that were removed.
+	PurgeDeprovisionedAccounts(ctx context.Context, before time.Time) ([]string, error)
+}
+
+// Teams group the accounts provisioned by the same DigitalOcean team.
+type TeamStore interface {
+	// Record a team, unless it is already known. CreatedAt is filled in.
+	SaveTeam(ctx context.Context, team *models.Team) error
+
+	// Fetch the team with a given creator ID
+	GetTeam(ctx context.Context, id string) (*models.Team, error)
+
+	// List the accounts linked to a team, oldest first. Deprovisioned
+	// accounts are included until they are purged.
+	ListTeamAccounts(ctx context.Context, id string) ([]models.Account, error)
+}
+
+// Tokens represent the oauth grants DigitalOcean issues for each resource. Each
+// resource has one current token, plus a bounded history of the tokens it replaced.
+type TokenStore interface {
+	// Make the given token its resource's current token. The token it replaces
+	// is moved to the resource's history, which keeps the newest
+	// TokenHistoryLimit entries. IssuedAt defaults to now.
+	SaveToken(ctx context.Context, token *models.Token) error
+
+	// Fetch the current token for a given resource UUID
+	GetToken(ctx context.Context, uuid string) (*models.Token, error)
+
+	// Fetch the current token for a given resource UUID and keep anyone else
+	// from locking it until the surrounding InTx returns. Outside of InTx the
+	// lock is released as soon as the token is read.
+	LockToken(ctx context.Context, uuid string) (*models.Token, error)
+
+	// Remove the current token and history for a given resource UUID
+	DeleteTokens(ctx context.Context, uuid string) error
+
+	// List the current token of every resource
+	ListTokens(ctx context.Context) ([]models.Token, error)
+
+	// List the current token of every resource whose access token expires before the given time
+	ListTokensExpiringBefore(ctx context.Context, before time.Time) ([]models.Token, error)
+
+	// List the tokens a resource's current token replaced, newest first
+	ListTokenHistory(ctx context.Context, uuid string) ([]models.Token, error)
+
+	// Overwrite the stored values and encryption of an existing token without
+	// changing its expiry. Tokens with an Id are matched in history, others
+	// are matched to their resource's current token if it has the same
+	// IssuedAt, so a token replaced since it was read is never put back.
+	RewriteToken(ctx context.Context, token *models.Token) error
+}
+
+// OAuth grants hold the authorization codes from provisioning until they are
+// exchanged for tokens.
+type OAuthGrantStore interface {
+	// Save the grant for its resource, replacing any earlier one. CreatedAt is filled in.
+	SaveOAuthGrant(ctx context.Context, grant *models.OAuthGrant) error
+
+	// Fetch the grant for a given resource UUID and keep anyone else from
+	// locking it until the surrounding InTx returns, so each code is only
+	// exchanged once
+	LockOAuthGrant(ctx context.Context, uuid string) (*models.OAuthGrant, error)
+
+	// List grants whose next exchange attempt is due by the given time
+	ListDueOAuthGrants(ctx context.Context, now time.Time) ([]models.OAuthGrant, error)
+
+	// List every grant that is still to be exchanged
+	ListOAuthGrants(ctx context.Context) ([]models.OAuthGrant, error)
+
+	// Record the outcome of a failed exchange attempt on an existing grant
+	UpdateOAuthGrant(ctx context.Context, grant *models.OAuthGrant) error
+
+	// Remove the grant for a given resource UUID, if there is one
+	DeleteOAuthGrant(ctx context.Context, uuid string) error
+
+	// Overwrite the stored code and encryption of an existing grant
+	RewriteOAuthGrant(ctx context.Context, grant *models.OAuthGrant) error
+}
+
+// Entitlement overrides change what individual accounts are entitled to on
+// top of their plan.
+type EntitlementStore interface {
+	// Save an override, replacing any with the same resource, kind and name. CreatedAt is filled in.
+	SetEntitlementOverride(ctx context.Context, override *models.EntitlementOverride) error
+
+	// List the overrides for a given resource UUID, ordered by kind and name
+	ListEntitlementOverrides(ctx context.Context, uuid string) ([]models.EntitlementOverride, error)
+
+	// Remove an override
+	DeleteEntitlementOverride(ctx context.Context, uuid string, kind models.OverrideKind, name string) error
+}
+
+// Usage records how much of our product each resource consumes.
+type UsageStore interface {
+	// Record an event and add it to its resource's hourly and daily rollups.
+	// Reports false without recording anything if an event with the same
+	// resource and idempotency key was already recorded.
+	RecordUsageEvent(ctx context.Context, event *models.UsageEvent) (bool, error)
+
+	// List a resource's rollups of the given granularity for periods starting
+	// in [from, to), ordered by period and meter. An empty meter matches every meter.
+	ListUsageRollups(ctx context.Context, uuid string, granularity models.UsageGranularity, from time.Time, to time.Time, meter string) ([]models.UsageRollup, error)
+}
+
+// Activities represent an audit log of actions taken on an account.
+type ActivityStore interface {
+	// Insert a new activity. The activity's Id, CreatedAt and ModifiedAt are filled in.
+	CreateActivity(ctx context.Context, activity *models.Activity) error
+
+	// List all activities for a given resource UUID, oldest first
+	ListActivities(ctx context.Context, uuid string) ([]models.Activity, error)
+}
+
+// License keys keep the history of the keys issued to each resource.
+type LicenseKeyStore interface {
+	// Record a resource's new current key, which expires at its ExpiresAt, if
+	// set. Keys it replaces stop being accepted at graceUntil, or earlier if
+	// they were already due to. The key's Id and IssuedAt are filled in.
+	IssueLicenseKey(ctx context.Context, key *models.LicenseKey, graceUntil time.Time) error
+
+	// Fetch a key by the hash of its value
+	GetLicenseKey(ctx context.Context, keyHash string) (*models.LicenseKey, error)
+
+	// List the keys issued to a resource, newest first
+	ListLicenseKeys(ctx context.Context, uuid string) ([]models.LicenseKey, error)
+
+	// List the current keys of live accounts that expire before the given
+	// time, soonest first
+	ListExpiringLicenseKeys(ctx context.Context, before time.Time) ([]models.LicenseKey, error)
+
+	// Revoke one of a resource's keys at the given time. Keys that were
+	// already revoked are not found.
+	RevokeLicenseKey(ctx context.Context, uuid string, id int, at time.Time) error
+
+	// Record that a key was presented at the given time
+	TouchLicenseKey(ctx context.Context, id int, at time.Time) error
+}
+
+// License verifications are an audit log of license key lookups.
+type LicenseAuditStore interface {
+	// Insert a new verification. Its Id and CreatedAt are filled in.
+	RecordLicenseVerification(ctx context.Context, verification *models.LicenseVerification) error
+
+	// List the most recent verifications of a resource's license keys, newest first
+	ListLicenseVerifications(ctx context.Context, uuid string, limit int) ([]models.LicenseVerification, error)
+
+	// Remove verifications made before the given time. Returns how many were removed.
+	PurgeLicenseVerifications(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Sessions keep people signed in to the front-end after single sign-on.
+type SessionStore interface {
+	// Save a new SSO code. CreatedAt is filled in.
+	SaveSSOCode(ctx context.Context, code *models.SSOCode) error
+
+	// Remove the code with the given hash and return it, so that each code is
+	// only used once. Expired codes are returned too.
+	ConsumeSSOCode(ctx context.Context, codeHash string) (*models.SSOCode, error)
+
+	// Insert a new session. CreatedAt and LastSeenAt are filled in.
+	CreateSession(ctx context.Context, session *models.Session) error
+
+	// Fetch a session by the hash of its token
+	GetSession(ctx context.Context, tokenHash string) (*models.Session, error)
+
+	// Record that a session was used at the given time. Revoked sessions are not found.
+	TouchSession(ctx context.Context, tokenHash string, at time.Time) error
+
+	// Move a session to another resource. Revoked sessions are not found.
+	SwitchSession(ctx context.Context, tokenHash string, uuid string) error
+
+	// Revoke a session at the given time. Sessions that were already revoked
+	// are not found.
+	RevokeSession(ctx context.Context, tokenHash string, at time.Time) error
+
+	// Remove codes and sessions that expired before the given time, along
+	// with sessions last seen before idleBefore and revoked sessions. Returns
+	// how many sessions were removed.
+	PurgeSessions(ctx context.Context, before time.Time, idleBefore time.Time) (int64, error)
+}
+
+// Deprovision failures track resources DigitalOcean failed to deprovision
+// until a retry succeeds or an operator resolves them.
+type RemediationStore interface {
+	// Record that DigitalOcean failed to deprovision a resource and schedule a
+	// retry at the given time. An outstanding failure for the resource is left
+	// as it is, and a closed one is reopened.
+	ReportDeprovisionFailure(ctx context.Context, uuid string, retryAt time.Time) (*models.DeprovisionFailure, error)
+
+	// Fetch the failure for a given resource UUID
+	GetDeprovisionFailure(ctx context.Context, uuid string) (*models.DeprovisionFailure, error)
+
+	// List outstanding failures, or every failure if all is set, oldest report first
+	ListDeprovisionFailures(ctx context.Context, all bool) ([]models.DeprovisionFailure, error)
+
+	// List pending failures whose next retry is due by the given time
+	ListDueDeprovisionFailures(ctx context.Context, now time.Time) ([]models.DeprovisionFailure, error)
+
+	// Overwrite an existing failure, matched by ResourceUUID. ReportedAt is left as it is.
+	UpdateDeprovisionFailure(ctx context.Context, failure *models.DeprovisionFailure) error
+}
+
+// Config vars are what each resource was given to configure our product with,
+// as DigitalOcean shows them to the user.
+type ConfigVarStore interface {
+	// List the config vars of a given resource UUID, ordered by name
+	ListConfigVars(ctx context.Context, uuid string) ([]models.ConfigVar, error)
+
+	// Replace the config vars of a given resource UUID with the given set.
+	// UpdatedAt is filled in, and left as it was for vars that did not change.
+	SetConfigVars(ctx context.Context, uuid string, vars []models.ConfigVar) error
+}
+
+// The outbox holds config pushes to DigitalOcean until they are delivered.
+type OutboxStore interface {
+	// Queue a push. Any pending pushes for the same resource are superseded by
+	// it. The push's Id, Status and CreatedAt are filled in.
+	EnqueueConfigPush(ctx context.Context, push *models.ConfigPush) error
+
+	// Fetch the most recently queued push for a given resource UUID
+	GetLatestConfigPush(ctx context.Context, uuid string) (*models.ConfigPush, error)
+
+	// Fetch the most recently queued push for a given resource UUID and keep
+	// anyone else from locking it until the surrounding InTx returns, so pushes
+	// for a resource are delivered one at a time
+	LockLatestConfigPush(ctx context.Context, uuid string) (*models.ConfigPush, error)
+
+	// List pending pushes whose next attempt is due by the given time, oldest first
+	ListDueConfigPushes(ctx context.Context, now time.Time) ([]models.ConfigPush, error)
+
+	// Record the outcome of a delivery attempt on an existing push, matched by Id
+	UpdateConfigPush(ctx context.Context, push *models.ConfigPush) error
+}
+
+// Store is everything the server needs to persist.
+type Store interface {
+	AccountStore
+	TeamStore
+	TokenStore
+	OAuthGrantStore
+	EntitlementStore
+	UsageStore
+	ActivityStore
+	LicenseKeyStore
+	LicenseAuditStore
+	SessionStore
+	RemediationStore
+	ConfigVarStore
+	OutboxStore
+
+	// Run fn inside a transaction. The Store passed to fn must be used for every
+	// call that should be part of the transaction. If fn returns an error, all
+	// of its changes are rolled back. Calling InTx on a transactional Store runs
+	// fn inside the existing transaction.
+	InTx(ctx context.Context, fn func(Store) error) error
+}
@@ -10,6 +10,21 @@ const (
 	Suspended
 )
 
+// Whether we hold a working OAuth grant for an account
+type OAuthState string
+
+const (
+	// The authorization code from provisioning has not been exchanged yet
+	OAuthPending OAuthState = "pending"
+
+	// The code was exchanged, so we have tokens for the account
+	OAuthActive OAuthState = "active"
+
+	// The code could not be exchanged before it expired. DigitalOcean has to
+	// provision the resource again for us to get a new one.
+	OAuthFailed OAuthState = "failed"
+)
+
 // Sample Account structure used in this example
 type Account struct {
 	Id              int
@@ -24,6 +39,20 @@ type Account struct {
 	SourceId        string
 	Status          Status
 	LicenseKey      string
+	OAuthState      OAuthState
 	CreatedAt       time.Time
 	ModifiedAt      time.Time
+
+	// When DigitalOcean deprovisioned the account. The account is kept until
+	// the retention period runs out, unless the resource is provisioned again.
+	DeprovisionedAt *time.Time
+
+	// The team that provisioned the account. Empty for accounts provisioned
+	// before we kept track of teams.
+	TeamId string
+}
+
+// Whether DigitalOcean has deprovisioned the account
+func (a *Account) Deprovisioned() bool {
+	return a.DeprovisionedAt != nil
 }
@@ -7,7 +7,7 @@ type Activity struct {
 	Id           int
 	AccountId    int
 	ResourceUUID string
-	Type         int
+	Type         string
 	Title        string
 	Body         string
 	CreatedAt    time.Time
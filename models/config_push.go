@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Where a config push to DigitalOcean stands
+type PushStatus string
+
+const (
+	// Waiting to be delivered, or to be retried at NextAttemptAt
+	PushPending PushStatus = "pending"
+
+	// DigitalOcean accepted the config
+	PushDelivered PushStatus = "delivered"
+
+	// DigitalOcean rejected the config, or retries ran out
+	PushFailed PushStatus = "failed"
+
+	// A newer push for the same resource replaced it before it was delivered
+	PushSuperseded PushStatus = "superseded"
+)
+
+// Config vars waiting to be sent to DigitalOcean for a resource. Pushes are
+// written in the same transaction as the change they carry, so a change is
+// never committed without its push.
+type ConfigPush struct {
+	Id            int
+	ResourceUUID  string
+	Config        map[string]string
+	Status        PushStatus
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	DeliveredAt   *time.Time
+}
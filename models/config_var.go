@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// One of the config vars a resource was given
+type ConfigVar struct {
+	Name  string
+	Value string
+
+	// Set by hand rather than rendered from the plan's template. Pinned vars
+	// keep their value when the others are rendered again.
+	Pinned bool
+
+	UpdatedAt time.Time
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Where a failed deprovisioning stands
+type RemediationStatus string
+
+const (
+	// A retry of our own deprovisioning is scheduled for NextAttemptAt
+	RemediationPending RemediationStatus = "pending"
+
+	// Retries ran out, so an operator has to step in
+	RemediationExhausted RemediationStatus = "exhausted"
+
+	// A retry deprovisioned the resource
+	RemediationSucceeded RemediationStatus = "succeeded"
+
+	// An operator marked the failure as dealt with
+	RemediationResolved RemediationStatus = "resolved"
+)
+
+// A resource DigitalOcean told us it failed to deprovision, and what we have
+// done about it since
+type DeprovisionFailure struct {
+	ResourceUUID  string
+	Status        RemediationStatus
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	ReportedAt    time.Time
+
+	// Set once the failure is no longer outstanding
+	ResolvedAt *time.Time
+	Resolution string
+}
+
+// Whether someone or something still has to act on the failure
+func (f *DeprovisionFailure) Outstanding() bool {
+	return f.Status == RemediationPending || f.Status == RemediationExhausted
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// What an entitlement override changes
+type OverrideKind string
+
+const (
+	// Grants or withholds a feature, whatever the plan says
+	FeatureOverride OverrideKind = "feature"
+
+	// Replaces a numeric limit, whatever the plan says
+	LimitOverride OverrideKind = "limit"
+)
+
+// A change to what one account is entitled to on top of its plan, such as a
+// feature granted for a trial or a raised limit agreed with a customer
+type EntitlementOverride struct {
+	ResourceUUID string
+	Kind         OverrideKind
+
+	// The feature or limit being overridden
+	Name string
+
+	// Whether the feature is granted. Only used by feature overrides.
+	Enabled bool
+
+	// The limit to use instead of the plan's. Only used by limit overrides.
+	Limit int64
+
+	// Why the override was made
+	Reason    string
+	CreatedAt time.Time
+}
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// Whether a license key is still accepted
+type LicenseKeyStatus string
+
+const (
+	// The resource's current key
+	LicenseKeyActive LicenseKeyStatus = "active"
+
+	// Replaced by a newer key, but accepted until its grace period ends
+	LicenseKeyGrace LicenseKeyStatus = "grace"
+
+	// Past its grace period or its lifetime
+	LicenseKeyExpired LicenseKeyStatus = "expired"
+
+	// Withdrawn by hand, e.g. because it leaked, or by deprovisioning
+	LicenseKeyRevoked LicenseKeyStatus = "revoked"
+)
+
+// A license key issued to a resource. Only the resource's current key is kept
+// in full, on its account; keys are recorded here by hash.
+type LicenseKey struct {
+	Id           int
+	ResourceUUID string
+
+	// SHA-256 of the key, hex encoded
+	KeyHash string
+
+	// The last few characters of the key, so people can tell keys apart
+	Hint string
+
+	IssuedAt time.Time
+
+	// When a newer key replaced this one, which is nil for the current key,
+	// and when this one stops being accepted: at the end of its grace period
+	// once replaced, or of its lifetime if it was signed with one. ExpiresAt
+	// is nil for a key that does not expire.
+	ReplacedAt *time.Time
+	ExpiresAt  *time.Time
+
+	RevokedAt *time.Time
+
+	// When the key was last presented to us
+	LastUsedAt *time.Time
+}
+
+// Where the key stands at the given time
+func (k *LicenseKey) Status(now time.Time) LicenseKeyStatus {
+	switch {
+	case k.RevokedAt != nil:
+		return LicenseKeyRevoked
+	case k.ExpiresAt != nil && !now.Before(*k.ExpiresAt):
+		return LicenseKeyExpired
+	case k.ReplacedAt != nil:
+		return LicenseKeyGrace
+	}
+	return LicenseKeyActive
+}
+
+// Whether the key is accepted at the given time
+func (k *LicenseKey) Accepted(now time.Time) bool {
+	status := k.Status(now)
+	return status == LicenseKeyActive || status == LicenseKeyGrace
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// What a license key lookup found
+type LicenseVerificationResult string
+
+const (
+	// The key belongs to a live, active account
+	LicenseValid LicenseVerificationResult = "valid"
+
+	// The key belongs to a suspended account
+	LicenseSuspended LicenseVerificationResult = "suspended"
+
+	// The key was replaced and its grace period is over
+	LicenseExpired LicenseVerificationResult = "expired"
+
+	// The key was revoked
+	LicenseRevoked LicenseVerificationResult = "revoked"
+
+	// The key matches no live account, e.g. because it was made up or its
+	// account was deprovisioned
+	LicenseUnknown LicenseVerificationResult = "unknown"
+)
+
+// An audit record of someone checking a license key
+type LicenseVerification struct {
+	Id int
+
+	// SHA-256 of the license key, hex encoded. Keys themselves are never stored.
+	KeyHash string
+
+	// The resource the key belongs to. Empty when it matched no live account.
+	ResourceUUID string
+	Result       LicenseVerificationResult
+	RemoteIP     string
+	CreatedAt    time.Time
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// An authorization code from provisioning that is still to be exchanged for
+// tokens. It is removed once the exchange succeeds or the code expires.
+type OAuthGrant struct {
+	ResourceUUID  string
+	Code          string
+	ExpiresAt     time.Time
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+
+	// Set when Code is encrypted. See Token.
+	KeyID   string
+	DataKey []byte
+}
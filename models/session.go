@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// A single-use code the front-end exchanges for a session after DigitalOcean
+// signs someone in. Only the hash of the code is stored.
+type SSOCode struct {
+	CodeHash     string
+	ResourceUUID string
+	TeamId       string
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+// Someone signed in to the front-end, identified by a cookie. Only the hash of
+// the cookie's value is stored.
+type Session struct {
+	TokenHash string
+
+	// The resource the session is signed in to. It changes when the session
+	// switches to another of the team's resources.
+	ResourceUUID string
+
+	// The team of the resource the session was started for. Empty for
+	// resources provisioned before we kept track of teams.
+	TeamId string
+
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+
+	// When the session ends however active it is
+	ExpiresAt time.Time
+
+	RevokedAt *time.Time
+}
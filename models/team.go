@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// A DigitalOcean team that has provisioned resources for our add-on. Teams are
+// identified by the obfuscated creator_id DigitalOcean sends when provisioning.
+type Team struct {
+	Id        string
+	CreatedAt time.Time
+}
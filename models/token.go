@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// OAuth grant stored for a single resource, used to call the DigitalOcean API on its behalf
+type Token struct {
+	// Only set for tokens read from a resource's history. A resource's current
+	// token is identified by its ResourceUUID alone.
+	Id int
+
+	ResourceUUID string
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+	IssuedAt     time.Time
+
+	// Set when the tokens are encrypted at rest: the ID of the master key that
+	// wrapped DataKey, and the wrapped per-row key that encrypts the tokens.
+	// Both are empty for rows stored in plaintext.
+	KeyID   string
+	DataKey []byte
+}
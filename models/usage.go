@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// One measurement of how much of our product a resource used
+type UsageEvent struct {
+	ResourceUUID string
+
+	// What was measured, e.g. "api_requests"
+	Meter    string
+	Quantity float64
+
+	// When the usage happened, as reported by the service that measured it
+	OccurredAt time.Time
+
+	// Chosen by the sender. An event whose key was already recorded for the
+	// same resource is dropped, so batches can be resent safely.
+	IdempotencyKey string
+}
+
+// The length of the periods usage is totalled over
+type UsageGranularity string
+
+const (
+	UsageHourly UsageGranularity = "hour"
+	UsageDaily  UsageGranularity = "day"
+)
+
+// The total usage of one meter by one resource over an hour or a day
+type UsageRollup struct {
+	ResourceUUID string
+	Meter        string
+	Granularity  UsageGranularity
+
+	// Start of the period, in UTC
+	PeriodStart time.Time
+
+	Quantity   float64
+	EventCount int64
+}